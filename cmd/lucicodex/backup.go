@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aezizhu/LuciCodex/internal/backup"
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/ui"
+)
+
+func backupUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  lucicodex backup list")
+	fmt.Fprintln(os.Stderr, "  lucicodex [-dry-run=false] [-approve] backup restore <id>")
+}
+
+// runBackup implements the "backup" subcommand and returns the exit code.
+func runBackup(cfg config.Config, args []string, opts runOptions) int {
+	store := backup.NewStore(cfg.BackupDir, cfg.BackupKeep)
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		backups, err := store.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Backup error: %v\n", err)
+			return 1
+		}
+		if opts.jsonOutput {
+			return printJSON(backups)
+		}
+		if len(backups) == 0 {
+			fmt.Printf("No backups in %s.\n", cfg.BackupDir)
+			return 0
+		}
+		for _, b := range backups {
+			fmt.Printf("%s  %s  %6d bytes  %3d files", b.ID, b.Created.Format("2006-01-02 15:04:05"), b.Size, len(b.Files))
+			if b.Note != "" {
+				fmt.Printf("  %s", b.Note)
+			}
+			fmt.Println()
+		}
+		return 0
+
+	case len(args) == 2 && args[0] == "restore":
+		return restoreBackup(cfg, store, args[1], opts)
+	}
+	backupUsage()
+	return 1
+}
+
+// restoreResult is the JSON output of "backup restore".
+type restoreResult struct {
+	ID       string   `json:"id"`
+	Changes  []string `json:"changes"`
+	Restored []string `json:"restored"`
+	Undo     string   `json:"undo,omitempty"`
+	Reloaded bool     `json:"reloaded"`
+	DryRun   bool     `json:"dry_run,omitempty"`
+}
+
+func restoreBackup(cfg config.Config, store *backup.Store, id string, opts runOptions) int {
+	changes, err := store.Changes(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Backup error: %v\n", err)
+		return 1
+	}
+	res := restoreResult{ID: id, Changes: changes, DryRun: cfg.DryRun}
+	if !opts.jsonOutput {
+		if len(changes) == 0 {
+			fmt.Printf("The configuration already matches backup %s.\n", id)
+			return 0
+		}
+		fmt.Printf("Restoring backup %s changes:\n", id)
+		for _, c := range changes {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+	if len(changes) == 0 || cfg.DryRun {
+		if opts.jsonOutput {
+			return printJSON(res)
+		}
+		fmt.Println("\nDry run mode - nothing restored (use -dry-run=false)")
+		return 0
+	}
+	// Stdout carries only the JSON result, so there is no prompt to answer.
+	if opts.jsonOutput && !cfg.AutoApprove {
+		fmt.Fprintln(os.Stderr, "Error: restoring with -json requires -approve")
+		return 1
+	}
+	if !cfg.AutoApprove {
+		ok, err := ui.Confirm(bufio.NewReader(os.Stdin), os.Stdout, "Restore these files?")
+		if err != nil || !ok {
+			fmt.Println("Cancelled")
+			return 0
+		}
+	}
+
+	lockFile, _, err := acquireLock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer releaseLock(lockFile)
+
+	restored, undo, err := store.Restore(id)
+	res.Restored, res.Undo = restored, undo.ID
+	if len(restored) > 0 {
+		invalidateFacts(cfg)
+		reloads, rerr := executor.New(cfg).ReloadRestored(context.Background(), restored, false)
+		if rerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", rerr)
+		}
+		res.Reloaded = len(reloads) > 0 && rerr == nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Backup error: %v\n", err)
+		return 1
+	}
+	if opts.jsonOutput {
+		return printJSON(res)
+	}
+	fmt.Printf("Restored %d files; the previous configuration is saved as backup %s.\n", len(restored), undo.ID)
+	if res.Reloaded {
+		fmt.Println("Reloaded services whose configuration changed.")
+	}
+	return 0
+}
+
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+		return 1
+	}
+	return 0
+}
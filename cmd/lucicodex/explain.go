@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/explain"
+	"github.com/aezizhu/LuciCodex/internal/llm"
+	"github.com/aezizhu/LuciCodex/internal/ui"
+)
+
+func explainUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  lucicodex explain [--] <command> [args...]   explain a command (argv)")
+	fmt.Fprintln(os.Stderr, "  lucicodex explain -plan <file|->             explain a plan JSON file")
+	fmt.Fprintln(os.Stderr, "  lucicodex explain -uci <package>             explain the output of 'uci show <package>'")
+	fmt.Fprintln(os.Stderr, "  lucicodex explain -file <file|->             explain a pasted config dump")
+}
+
+// runExplain implements the "explain" subcommand and returns the exit code.
+// Nothing is generated or executed besides the read-only "uci show".
+func runExplain(cfg config.Config, args []string, opts runOptions) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	planPath := fs.String("plan", "", "plan JSON file to explain ('-' for stdin)")
+	uciPkg := fs.String("uci", "", "UCI package whose 'uci show' output to explain")
+	dumpPath := fs.String("file", "", "config dump to explain ('-' for stdin)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	ctx := context.Background()
+	var subject explain.Subject
+	switch {
+	case *planPath != "":
+		p, err := readPlanFile(*planPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Explain error: %v\n", err)
+			return 1
+		}
+		subject = explain.PlanSubject(p)
+	case *uciPkg != "":
+		cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		out, err := exec.CommandContext(cctx, "uci", "-q", "show", *uciPkg).Output()
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Explain error: uci show %s: %v\n", *uciPkg, err)
+			return 1
+		}
+		subject = explain.ConfigSubject(string(out))
+	case *dumpPath != "":
+		var (
+			b   []byte
+			err error
+		)
+		if *dumpPath == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(*dumpPath)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Explain error: %v\n", err)
+			return 1
+		}
+		subject = explain.ConfigSubject(string(b))
+	case fs.NArg() > 0:
+		subject = explain.CommandSubject(fs.Args())
+	default:
+		explainUsage()
+		return 1
+	}
+
+	envFacts := collectFacts(ctx, cfg, subject.Text, opts)
+	if opts.showPrompt {
+		return printPrompt(cfg, explain.BuildPrompt(subject, envFacts), opts)
+	}
+	explainCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	e, err := explain.Explain(explainCtx, llm.NewProvider(cfg), subject, envFacts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LLM error: %v\n", err)
+		return 1
+	}
+
+	if opts.jsonOutput {
+		if err := ui.PrintExplanationJSON(os.Stdout, e); err != nil {
+			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	ui.PrintExplanation(os.Stdout, e)
+	return 0
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/redact"
+	"github.com/aezizhu/LuciCodex/internal/ui"
+)
+
+func factsUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  lucicodex facts [request...]              facts sent with a request, after redaction")
+	fmt.Fprintln(os.Stderr, "  lucicodex facts -all                     every topic, without the token budget")
+	fmt.Fprintln(os.Stderr, "  lucicodex facts diff                    changes since facts were last cached")
+	fmt.Fprintln(os.Stderr, "  lucicodex facts diff old.json            changes since a saved snapshot")
+	fmt.Fprintln(os.Stderr, "  lucicodex facts diff old.json new.json   changes between two saved snapshots")
+}
+
+// runFacts implements the "facts" subcommand and returns the exit code.
+func runFacts(cfg config.Config, args []string, opts runOptions) int {
+	if len(args) > 0 && args[0] == "diff" {
+		return runFactsDiff(cfg, args, opts)
+	}
+	fs := flag.NewFlagSet("facts", flag.ContinueOnError)
+	all := fs.Bool("all", false, "collect every topic regardless of the request and token budget")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	snap := factsSnapshot(ctx, cfg, openwrt.FactsOptions{Prompt: strings.Join(fs.Args(), " "), TokenBudget: cfg.FactsTokenBudget, All: *all})
+	cancel()
+
+	var r *redact.Redactor
+	if cfg.Redact {
+		r = redact.New(cfg)
+	}
+	if opts.jsonOutput {
+		if r != nil {
+			for i := range snap.Facts {
+				snap.Facts[i].Data = r.RedactJSON(snap.Facts[i].Data)
+			}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(snap); err != nil {
+			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	text := snap.String()
+	if r != nil {
+		text = r.Redact(text)
+	}
+	if text == "" {
+		fmt.Fprintln(os.Stderr, "No facts collected.")
+		return 1
+	}
+	fmt.Println(text)
+	printSize(text)
+	return 0
+}
+
+// runFactsDiff implements "facts diff".
+func runFactsDiff(cfg config.Config, args []string, opts runOptions) int {
+	if len(args) > 3 {
+		factsUsage()
+		return 1
+	}
+	var (
+		old, cur openwrt.FactsSnapshot
+		err      error
+	)
+	cache := openwrt.OpenFactsCache(cfg.FactsCacheFile)
+	if len(args) > 1 {
+		if old, err = readSnapshot(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Facts error: %v\n", err)
+			return 1
+		}
+	} else {
+		old = cache.Snapshot()
+		if len(old.Facts) == 0 {
+			fmt.Fprintln(os.Stderr, "Facts error: no cached facts to compare with")
+			return 1
+		}
+	}
+	if len(args) > 2 {
+		if cur, err = readSnapshot(args[2]); err != nil {
+			fmt.Fprintf(os.Stderr, "Facts error: %v\n", err)
+			return 1
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cur = openwrt.CollectFactsSnapshot(ctx, openwrt.FactsOptions{All: true, Refresh: true, Cache: cache})
+		cancel()
+		if err := cache.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: facts cache: %v\n", err)
+		}
+	}
+
+	// Snapshots saved by "facts -json" hold placeholders instead of secrets.
+	var changes []openwrt.FactChange
+	for _, c := range openwrt.DiffFacts(old, cur) {
+		if !isPlaceholderValue(c.Old) && !isPlaceholderValue(c.New) {
+			changes = append(changes, c)
+		}
+	}
+	if opts.jsonOutput {
+		if err := ui.PrintFactChangesJSON(os.Stdout, changes); err != nil {
+			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	ui.PrintFactChanges(os.Stdout, changes)
+	return 0
+}
+
+func isPlaceholderValue(v string) bool {
+	var s string
+	return json.Unmarshal([]byte(v), &s) == nil && redact.IsPlaceholder(s)
+}
+
+// printPrompt prints prompt as it would be sent to the provider, after
+// redaction, with its size. Nothing is sent.
+func printPrompt(cfg config.Config, prompt string, opts runOptions) int {
+	if cfg.Redact {
+		prompt = redact.New(cfg).Redact(prompt)
+	}
+	if opts.jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(struct {
+			Prompt          string `json:"prompt"`
+			Bytes           int    `json:"bytes"`
+			EstimatedTokens int    `json:"estimated_tokens"`
+		}{prompt, len(prompt), openwrt.EstimateTokens(prompt)})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Println(prompt)
+	printSize(prompt)
+	return 0
+}
+
+// printSize reports the size of text on stderr, keeping stdout exact.
+func printSize(text string) {
+	fmt.Fprintf(os.Stderr, "\n%d bytes, ~%d tokens (estimated)\n", len(text), openwrt.EstimateTokens(text))
+}
+
+// readSnapshot reads a facts snapshot saved as JSON.
+func readSnapshot(path string) (openwrt.FactsSnapshot, error) {
+	var snap openwrt.FactsSnapshot
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return snap, fmt.Errorf("read snapshot: %w", err)
+	}
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return snap, fmt.Errorf("parse snapshot %s: %w", path, err)
+	}
+	return snap, nil
+}
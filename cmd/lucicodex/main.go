@@ -11,14 +11,18 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aezizhu/LuciCodex/internal/answer"
+	"github.com/aezizhu/LuciCodex/internal/backup"
 	"github.com/aezizhu/LuciCodex/internal/config"
 	"github.com/aezizhu/LuciCodex/internal/executor"
 	"github.com/aezizhu/LuciCodex/internal/llm"
 	"github.com/aezizhu/LuciCodex/internal/logging"
 	"github.com/aezizhu/LuciCodex/internal/openwrt"
 	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/plan/lint"
 	"github.com/aezizhu/LuciCodex/internal/policy"
 	"github.com/aezizhu/LuciCodex/internal/repl"
+	"github.com/aezizhu/LuciCodex/internal/security"
 	"github.com/aezizhu/LuciCodex/internal/ui"
 	"github.com/aezizhu/LuciCodex/internal/wizard"
 )
@@ -55,6 +59,11 @@ func releaseLock(f *os.File) {
 }
 
 func main() {
+	// The executor re-executes this binary to isolate read-only commands.
+	if len(os.Args) > 1 && os.Args[1] == security.IsolateArg {
+		os.Exit(security.IsolateMain(os.Args[2:]))
+	}
+
 	var (
 		configPath  = flag.String("config", "", "path to JSON config file")
 		model       = flag.String("model", "", "model name")
@@ -71,6 +80,10 @@ func main() {
 		interactive = flag.Bool("interactive", false, "start interactive REPL mode")
 		setup       = flag.Bool("setup", false, "run setup wizard")
 		joinArgs    = flag.Bool("join-args", false, "join all arguments into single prompt (experimental)")
+		preview     = flag.Bool("preview", true, "preview resulting UCI config changes as a diff")
+		lintPlan    = flag.Bool("lint", true, "check plans for common OpenWrt mistakes")
+		answerMode  = flag.Bool("answer", false, "summarize command outputs into a direct answer")
+		showPrompt  = flag.Bool("show-prompt", false, "print the assembled prompt and its size instead of sending it")
 	)
 
 	flag.Parse()
@@ -111,6 +124,9 @@ func main() {
 	if !*confirmEach && cfg.ConfirmEach {
 		*confirmEach = true
 	}
+	if !*answerMode && cfg.AnswerMode {
+		*answerMode = true
+	}
 
 	if *setup {
 		w := wizard.New(os.Stdin, os.Stdout)
@@ -134,10 +150,31 @@ func main() {
 	args := flag.Args()
 	if len(args) == 0 {
 		fmt.Fprintf(os.Stderr, "Usage: lucicodex [flags] <prompt>\n")
+		fmt.Fprintf(os.Stderr, "       lucicodex [flags] recipe <save|list|run> ...\n")
+		fmt.Fprintf(os.Stderr, "       lucicodex [flags] explain [-plan file | -uci pkg | -file path] [argv...]\n")
+		fmt.Fprintf(os.Stderr, "       lucicodex [flags] facts [-all] [request...] | facts diff [old.json [new.json]]\n")
+		fmt.Fprintf(os.Stderr, "       lucicodex [flags] backup <list|restore <id>>\n")
+		fmt.Fprintf(os.Stderr, "       lucicodex schema\n")
 		fmt.Fprintf(os.Stderr, "Run 'lucicodex -h' for help\n")
 		os.Exit(1)
 	}
 
+	opts := runOptions{jsonOutput: *jsonOutput, confirmEach: *confirmEach, preview: *preview, lint: *lintPlan, facts: *facts, answer: *answerMode, showPrompt: *showPrompt}
+
+	switch args[0] {
+	case "explain":
+		os.Exit(runExplain(cfg, args[1:], opts))
+	case "recipe":
+		os.Exit(runRecipe(cfg, args[1:], opts))
+	case "facts":
+		os.Exit(runFacts(cfg, args[1:], opts))
+	case "backup":
+		os.Exit(runBackup(cfg, args[1:], opts))
+	case "schema":
+		os.Stdout.Write(plan.Schema())
+		os.Exit(0)
+	}
+
 	var prompt string
 	if *joinArgs {
 		prompt = strings.Join(args, " ")
@@ -147,21 +184,17 @@ func main() {
 	ctx := context.Background()
 
 	llmProvider := llm.NewProvider(cfg)
-	policyEngine := policy.New(cfg)
-	execEngine := executor.New(cfg)
-	logger := logging.New(cfg.LogFile)
 
 	instruction := plan.BuildInstructionWithLimit(cfg.MaxCommands)
-	if *facts {
-		factsCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-		defer cancel()
-		envFacts := openwrt.CollectFacts(factsCtx)
-		if envFacts != "" {
-			instruction += "\n\nEnvironment facts (read-only):\n" + envFacts
-		}
+	envFacts := collectFacts(ctx, cfg, prompt, opts)
+	if envFacts != "" {
+		instruction += "\n\n" + plan.FenceUntrusted("Environment facts (read-only)", envFacts)
 	}
 
 	fullPrompt := instruction + "\n\nUser request: " + prompt
+	if opts.showPrompt {
+		os.Exit(printPrompt(cfg, fullPrompt, opts))
+	}
 
 	// Generate plan
 	planCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
@@ -172,10 +205,68 @@ func main() {
 		fmt.Fprintf(os.Stderr, "LLM error: %v\n", err)
 		os.Exit(1)
 	}
+	p.MarkUntrusted("environment facts", envFacts)
+
+	os.Exit(handlePlan(ctx, cfg, llmProvider, prompt, p, opts))
+}
+
+// runOptions carries the CLI flags that affect how a plan is shown and executed.
+type runOptions struct {
+	jsonOutput  bool
+	confirmEach bool
+	preview     bool
+	lint        bool
+	facts       bool
+	answer      bool
+	showPrompt  bool
+}
+
+// collectFacts returns the environment facts relevant to prompt, or "" when
+// disabled. Facts still fresh in the facts cache are not collected again.
+func collectFacts(ctx context.Context, cfg config.Config, prompt string, opts runOptions) string {
+	if !opts.facts {
+		return ""
+	}
+	factsCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	return factsSnapshot(factsCtx, cfg, openwrt.FactsOptions{Prompt: prompt, TokenBudget: cfg.FactsTokenBudget}).String()
+}
+
+// factsSnapshot collects facts through the facts cache.
+func factsSnapshot(ctx context.Context, cfg config.Config, fo openwrt.FactsOptions) openwrt.FactsSnapshot {
+	fo.Cache = openwrt.OpenFactsCache(cfg.FactsCacheFile)
+	snap := openwrt.CollectFactsSnapshot(ctx, fo)
+	if err := fo.Cache.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: facts cache: %v\n", err)
+	}
+	return snap
+}
+
+// invalidateFacts marks the cached facts stale after commands ran, keeping
+// them as the baseline of "facts diff".
+func invalidateFacts(cfg config.Config) {
+	cache := openwrt.OpenFactsCache(cfg.FactsCacheFile)
+	cache.Invalidate()
+	if err := cache.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: facts cache: %v\n", err)
+	}
+}
+
+// handlePlan validates, prints and (unless in dry-run mode) executes a plan.
+// provider answers from the results in answer mode; it should be the one
+// that generated the plan, so that its redactor knows the plan's secrets.
+// It returns the process exit code.
+func handlePlan(ctx context.Context, cfg config.Config, provider llm.Provider, prompt string, p plan.Plan, opts runOptions) int {
+	policyEngine := policy.New(cfg)
+	execEngine := executor.New(cfg)
+	logger := logging.New(cfg.LogFile)
+	if r := llm.Redactor(provider); r != nil {
+		logger.SetRedactor(r)
+	}
 
 	if len(p.Commands) == 0 {
 		fmt.Println("No commands proposed.")
-		os.Exit(0)
+		return 0
 	}
 
 	if cfg.MaxCommands > 0 && len(p.Commands) > cfg.MaxCommands {
@@ -185,13 +276,27 @@ func main() {
 	// Validate plan
 	if err := policyEngine.ValidatePlan(p); err != nil {
 		fmt.Fprintf(os.Stderr, "Plan rejected by policy: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	policyEngine.AnnotateUCI(&p)
+
+	p.ConfigDiffs = nil
+	if opts.preview {
+		previewCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		p.ConfigDiffs, _ = openwrt.PreviewUCI(previewCtx, p, openwrt.PreviewOptions{})
+		cancel()
+	}
+
+	if opts.lint {
+		lintCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		lint.Annotate(&p, lint.Options{Sections: openwrt.UCISectionLookup(lintCtx), AutoReload: cfg.AutoReload})
+		cancel()
 	}
 
-	if *jsonOutput {
+	if opts.jsonOutput {
 		if err := ui.PrintPlanJSON(os.Stdout, p); err != nil {
 			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
 	} else {
 		ui.PrintPlan(os.Stdout, p)
@@ -200,47 +305,65 @@ func main() {
 	logger.Plan(prompt, p)
 
 	if cfg.DryRun {
-		if !*jsonOutput {
+		if !opts.jsonOutput {
 			fmt.Println("\nDry run mode - no execution")
 		}
-		os.Exit(0)
+		return 0
 	}
 
-	if !cfg.AutoApprove {
+	if policy.RequiresConfirmation(p, cfg.AutoApprove) {
+		if cfg.AutoApprove {
+			fmt.Fprintln(os.Stderr, "Auto-approve ignored: the plan was generated from untrusted device data (use -facts=false to allow it)")
+		}
 		reader := bufio.NewReader(os.Stdin)
 		ok, err := ui.Confirm(reader, os.Stdout, "Execute these commands?")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Confirmation error: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
 		if !ok {
 			fmt.Println("Cancelled")
-			os.Exit(0)
+			return 0
 		}
 	}
 
 	lockFile, lockPath, err := acquireLock()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 	defer releaseLock(lockFile)
-	
+
 	fmt.Fprintf(os.Stderr, "Acquired execution lock: %s\n", lockPath)
-	
+
+	watchdog := execEngine.NewWatchdog(ctx, p)
+	var rollback executor.Rollback
+	if (cfg.Backup || watchdog != nil) && !policyEngine.ReadOnlyPlan(p) {
+		store := backup.NewStore(cfg.BackupDir, cfg.BackupKeep)
+		b, err := store.Create(prompt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Backup error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Saved backup %s (%d files); undo with: lucicodex -dry-run=false backup restore %s\n", b.ID, len(b.Files), b.ID)
+		rollback = execEngine.BackupRollback(store, b.ID, p)
+	}
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
 	go func() {
-		<-sigc
-		releaseLock(lockFile)
-		os.Exit(1)
+		if _, ok := <-sigc; ok {
+			releaseLock(lockFile)
+			os.Exit(1)
+		}
 	}()
 
 	var results executor.Results
-	if *confirmEach {
+	if opts.confirmEach {
 		reader := bufio.NewReader(os.Stdin)
 		for i, cmd := range p.Commands {
-			fmt.Printf("\nExecute command %d: %s\n", i+1, executor.FormatCommand(cmd.Command))
+			fmt.Printf("\nExecute command %d: %s\n", i+1, executor.FormatStep(cmd))
 			ok, err := ui.Confirm(reader, os.Stdout, "Proceed?")
 			if err != nil || !ok {
 				fmt.Println("Skipped")
@@ -252,14 +375,36 @@ func main() {
 				results.Failed++
 			}
 		}
+		if cfg.AutoReload {
+			for k, step := range execEngine.ReloadSteps(p, results.Items) {
+				fmt.Printf("\nExecute automatic step: %s (%s)\n", executor.FormatStep(step), step.Description)
+				ok, err := ui.Confirm(reader, os.Stdout, "Proceed?")
+				if err != nil || !ok {
+					fmt.Println("Skipped")
+					continue
+				}
+				result := execEngine.RunAuto(ctx, len(p.Commands)+k, step)
+				results.Items = append(results.Items, result)
+				if result.Err != nil {
+					results.Failed++
+				}
+			}
+		}
 	} else {
 		results = execEngine.RunPlan(ctx, p)
 	}
+	if watchdog != nil && len(results.Items) > 0 {
+		fmt.Fprintln(os.Stderr, "Checking connectivity...")
+		results.Watchdog = watchdog.Verify(ctx, rollback)
+	}
+	if len(results.Items) > 0 {
+		invalidateFacts(cfg)
+	}
 
-	if *jsonOutput {
+	if opts.jsonOutput {
 		if err := ui.PrintResultsJSON(os.Stdout, results); err != nil {
 			fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
 	} else {
 		ui.PrintResults(os.Stdout, results)
@@ -272,16 +417,42 @@ func main() {
 			errStr = it.Err.Error()
 		}
 		items = append(items, logging.ResultItem{
-			Index:   it.Index,
-			Command: it.Command,
-			Output:  it.Output,
-			Error:   errStr,
-			Elapsed: it.Elapsed,
+			Index:      it.Index,
+			Command:    it.Command,
+			Pipeline:   it.Step.Pipeline,
+			StdoutFile: it.Step.StdoutFile,
+			WriteFile:  it.Step.WritePath(),
+			Output:     it.Output,
+			ExitCode:   it.ExitCode,
+			Signal:     it.Signal,
+			TimedOut:   it.TimedOut,
+			Error:      errStr,
+			Elapsed:    it.Elapsed,
 		})
 	}
 	logger.Results(items)
 
-	if results.Failed > 0 {
-		os.Exit(1)
+	if opts.answer && len(results.Items) > 0 {
+		answerCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		a, err := answer.Summarize(answerCtx, provider, prompt, results)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Answer error: %v\n", err)
+		} else {
+			logger.Answer(prompt, a)
+			if opts.jsonOutput {
+				if err := ui.PrintAnswerJSON(os.Stdout, a); err != nil {
+					fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+					return 1
+				}
+			} else {
+				ui.PrintAnswer(os.Stdout, a)
+			}
+		}
+	}
+
+	if results.Failed > 0 || results.Watchdog.Failed() {
+		return 1
 	}
+	return 0
 }
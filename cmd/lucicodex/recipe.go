@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/llm"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/recipe"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func recipeUsage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  lucicodex recipe save [-plan file|-] [-description text] [-param name:type[:description]]... <name>")
+	fmt.Fprintln(os.Stderr, "  lucicodex recipe list")
+	fmt.Fprintln(os.Stderr, "  lucicodex [-dry-run=false] [-approve] recipe run <name> [key=value]...")
+	fmt.Fprintln(os.Stderr, "Parameter types: string, int, port, ip, ipv4, ipv6, mac, iface")
+}
+
+// runRecipe implements the "recipe" subcommand and returns the exit code.
+func runRecipe(cfg config.Config, args []string, opts runOptions) int {
+	if len(args) == 0 {
+		recipeUsage()
+		return 1
+	}
+	store := recipe.NewStore(cfg.RecipesDir)
+
+	switch args[0] {
+	case "save":
+		fs := flag.NewFlagSet("recipe save", flag.ContinueOnError)
+		planPath := fs.String("plan", "-", "plan JSON file to save ('-' for stdin)")
+		description := fs.String("description", "", "recipe description")
+		var params stringList
+		fs.Var(&params, "param", "parameter declaration name:type[:description] (repeatable)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 1
+		}
+		if fs.NArg() != 1 {
+			recipeUsage()
+			return 1
+		}
+		p, err := readPlanFile(*planPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		r := recipe.Recipe{Name: fs.Arg(0), Description: *description, Plan: p}
+		for _, decl := range params {
+			param, err := recipe.ParseParam(decl)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+				return 1
+			}
+			r.Params = append(r.Params, param)
+		}
+		if err := store.Save(r); err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Saved recipe %q (%d commands, %d parameters)\n", r.Name, len(r.Plan.Commands), len(r.Params))
+		return 0
+
+	case "list":
+		recipes, err := store.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		if opts.jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(recipes); err != nil {
+				fmt.Fprintf(os.Stderr, "JSON output error: %v\n", err)
+				return 1
+			}
+			return 0
+		}
+		if len(recipes) == 0 {
+			fmt.Println("No recipes saved.")
+			return 0
+		}
+		for _, r := range recipes {
+			fmt.Printf("%s (%d commands)", r.Name, len(r.Plan.Commands))
+			if r.Description != "" {
+				fmt.Printf(" - %s", r.Description)
+			}
+			fmt.Println()
+			for _, p := range r.Params {
+				fmt.Printf("    %s:%s", p.Name, p.Type)
+				if p.Default != "" {
+					fmt.Printf(" (default %s)", p.Default)
+				}
+				if p.Description != "" {
+					fmt.Printf(" - %s", p.Description)
+				}
+				fmt.Println()
+			}
+		}
+		return 0
+
+	case "run":
+		if len(args) < 2 {
+			recipeUsage()
+			return 1
+		}
+		r, err := store.Load(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		values, err := recipe.ParseValues(args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		p, err := r.Render(values)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipe error: %v\n", err)
+			return 1
+		}
+		return handlePlan(context.Background(), cfg, llm.NewProvider(cfg), "recipe "+strings.Join(args[1:], " "), p, opts)
+
+	default:
+		recipeUsage()
+		return 1
+	}
+}
+
+func readPlanFile(path string) (plan.Plan, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return plan.Plan{}, fmt.Errorf("read plan: %w", err)
+	}
+	p, err := plan.TryUnmarshalPlan(string(b))
+	if err != nil {
+		return p, fmt.Errorf("parse plan: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,105 @@
+// Package answer turns command results into a direct answer to the user's
+// question with a second model pass.
+package answer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/llm"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// maxOutputPerCommand caps how much of each command's output is sent.
+const maxOutputPerCommand = 4096
+
+// Table is an optional structured view of the answer.
+type Table struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// Answer is the model's summary of the results.
+type Answer struct {
+	Answer string `json:"answer"`
+	Table  *Table `json:"table,omitempty"`
+}
+
+// BuildPrompt returns the prompt asking the model to answer question from res.
+func BuildPrompt(question string, res executor.Results) string {
+	b := &strings.Builder{}
+	b.WriteString("You are a router assistant. Answer the user's question using only the command outputs below.\n")
+	b.WriteString("Output only strict JSON that conforms to this schema:\n")
+	b.WriteString("{\n  \"answer\": string,\n  \"table\": { \"columns\": [string], \"rows\": [[string]] } | null\n}\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Keep the answer concise and direct; say so if the outputs do not contain the answer.\n")
+	b.WriteString("- Use a table only for lists of similar items (devices, interfaces, leases); otherwise null.\n")
+	b.WriteString("- Do not propose commands.\n")
+	b.WriteString(plan.UntrustedRule)
+	b.WriteString("\nUser question: ")
+	b.WriteString(question)
+	b.WriteString("\n\nCommand outputs:\n")
+	for _, it := range res.Items {
+		fmt.Fprintf(b, "\n[%d] $ %s", it.Index+1, executor.FormatStep(it.Step))
+		if it.Err != nil {
+			fmt.Fprintf(b, " (failed: %v)", it.Err)
+		}
+		b.WriteString("\n")
+		out := strings.TrimSpace(it.Output)
+		if len(out) > maxOutputPerCommand {
+			// Cut at a rune boundary so the prompt stays valid UTF-8.
+			n := maxOutputPerCommand
+			for n > 0 && !utf8.RuneStart(out[n]) {
+				n--
+			}
+			out = out[:n] + "\n[output truncated]"
+		}
+		b.WriteString(plan.FenceUntrusted("output", out))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Summarize asks the provider for an answer to question based on res. A
+// redacting provider redacts each output by the step that produced it
+// before the output is fenced into the prompt.
+func Summarize(ctx context.Context, p llm.Provider, question string, res executor.Results) (Answer, error) {
+	var a Answer
+	if len(res.Items) == 0 {
+		return a, errors.New("no results to summarize")
+	}
+	redacted := executor.Results{Items: make([]executor.Result, len(res.Items))}
+	for i, it := range res.Items {
+		it.Output = llm.RedactOutput(p, it.Step, it.Output)
+		redacted.Items[i] = it
+	}
+	if err := llm.CompleteJSON(ctx, p, BuildPrompt(question, redacted), &a); err != nil {
+		return a, err
+	}
+	a.Answer = strings.TrimSpace(a.Answer)
+	if a.Answer == "" {
+		return a, errors.New("empty answer")
+	}
+	a.Table = normalizeTable(a.Table)
+	return a, nil
+}
+
+// normalizeTable drops empty tables and pads or trims rows to the column count.
+func normalizeTable(t *Table) *Table {
+	if t == nil || len(t.Columns) == 0 || len(t.Rows) == 0 {
+		return nil
+	}
+	for i, row := range t.Rows {
+		switch {
+		case len(row) > len(t.Columns):
+			t.Rows[i] = row[:len(t.Columns)]
+		case len(row) < len(t.Columns):
+			t.Rows[i] = append(row, make([]string, len(t.Columns)-len(row))...)
+		}
+	}
+	return t
+}
@@ -0,0 +1,109 @@
+package answer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/llm"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/redact"
+)
+
+type fakeProvider struct{ reply string }
+
+func (f fakeProvider) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
+	return plan.Plan{}, nil
+}
+
+func (f fakeProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	return f.reply, nil
+}
+
+// promptRecorder records the prompts it is sent.
+type promptRecorder struct{ prompts []string }
+
+func (f *promptRecorder) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
+	return plan.Plan{}, nil
+}
+
+func (f *promptRecorder) Complete(ctx context.Context, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	return `{"answer":"The key is __SECRET_1__."}`, nil
+}
+
+func leases() executor.Results {
+	return executor.Results{Items: []executor.Result{
+		{Index: 0, Command: []string{"cat", "/tmp/dhcp.leases"}, Step: plan.PlannedCommand{Command: []string{"cat", "/tmp/dhcp.leases"}}, Output: "1700000000 aa:bb:cc:dd:ee:ff 192.168.1.10 laptop *\n"},
+		{Index: 1, Command: []string{"ubus", "call", "hostapd.wlan0", "get_clients"}, Err: errors.New("exit status 4")},
+	}}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	got := BuildPrompt("which devices are connected?", leases())
+	for _, want := range []string{"which devices are connected?", "[1] $ cat /tmp/dhcp.leases", "192.168.1.10 laptop", "(failed: exit status 4)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected prompt to contain %q", want)
+		}
+	}
+
+	big := executor.Results{Items: []executor.Result{{Command: []string{"logread"}, Output: strings.Repeat("x", 2*maxOutputPerCommand)}}}
+	if got := BuildPrompt("q", big); !strings.Contains(got, "[output truncated]") || len(got) > 3*maxOutputPerCommand/2 {
+		t.Error("expected large output to be truncated")
+	}
+	// A two-byte rune straddles the cut.
+	wide := executor.Results{Items: []executor.Result{{Command: []string{"logread"}, Output: "x" + strings.Repeat("é", maxOutputPerCommand)}}}
+	if got := BuildPrompt("q", wide); !strings.Contains(got, "[output truncated]") || !utf8.ValidString(got) {
+		t.Error("expected truncated output to stay valid UTF-8")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	reply := `{"answer":"One device is connected.","table":{"columns":["host","ip","mac"],"rows":[["laptop","192.168.1.10"]]}}`
+	a, err := Summarize(context.Background(), fakeProvider{reply}, "which devices?", leases())
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if a.Answer != "One device is connected." {
+		t.Errorf("unexpected answer %q", a.Answer)
+	}
+	if a.Table == nil || len(a.Table.Rows[0]) != 3 {
+		t.Errorf("expected table rows padded to column count, got %+v", a.Table)
+	}
+}
+
+func TestSummarize_Errors(t *testing.T) {
+	if _, err := Summarize(context.Background(), fakeProvider{`{"answer":"x"}`}, "q", executor.Results{}); err == nil {
+		t.Error("expected error without results")
+	}
+	if _, err := Summarize(context.Background(), fakeProvider{`{"answer":"  "}`}, "q", leases()); err == nil {
+		t.Error("expected error for empty answer")
+	}
+	a, err := Summarize(context.Background(), fakeProvider{`{"answer":"ok","table":{"columns":[],"rows":[]}}`}, "q", leases())
+	if err != nil || a.Table != nil {
+		t.Errorf("expected empty table to be dropped, got %+v, %v", a.Table, err)
+	}
+}
+
+func TestSummarize_RedactsSecretReads(t *testing.T) {
+	inner := &promptRecorder{}
+	p := llm.WithRedaction(inner, redact.New(config.Config{}))
+	get := plan.PlannedCommand{Command: []string{"uci", "get", "wireless.default_radio0.key"}}
+	res := executor.Results{Items: []executor.Result{
+		{Index: 0, Command: get.Command, Step: get, Output: "hunter2hunter2\n"},
+		{Index: 1, Command: []string{"logread"}, Step: plan.PlannedCommand{Command: []string{"logread"}}, Output: "auth with hunter2hunter2 failed\n"},
+	}}
+	if _, err := Summarize(context.Background(), p, "what is the wifi key?", res); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.prompts) != 1 || strings.Contains(inner.prompts[0], "hunter2hunter2") {
+		t.Fatalf("secret sent to provider: %q", inner.prompts)
+	}
+	if res.Items[0].Output != "hunter2hunter2\n" {
+		t.Error("expected the results to be left unchanged")
+	}
+}
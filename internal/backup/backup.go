@@ -0,0 +1,417 @@
+// Package backup archives the OpenWrt configuration like "sysupgrade -b":
+// /etc/config and the files listed in /etc/sysupgrade.conf go into a
+// gzip-compressed tar, a rotating set of which is kept in a directory and
+// can be restored.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for an unknown backup ID.
+var ErrNotFound = errors.New("backup not found")
+
+// Backup describes one archive.
+type Backup struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	// Note says what the backup was taken for, e.g. the request.
+	Note  string   `json:"note,omitempty"`
+	Files []string `json:"files"`
+}
+
+// Store keeps backups as <id>.tar.gz files in a directory.
+type Store struct {
+	dir  string
+	keep int
+	// root is the filesystem the configuration is read from and restored to.
+	root string
+	now  func() time.Time
+}
+
+// NewStore returns a store in dir keeping the newest keep backups; keep 0
+// keeps all of them.
+func NewStore(dir string, keep int) *Store {
+	return &Store{dir: dir, keep: keep, root: "/", now: time.Now}
+}
+
+const suffix = ".tar.gz"
+
+var idRE = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}(-[0-9]+)?$`)
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+suffix)
+}
+
+// Paths returns the files to back up, relative to the root: everything in
+// etc/config, etc/sysupgrade.conf and the files and directories it lists.
+// The backup directory itself is skipped.
+func (s *Store) Paths() ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	add := func(abs string) error {
+		return filepath.WalkDir(filepath.Join(s.root, abs), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() && s.isBackupDir(p) {
+				return filepath.SkipDir
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(s.root, p)
+			if err != nil || seen[rel] {
+				return err
+			}
+			seen[rel] = true
+			out = append(out, rel)
+			return nil
+		})
+	}
+	if err := add("/etc/config"); err != nil {
+		return nil, err
+	}
+	if err := add("/etc/sysupgrade.conf"); err != nil {
+		return nil, err
+	}
+	if b, err := os.ReadFile(filepath.Join(s.root, "etc/sysupgrade.conf")); err == nil {
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") || !filepath.IsAbs(line) {
+				continue
+			}
+			if err := add(filepath.Clean(line)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// isBackupDir reports whether p is the backup directory, which sysupgrade.conf
+// may include through a parent.
+func (s *Store) isBackupDir(p string) bool {
+	dir, err := filepath.Abs(s.dir)
+	return err == nil && filepath.Clean(p) == dir
+}
+
+// Create writes a new backup and removes the oldest beyond the keep limit.
+func (s *Store) Create(note string) (Backup, error) {
+	files, err := s.Paths()
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return Backup{}, err
+	}
+	created := s.now().Truncate(time.Second)
+	id := created.Format("20060102-150405")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(s.path(id)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", created.Format("20060102-150405"), n)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".backup-*")
+	if err != nil {
+		return Backup{}, err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	zw.Comment, zw.ModTime = note, created
+	tw := tar.NewWriter(zw)
+	for _, rel := range files {
+		if err := addFile(tw, filepath.Join(s.root, rel), rel); err != nil {
+			tmp.Close()
+			return Backup{}, err
+		}
+	}
+	err = tw.Close()
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Chmod(0o600)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(id))
+	}
+	if err != nil {
+		return Backup{}, err
+	}
+	b := Backup{ID: id, Created: created, Note: note, Files: absolute(files)}
+	if st, err := os.Stat(s.path(id)); err == nil {
+		b.Size = st.Size()
+	}
+	return b, s.rotate()
+}
+
+func addFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(st, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func absolute(rel []string) []string {
+	out := make([]string, len(rel))
+	for i, r := range rel {
+		out[i] = "/" + filepath.ToSlash(r)
+	}
+	return out
+}
+
+// rotate removes the oldest backups beyond the keep limit.
+func (s *Store) rotate() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for len(ids) > s.keep {
+		if err := os.Remove(s.path(ids[len(ids)-1])); err != nil {
+			return err
+		}
+		ids = ids[:len(ids)-1]
+	}
+	return nil
+}
+
+// ids returns the backup IDs, newest first.
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), suffix)
+		if ok && idRE.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return idLess(ids[j], ids[i]) })
+	return ids, nil
+}
+
+// idLess orders IDs by time, then by their -n suffix.
+func idLess(a, b string) bool {
+	if a[:15] != b[:15] {
+		return a < b
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// List returns the backups, newest first.
+func (s *Store) List() ([]Backup, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	var out []Backup
+	for _, id := range ids {
+		b, err := s.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// Get returns the description of one backup.
+func (s *Store) Get(id string) (Backup, error) {
+	b := Backup{ID: id}
+	err := s.read(id, func(zr *gzip.Reader, hdr *tar.Header, _ []byte) error {
+		b.Created, b.Note = zr.ModTime, zr.Comment
+		if hdr != nil {
+			b.Files = append(b.Files, "/"+hdr.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return b, err
+	}
+	if st, err := os.Stat(s.path(id)); err == nil {
+		b.Size = st.Size()
+	}
+	return b, nil
+}
+
+// read calls fn for each regular file of a backup, or once with a nil
+// header for an empty one.
+func (s *Store) read(id string, fn func(zr *gzip.Reader, hdr *tar.Header, data []byte) error) error {
+	if !idRE.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == "." || strings.HasPrefix(name, "..") {
+			return fmt.Errorf("unsafe path %q in backup %s", hdr.Name, id)
+		}
+		hdr.Name = filepath.ToSlash(name)
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		found = true
+		if err := fn(zr, hdr, data); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fn(zr, nil, nil)
+	}
+	return nil
+}
+
+// Changes returns the files a restore of the backup would change.
+func (s *Store) Changes(id string) ([]string, error) {
+	var out []string
+	err := s.read(id, func(_ *gzip.Reader, hdr *tar.Header, data []byte) error {
+		if hdr != nil && s.differs(hdr.Name, data, hdr.FileInfo().Mode().Perm()) {
+			out = append(out, "/"+hdr.Name)
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *Store) differs(name string, data []byte, mode fs.FileMode) bool {
+	path := filepath.Join(s.root, name)
+	cur, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(cur, data) {
+		return true
+	}
+	st, err := os.Stat(path)
+	return err != nil || st.Mode().Perm() != mode
+}
+
+// Restore writes the files of a backup that differ from the current ones
+// back in place and returns their paths. Files added since the backup are
+// left alone, as with "sysupgrade -r". Before changing anything the current
+// configuration is saved as a new backup, returned as undo.
+func (s *Store) Restore(id string) (restored []string, undo Backup, err error) {
+	type file struct {
+		name string
+		data []byte
+		mode fs.FileMode
+	}
+	var files []file
+	err = s.read(id, func(_ *gzip.Reader, hdr *tar.Header, data []byte) error {
+		if hdr != nil {
+			mode := hdr.FileInfo().Mode().Perm()
+			if s.differs(hdr.Name, data, mode) {
+				files = append(files, file{hdr.Name, data, mode})
+			}
+		}
+		return nil
+	})
+	if err != nil || len(files) == 0 {
+		return nil, undo, err
+	}
+	// The archive is in memory now, so rotation may safely drop it.
+	if undo, err = s.Create("before restoring " + id); err != nil {
+		return nil, undo, fmt.Errorf("saving the current configuration: %w", err)
+	}
+	for _, f := range files {
+		if err := writeAtomic(filepath.Join(s.root, f.name), f.data, f.mode); err != nil {
+			return restored, undo, err
+		}
+		restored = append(restored, "/"+f.name)
+	}
+	return restored, undo, nil
+}
+
+func writeAtomic(path string, data []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T, keep int) (*Store, *time.Time) {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"etc/config/network":           "config interface 'lan'\n\toption ipaddr '192.168.1.1'\n",
+		"etc/config/firewall":          "config defaults\n",
+		"etc/sysupgrade.conf":          "## This file contains files and directories that should\n/etc/dropbear/\n/etc/lucicodex\n/etc/missing\n",
+		"etc/dropbear/authorized_keys": "ssh-ed25519 AAAA test\n",
+		"etc/lucicodex/config.json":    "{}\n",
+		"etc/passwd":                   "root:x:0:0::/root:/bin/ash\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewStore(filepath.Join(root, "etc/lucicodex/backups"), keep)
+	s.root = root
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestCreateList(t *testing.T) {
+	s, now := newTestStore(t, 3)
+	b, err := s.Create("set lan address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/etc/config/firewall", "/etc/config/network", "/etc/dropbear/authorized_keys", "/etc/lucicodex/config.json", "/etc/sysupgrade.conf"}
+	if b.ID != "20261019-120000" || !reflect.DeepEqual(b.Files, want) {
+		t.Errorf("backup %+v", b)
+	}
+	// The backup directory is inside a listed directory but not archived.
+	b2, err := s.Create("second")
+	if err != nil || b2.ID != "20261019-120000-2" || !reflect.DeepEqual(b2.Files, want) {
+		t.Fatalf("second backup %+v, %v", b2, err)
+	}
+	if st, _ := os.Stat(s.path(b.ID)); st.Mode().Perm() != 0o600 {
+		t.Errorf("backup mode %v", st.Mode().Perm())
+	}
+
+	for i := 0; i < 3; i++ {
+		*now = now.Add(time.Minute)
+		if _, err := s.Create(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, b := range list {
+		ids = append(ids, b.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"20261019-120300", "20261019-120200", "20261019-120100"}) {
+		t.Errorf("rotated ids %v", ids)
+	}
+	if !list[0].Created.Equal(*now) || list[0].Size == 0 || len(list[0].Files) != len(want) {
+		t.Errorf("listed %+v", list[0])
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s, now := newTestStore(t, 2)
+	b, err := s.Create("before change")
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := filepath.Join(s.root, "etc/config/network")
+	os.WriteFile(network, []byte("config interface 'lan'\n\toption ipaddr '10.0.0.1'\n"), 0o644)
+	os.Remove(filepath.Join(s.root, "etc/dropbear/authorized_keys"))
+	os.WriteFile(filepath.Join(s.root, "etc/config/wireless"), []byte("config wifi-device 'radio0'\n"), 0o644)
+
+	changes, err := s.Changes(b.ID)
+	if err != nil || !reflect.DeepEqual(changes, []string{"/etc/config/network", "/etc/dropbear/authorized_keys"}) {
+		t.Fatalf("changes %v, %v", changes, err)
+	}
+
+	// With keep=2 the undo backup would rotate the oldest out; restoring
+	// that very backup must still work.
+	*now = now.Add(time.Minute)
+	if _, err := s.Create("another"); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Minute)
+	restored, undo, err := s.Restore(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, changes) || undo.Note != "before restoring "+b.ID {
+		t.Errorf("restored %v, undo %+v", restored, undo)
+	}
+	if data, _ := os.ReadFile(network); string(data) != "config interface 'lan'\n\toption ipaddr '192.168.1.1'\n" {
+		t.Errorf("network not restored: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(s.root, "etc/config/wireless")); err != nil {
+		t.Error("files added after the backup must be kept")
+	}
+	if changes, _ := s.Changes(undo.ID); !reflect.DeepEqual(changes, []string{"/etc/config/network"}) {
+		t.Errorf("undo backup should hold the changed network: %v", changes)
+	}
+
+	restored, undo, err = s.Restore(undo.ID)
+	if err != nil || len(restored) != 1 {
+		t.Errorf("undo: %v %v", restored, err)
+	}
+	if _, _, err := s.Restore("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bad id: %v", err)
+	}
+	if _, _, err := s.Restore("20000101-000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing id: %v", err)
+	}
+}
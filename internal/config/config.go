@@ -20,7 +20,11 @@ type Config struct {
     AutoApprove    bool     `json:"auto_approve"`
     ConfirmEach    bool     `json:"confirm_each"`
     TimeoutSeconds int      `json:"timeout_seconds"`
+    // Seconds between SIGTERM and SIGKILL for a timed-out command's process group
+    KillGraceSeconds int `json:"kill_grace_seconds"`
     MaxCommands    int      `json:"max_commands"`
+    // Maximum steps run concurrently; 1 runs every step sequentially
+    MaxParallel int `json:"max_parallel"`
     Allowlist      []string `json:"allowlist"`
     Denylist       []string `json:"denylist"`
     LogFile        string   `json:"log_file"`
@@ -31,6 +35,65 @@ type Config struct {
     ExternalGeminiPath string `json:"external_gemini_path"`
     GoogleOAuthClientID string `json:"google_oauth_client_id"`
     GoogleOAuthClientSecret string `json:"google_oauth_client_secret"`
+    // Directory holding saved recipes (parameterized plans)
+    RecipesDir string `json:"recipes_dir"`
+    // Approximate token limit of the environment facts sent with a prompt
+    FactsTokenBudget int `json:"facts_token_budget"`
+    // File caching collected facts between invocations; empty disables it
+    FactsCacheFile string `json:"facts_cache_file"`
+    // Summarize command outputs into a direct answer after execution
+    AnswerMode bool `json:"answer_mode"`
+    // Checking of uci set/add_list values against option schemas: reject, warn or off
+    UCIValidation string `json:"uci_validation"`
+    // Back up /etc/config and sysupgrade.conf files before executing changes
+    Backup bool `json:"backup"`
+    // Directory of configuration backups and how many of them to keep
+    BackupDir string `json:"backup_dir"`
+    BackupKeep int `json:"backup_keep"`
+    // Reload the services of committed UCI packages the plan did not reload itself
+    AutoReload bool `json:"auto_reload"`
+    // Check reachability before and after plans that change network, wireless,
+    // firewall or dhcp, and roll the configuration back when a check regresses
+    Watchdog bool `json:"watchdog"`
+    // Hosts pinged by the watchdog, the name it resolves and the interface it
+    // expects up, and the seconds services get to settle before checking
+    WatchdogTargets []string `json:"watchdog_targets"`
+    WatchdogDNSName string `json:"watchdog_dns_name"`
+    WatchdogLAN string `json:"watchdog_lan"`
+    WatchdogDelaySeconds int `json:"watchdog_delay_seconds"`
+    // Free space in KiB that opkg install steps must leave on the overlay
+    OpkgMinFreeKB int `json:"opkg_min_free_kb"`
+    // Directories that planned commands may redirect stdout into
+    OutputDirs []string `json:"output_dirs"`
+    // Files or directories that write_file steps may replace
+    WritePaths []string `json:"write_paths"`
+    // Directory receiving backups of files replaced by write_file steps
+    WriteBackupDir string `json:"write_backup_dir"`
+    // Maximum bytes of stdout and of stderr kept per command
+    MaxOutputBytes int `json:"max_output_bytes"`
+    // Replace secrets with placeholders in prompts and the audit log
+    Redact bool `json:"redact"`
+    // Extra regular expressions; the first capture group (or the match) is redacted
+    RedactPatterns []string `json:"redact_patterns"`
+    // Run commands under the resource limits of internal/security
+    Sandbox bool `json:"sandbox"`
+    SandboxMemoryMB int `json:"sandbox_memory_mb"`
+    SandboxFileSizeMB int `json:"sandbox_file_size_mb"`
+    SandboxMaxProcs int `json:"sandbox_max_procs"`
+    SandboxMaxFiles int `json:"sandbox_max_files"`
+    SandboxCPUPercent int `json:"sandbox_cpu_percent"`
+    // Working, home and temporary directory of sandboxed commands; files
+    // older than an hour in it are removed
+    SandboxDir string `json:"sandbox_dir"`
+    // Run read-only commands isolated: own mount namespace, dropped credentials
+    Isolate bool `json:"isolate"`
+    IsolateUID int `json:"isolate_uid"`
+    IsolateGID int `json:"isolate_gid"`
+    IsolateSeccomp bool `json:"isolate_seccomp"`
+    // Seccomp profile with isolate_seccomp: "allowlist" or "denylist"
+    IsolateSeccompProfile string `json:"isolate_seccomp_profile"`
+    // Paths under /tmp that stay visible (read-only) in the private /tmp
+    IsolateKeepPaths []string `json:"isolate_keep_paths"`
 }
 
 func defaultConfig() Config {
@@ -42,7 +105,9 @@ func defaultConfig() Config {
         DryRun:         true,
         AutoApprove:    false,
         TimeoutSeconds: 30,
+        KillGraceSeconds: 2,
         MaxCommands:    10,
+        MaxParallel:    4,
         Allowlist: []string{
             `^uci(\s|$)`,
             `^ubus(\s|$)`,
@@ -57,6 +122,9 @@ func defaultConfig() Config {
             `^grep(\s|$)`,
             `^awk(\s|$)`,
             `^sed(\s|$)`,
+            // Watchdog probes, in exactly the form the watchdog runs them
+            `^ping -c 1 -W 2 [^-\s]\S*$`,
+            `^nslookup [^-\s]\S*$`,
         },
         Denylist: []string{
             `^rm\s+-rf\s+/`,
@@ -70,6 +138,31 @@ func defaultConfig() Config {
         OpenAIAPIKey: "",
         AnthropicAPIKey: "",
         ExternalGeminiPath: "/usr/bin/gemini",
+        RecipesDir: "/etc/lucicodex/recipes",
+        FactsTokenBudget: 2000,
+        FactsCacheFile: "/tmp/lucicodex.facts.json",
+        UCIValidation: "reject",
+        OpkgMinFreeKB: 1024,
+        AutoReload: true,
+        WatchdogTargets: []string{"1.1.1.1", "8.8.8.8"},
+        WatchdogDNSName: "openwrt.org",
+        WatchdogLAN: "lan",
+        WatchdogDelaySeconds: 5,
+        BackupDir: "/etc/lucicodex/backups",
+        BackupKeep: 5,
+        OutputDirs: []string{"/tmp/lucicodex"},
+        WritePaths: []string{"/etc/config", "/tmp/lucicodex"},
+        WriteBackupDir: "/tmp/lucicodex/backups",
+        MaxOutputBytes: 65536,
+        Redact: true,
+        SandboxMemoryMB: 128,
+        SandboxFileSizeMB: 10,
+        SandboxMaxFiles: 1024,
+        SandboxDir: "/tmp/lucicodex-sandbox",
+        IsolateUID: 65534,
+        IsolateGID: 65534,
+        IsolateSeccompProfile: "allowlist",
+        IsolateKeepPaths: []string{"/tmp/run", "/tmp/dhcp.leases", "/tmp/resolv.conf.d", "/tmp/sysinfo"},
     }
 }
 
@@ -134,11 +227,91 @@ func Load(path string) (Config, error) {
             cfg.TimeoutSeconds = t
         }
     }
+    if grace, _ := uciGet("lucicodex.@settings[0].kill_grace"); grace != "" {
+        if g, err := strconv.Atoi(grace); err == nil && g > 0 {
+            cfg.KillGraceSeconds = g
+        }
+    }
     if maxCmds, _ := uciGet("lucicodex.@settings[0].max_commands"); maxCmds != "" {
         if m, err := strconv.Atoi(maxCmds); err == nil && m > 0 {
             cfg.MaxCommands = m
         }
     }
+    if parallel, _ := uciGet("lucicodex.@settings[0].max_parallel"); parallel != "" {
+        if n, err := strconv.Atoi(parallel); err == nil && n > 0 {
+            cfg.MaxParallel = n
+        }
+    }
+    if answerMode, _ := uciGet("lucicodex.@settings[0].answer_mode"); answerMode == "1" {
+        cfg.AnswerMode = true
+    } else if answerMode == "0" {
+        cfg.AnswerMode = false
+    }
+    if redact, _ := uciGet("lucicodex.@settings[0].redact"); redact == "1" {
+        cfg.Redact = true
+    } else if redact == "0" {
+        cfg.Redact = false
+    }
+    if sandbox, _ := uciGet("lucicodex.@settings[0].sandbox"); sandbox == "1" {
+        cfg.Sandbox = true
+    } else if sandbox == "0" {
+        cfg.Sandbox = false
+    }
+    if isolate, _ := uciGet("lucicodex.@settings[0].isolate"); isolate == "1" {
+        cfg.Isolate = true
+    } else if isolate == "0" {
+        cfg.Isolate = false
+    }
+    if mem, _ := uciGet("lucicodex.@settings[0].sandbox_memory_mb"); mem != "" {
+        if m, err := strconv.Atoi(mem); err == nil && m >= 0 {
+            cfg.SandboxMemoryMB = m
+        }
+    }
+    if dir, _ := uciGet("lucicodex.@settings[0].sandbox_dir"); dir != "" {
+        cfg.SandboxDir = dir
+    }
+    if factsCache, _ := uciGet("lucicodex.@settings[0].facts_cache"); factsCache != "" {
+        cfg.FactsCacheFile = factsCache
+    }
+    if b, _ := uciGet("lucicodex.@settings[0].backup"); b != "" {
+        cfg.Backup = b == "1"
+    }
+    if dir, _ := uciGet("lucicodex.@settings[0].backup_dir"); dir != "" {
+        cfg.BackupDir = dir
+    }
+    if keep, _ := uciGet("lucicodex.@settings[0].backup_keep"); keep != "" {
+        if k, err := strconv.Atoi(keep); err == nil && k >= 0 {
+            cfg.BackupKeep = k
+        }
+    }
+    if reload, _ := uciGet("lucicodex.@settings[0].auto_reload"); reload != "" {
+        cfg.AutoReload = reload == "1"
+    }
+    if w, _ := uciGet("lucicodex.@settings[0].watchdog"); w != "" {
+        cfg.Watchdog = w == "1"
+    }
+    if targets, _ := uciGet("lucicodex.@settings[0].watchdog_target"); targets != "" {
+        cfg.WatchdogTargets = strings.Fields(targets)
+    }
+    if name, _ := uciGet("lucicodex.@settings[0].watchdog_dns"); name != "" {
+        cfg.WatchdogDNSName = name
+    }
+    if lan, _ := uciGet("lucicodex.@settings[0].watchdog_lan"); lan != "" {
+        cfg.WatchdogLAN = lan
+    }
+    if delay, _ := uciGet("lucicodex.@settings[0].watchdog_delay"); delay != "" {
+        if d, err := strconv.Atoi(delay); err == nil && d >= 0 {
+            cfg.WatchdogDelaySeconds = d
+        }
+    }
+    if minFree, _ := uciGet("lucicodex.@settings[0].opkg_min_free"); minFree != "" {
+        if m, err := strconv.Atoi(minFree); err == nil && m >= 0 {
+            cfg.OpkgMinFreeKB = m
+        }
+    }
+    if validation, _ := uciGet("lucicodex.@settings[0].uci_validation"); validation != "" {
+        cfg.UCIValidation = validation
+    }
     if logFile, _ := uciGet("lucicodex.@settings[0].log_file"); logFile != "" {
         cfg.LogFile = logFile
     }
@@ -170,6 +343,9 @@ func Load(path string) (Config, error) {
     if v := strings.TrimSpace(os.Getenv("LUCICODEX_EXTERNAL_GEMINI")); v != "" {
         cfg.ExternalGeminiPath = v
     }
+    if v := strings.TrimSpace(os.Getenv("LUCICODEX_RECIPES_DIR")); v != "" {
+        cfg.RecipesDir = v
+    }
     if v := strings.TrimSpace(os.Getenv("LUCICODEX_CONFIRM_EACH")); v != "" {
         cfg.ConfirmEach = v == "1" || strings.ToLower(v) == "true"
     }
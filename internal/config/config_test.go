@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 )
 
@@ -39,6 +40,27 @@ func TestDefaultConfig(t *testing.T) {
 	}
 }
 
+func TestDefaultAllowlist_WatchdogProbes(t *testing.T) {
+	allowed := func(cmdline string) bool {
+		for _, p := range defaultConfig().Allowlist {
+			if regexp.MustCompile(p).MatchString(cmdline) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range []string{"ping -c 1 -W 2 1.1.1.1", "nslookup openwrt.org", "ip route show default", "ifstatus lan"} {
+		if !allowed(c) {
+			t.Errorf("expected %q to be allowed", c)
+		}
+	}
+	for _, c := range []string{"ping 1.1.1.1", "ping -c 1 -W 2 -f 1.1.1.1", "ping -c 1 -W 2 1.1.1.1 -s 65000", "nslookup -type=any openwrt.org", "nslookup openwrt.org 192.0.2.1"} {
+		if allowed(c) {
+			t.Errorf("expected %q not to be allowed", c)
+		}
+	}
+}
+
 func TestLoadWithEnvVars(t *testing.T) {
     os.Setenv("GEMINI_API_KEY", "test-key-123")
     os.Setenv("LUCICODEX_MODEL", "gemini-pro")
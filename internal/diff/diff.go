@@ -0,0 +1,196 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTrace bounds the memory used by the Myers search. Larger inputs fall back
+// to a whole-file replacement, which is still a valid (if verbose) diff.
+const maxTrace = 4 << 20
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	text string
+}
+
+// Unified returns a unified diff of a and b with the given number of context
+// lines, or "" when the inputs are identical.
+func Unified(aName, bName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	al, bl := splitLines(a), splitLines(b)
+	ops := lineOps(al, bl)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	// positions[i] holds the a/b line offsets before ops[i].
+	type pos struct{ a, b int }
+	positions := make([]pos, len(ops)+1)
+	for i, o := range ops {
+		p := positions[i]
+		switch o.kind {
+		case opEqual:
+			p.a++
+			p.b++
+		case opDelete:
+			p.a++
+		case opInsert:
+			p.b++
+		}
+		positions[i+1] = p
+	}
+
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk while changes are within 2*context of each other.
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+
+		aStart, bStart := positions[start].a, positions[start].b
+		aCount := positions[end].a - aStart
+		bCount := positions[end].b - bStart
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, o := range ops[start:end] {
+			out.WriteByte(byte(o.kind))
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineOps computes a shortest edit script using the Myers algorithm.
+func lineOps(a, b []string) []op {
+	n, m := len(a), len(b)
+	maxD := n + m
+	off := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= maxD; d++ {
+		if (d+1)*len(v) > maxTrace {
+			return replaceAll(a, b)
+		}
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var rev []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[off+k-1] < vd[off+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[off+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, op{opEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			rev = append(rev, op{opInsert, b[y-1]})
+			y--
+		} else {
+			rev = append(rev, op{opDelete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, op{opEqual, a[x-1]})
+		x--
+		y--
+	}
+
+	ops := make([]op, len(rev))
+	for i := range rev {
+		ops[i] = rev[len(rev)-1-i]
+	}
+	return ops
+}
+
+func replaceAll(a, b []string) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for _, l := range a {
+		ops = append(ops, op{opDelete, l})
+	}
+	for _, l := range b {
+		ops = append(ops, op{opInsert, l})
+	}
+	return ops
+}
@@ -0,0 +1,46 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified_Identical(t *testing.T) {
+	if got := Unified("a", "b", "x\ny\n", "x\ny\n", 3); got != "" {
+		t.Fatalf("expected empty diff, got %q", got)
+	}
+}
+
+func TestUnified_Change(t *testing.T) {
+	a := "config interface 'lan'\n\toption proto 'static'\n\toption ipaddr '192.168.1.1'\n\toption netmask '255.255.255.0'\n"
+	b := "config interface 'lan'\n\toption proto 'static'\n\toption ipaddr '192.168.2.1'\n\toption netmask '255.255.255.0'\n"
+	want := "--- a/network\n+++ b/network\n@@ -2,3 +2,3 @@\n" +
+		" \toption proto 'static'\n" +
+		"-\toption ipaddr '192.168.1.1'\n" +
+		"+\toption ipaddr '192.168.2.1'\n" +
+		" \toption netmask '255.255.255.0'\n"
+	if got := Unified("a/network", "b/network", a, b, 1); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_Insert(t *testing.T) {
+	got := Unified("a", "b", "", "one\ntwo\n", 3)
+	if !strings.Contains(got, "@@ -0,0 +1,2 @@\n+one\n+two\n") {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, "line")
+		b = append(b, "line")
+	}
+	a[2], b[2] = "old1", "new1"
+	a[17], b[17] = "old2", "new2"
+	got := Unified("a", "b", strings.Join(a, "\n"), strings.Join(b, "\n"), 2)
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("expected 2 hunks, got %d:\n%s", n, got)
+	}
+}
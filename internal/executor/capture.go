@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// DefaultMaxOutputBytes caps each captured stream when cfg.MaxOutputBytes is
+// not set.
+const DefaultMaxOutputBytes = 64 << 10
+
+// cappedBuffer keeps at most limit bytes and records whether more was written.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) write(p []byte) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return
+	}
+	b.buf.Write(p)
+}
+
+// capture collects stdout and stderr separately and interleaved, each capped.
+// Writes never fail, so a chatty command is not killed by EPIPE once the cap
+// is reached.
+type capture struct {
+	mu                     sync.Mutex
+	stdout, stderr, merged cappedBuffer
+}
+
+func newCapture(limit int) *capture {
+	if limit <= 0 {
+		limit = DefaultMaxOutputBytes
+	}
+	c := &capture{}
+	c.stdout.limit, c.stderr.limit, c.merged.limit = limit, limit, limit
+	return c
+}
+
+type captureWriter struct {
+	c   *capture
+	buf *cappedBuffer
+}
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	w.buf.write(p)
+	w.c.merged.write(p)
+	return len(p), nil
+}
+
+func (c *capture) Stdout() io.Writer { return captureWriter{c, &c.stdout} }
+func (c *capture) Stderr() io.Writer { return captureWriter{c, &c.stderr} }
+
+// fill copies the captured streams into r.
+func (c *capture) fill(r *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.Stdout, r.Stderr, r.Output = c.stdout.buf.String(), c.stderr.buf.String(), c.merged.buf.String()
+	r.StdoutTruncated, r.StderrTruncated = c.stdout.truncated, c.stderr.truncated
+}
+
+// exitStatus returns the exit code and terminating signal of a waited
+// command. The code is -1 when it never started or was killed by a signal.
+func exitStatus(state *os.ProcessState) (int, string) {
+	if state == nil {
+		return -1, ""
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, ws.Signal().String()
+	}
+	return state.ExitCode(), ""
+}
@@ -2,45 +2,153 @@ package executor
 
 import (
     "context"
+    "encoding/json"
     "errors"
     "fmt"
     "os"
     "os/exec"
     "strings"
+    "sync"
     "syscall"
     "time"
 
     "github.com/aezizhu/LuciCodex/internal/config"
     "github.com/aezizhu/LuciCodex/internal/plan"
+    "github.com/aezizhu/LuciCodex/internal/policy"
+    "github.com/aezizhu/LuciCodex/internal/security"
 )
 
 type Result struct {
     Index   int
     Command []string
+    // Step is the planned command, kept for display.
+    Step    plan.PlannedCommand
+    // Output interleaves stdout and stderr in arrival order.
     Output  string
+    Stdout  string
+    Stderr  string
+    // ExitCode is -1 when the command did not start or was killed by Signal.
+    ExitCode int
+    Signal   string
+    // StdoutTruncated and StderrTruncated report output beyond cfg.MaxOutputBytes.
+    StdoutTruncated bool
+    StderrTruncated bool
+    // TimedOut is set when the command was terminated at its deadline.
+    TimedOut bool
+    // Warnings are notes of the opkg pre-flight about the step.
+    Warnings []string
+    // Auto marks a step appended by the executor rather than planned, such
+    // as an automatic service reload.
+    Auto bool
     Err     error
     Elapsed time.Duration
 }
 
+// resultJSON is the stable JSON shape of a Result.
+type resultJSON struct {
+    Index           int                 `json:"index"`
+    Command         []string            `json:"command,omitempty"`
+    Step            plan.PlannedCommand `json:"step"`
+    ExitCode        int                 `json:"exit_code"`
+    Signal          string              `json:"signal,omitempty"`
+    Stdout          string              `json:"stdout"`
+    Stderr          string              `json:"stderr"`
+    StdoutTruncated bool                `json:"stdout_truncated"`
+    StderrTruncated bool                `json:"stderr_truncated"`
+    TimedOut        bool                `json:"timed_out"`
+    Warnings        []string            `json:"warnings,omitempty"`
+    Auto            bool                `json:"auto,omitempty"`
+    Error           string              `json:"error,omitempty"`
+    ElapsedMS       int64               `json:"elapsed_ms"`
+}
+
+// MarshalJSON encodes the error as its message and the duration in milliseconds.
+func (r Result) MarshalJSON() ([]byte, error) {
+    j := resultJSON{
+        Index:           r.Index,
+        Command:         r.Command,
+        Step:            r.Step,
+        ExitCode:        r.ExitCode,
+        Signal:          r.Signal,
+        Stdout:          r.Stdout,
+        Stderr:          r.Stderr,
+        StdoutTruncated: r.StdoutTruncated,
+        StderrTruncated: r.StderrTruncated,
+        TimedOut:        r.TimedOut,
+        Warnings:        r.Warnings,
+        Auto:            r.Auto,
+        ElapsedMS:       r.Elapsed.Milliseconds(),
+    }
+    if r.Err != nil {
+        j.Error = r.Err.Error()
+    }
+    return json.Marshal(j)
+}
+
 type Results struct {
-    Items  []Result
-    Failed int
+    Items  []Result `json:"items"`
+    Failed int      `json:"failed"`
+    // Watchdog holds the connectivity checks after the plan, if it was watched.
+    Watchdog *WatchdogReport `json:"watchdog,omitempty"`
 }
 
 type Engine struct {
     cfg config.Config
+    // sandbox enforces resource limits when cfg.Sandbox is set
+    sandbox *security.Sandbox
+    // isolation runs read-only commands isolated when cfg.Isolate is set;
+    // isolationErr is reported for such commands if it cannot be set up.
+    isolation    *security.Isolation
+    isolationErr error
+    readOnly     func(plan.PlannedCommand) bool
+    // policy validates steps the executor appends to a plan
+    policy *policy.Engine
+    // opkg backs the pre-flight of opkg install/remove steps
+    opkg opkgSystem
 }
 
-func New(cfg config.Config) *Engine { return &Engine{cfg: cfg} }
+func New(cfg config.Config) *Engine {
+    pol := policy.New(cfg)
+    e := &Engine{cfg: cfg, readOnly: pol.ReadOnly, policy: pol, opkg: deviceOpkg{}}
+    if cfg.Sandbox {
+        e.sandbox = security.NewSandbox(cfg)
+    }
+    if cfg.Isolate {
+        e.isolation, e.isolationErr = security.NewIsolation(cfg)
+    }
+    return e
+}
+
+// isolated reports whether pc runs under the isolation profile. Commands
+// needing root are never isolated.
+func (e *Engine) isolated(pc plan.PlannedCommand) bool {
+    return e.cfg.Isolate && !pc.NeedsRoot && !pc.NoIsolate && e.readOnly(pc)
+}
 
+// RunPlan executes the plan's steps in order. Consecutive steps that are
+// independent or read-only run concurrently, up to cfg.MaxParallel at a
+// time; results keep the plan order either way.
 func (e *Engine) RunPlan(ctx context.Context, p plan.Plan) Results {
-    results := Results{}
-    for i, pc := range p.Commands {
-        r := e.runOne(ctx, i, pc)
+    results := Results{Items: make([]Result, len(p.Commands))}
+    for i := 0; i < len(p.Commands); {
+        j := i + 1
+        if e.concurrent(p.Commands[i]) {
+            for j < len(p.Commands) && e.concurrent(p.Commands[j]) {
+                j++
+            }
+        }
+        e.runBatch(ctx, i, p.Commands[i:j], results.Items[i:j])
+        i = j
+    }
+    if e.cfg.AutoReload {
+        for k, pc := range e.ReloadSteps(p, results.Items) {
+            results.Items = append(results.Items, e.RunAuto(ctx, len(p.Commands)+k, pc))
+        }
+    }
+    for _, r := range results.Items {
         if r.Err != nil {
             results.Failed++
         }
-        results.Items = append(results.Items, r)
     }
     return results
 }
@@ -52,9 +160,19 @@ func (e *Engine) RunCommand(ctx context.Context, index int, pc plan.PlannedComma
 
 func (e *Engine) runOne(ctx context.Context, index int, pc plan.PlannedCommand) Result {
     start := time.Now()
-    r := Result{Index: index, Command: pc.Command}
+    r := Result{Index: index, Command: pc.Command, Step: pc}
+    if pc.IsWrite() {
+        r.Output, r.Err = e.writeFile(*pc.WriteFile)
+        r.Stdout = r.Output
+        if r.Err != nil {
+            r.ExitCode = -1
+        }
+        r.Elapsed = time.Since(start)
+        return r
+    }
     if len(pc.Command) == 0 {
         r.Err = errors.New("empty command")
+        r.ExitCode = -1
         return r
     }
     // Set a timeout per command
@@ -64,31 +182,101 @@ func (e *Engine) runOne(ctx context.Context, index int, pc plan.PlannedCommand)
     }
     cctx, cancel := context.WithTimeout(ctx, timeout)
     defer cancel()
+
+    var err error
+    // The pre-flight queries count against the step's timeout.
+    if r.Warnings, err = e.preflight(cctx, pc); err != nil {
+        r.Err = err
+        r.Stderr, r.Output = err.Error()+"\n", err.Error()+"\n"
+        r.ExitCode = -1
+        r.Elapsed = time.Since(start)
+        return r
+    }
+    if e.isolated(pc) && e.isolationErr != nil {
+        r.Err = fmt.Errorf("isolation unavailable: %w", e.isolationErr)
+        r.ExitCode = -1
+        r.Elapsed = time.Since(start)
+        return r
+    }
+    out := newCapture(e.cfg.MaxOutputBytes)
+    if len(pc.Pipeline) > 0 || pc.StdoutFile != "" {
+        r.ExitCode, r.Signal, r.Err = e.runPipeline(cctx, pc, out)
+    } else {
+        r.ExitCode, r.Signal, r.Err = e.runSingle(cctx, pc, out)
+    }
+    out.fill(&r)
+    if r.Err != nil && errors.Is(cctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+        r.TimedOut = true
+        r.Err = fmt.Errorf("timed out after %s: %w", timeout, r.Err)
+    }
+    r.Elapsed = time.Since(start)
+    return r
+}
+
+// runSingle executes a command without pipeline or redirection.
+func (e *Engine) runSingle(ctx context.Context, pc plan.PlannedCommand, out *capture) (int, string, error) {
+    cmd, stopKill, err := e.buildCmd(ctx, pc.Command, pc.NeedsRoot, e.isolated(pc))
+    if err != nil {
+        return -1, "", err
+    }
+    defer stopKill()
+    if pc.Stdin != "" {
+        cmd.Stdin = strings.NewReader(pc.Stdin)
+    }
+    cmd.Stdout, cmd.Stderr = out.Stdout(), out.Stderr()
+    wait, err := e.start(ctx, cmd)
+    if err == nil {
+        err = wait()
+    }
+    code, sig := exitStatus(cmd.ProcessState)
+    return code, sig, err
+}
+
+// start launches cmd, under a sandbox monitor when enabled, and returns the
+// function that waits for it.
+func (e *Engine) start(ctx context.Context, cmd *exec.Cmd) (func() error, error) {
+    if e.sandbox == nil {
+        return cmd.Wait, cmd.Start()
+    }
+    limits := e.sandbox.Limits()
+    // The context deadline handles timeouts, with a grace period.
+    limits.MaxExecutionTime = 0
+    m := security.NewMonitor(cmd, limits)
+    return m.Wait, m.Start(ctx)
+}
+
+// buildCmd prepares argv for execution without a shell, optionally through
+// the isolation helper. stopKill must be called once the command has been
+// waited for; see commandWithContext.
+func (e *Engine) buildCmd(ctx context.Context, argv []string, needsRoot, isolate bool) (cmd *exec.Cmd, stopKill func(), err error) {
     // No shell; exec argv directly. Optionally prefix with elevation tool.
-    argv := pc.Command
-    if pc.NeedsRoot && strings.TrimSpace(e.cfg.ElevateCommand) != "" {
+    if needsRoot && strings.TrimSpace(e.cfg.ElevateCommand) != "" {
         // Split elevate command into tokens (simple whitespace split; avoid shell features)
         elev := fieldsSafe(e.cfg.ElevateCommand)
         if len(elev) > 0 {
             argv = append(elev, argv...)
         }
     }
-    var cmd *exec.Cmd
     if len(argv) == 1 {
-        cmd = exec.CommandContext(cctx, argv[0])
+        cmd = exec.CommandContext(ctx, argv[0])
     } else {
-        cmd = exec.CommandContext(cctx, argv[0], argv[1:]...)
+        cmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
     }
     // Drop env except PATH
     cmd.Env = minimalEnv()
-    // Ensure hard kill on deadline
-    cmd = commandWithContext(cctx, cmd)
-
-    out, err := cmd.CombinedOutput()
-    r.Output = string(out)
-    r.Err = err
-    r.Elapsed = time.Since(start)
-    return r
+    if e.sandbox != nil {
+        if err := e.sandbox.Apply(cmd); err != nil {
+            return nil, nil, err
+        }
+    }
+    if isolate && e.isolation != nil {
+        if err := e.isolation.Apply(cmd); err != nil {
+            return nil, nil, err
+        }
+    }
+    // Terminate the whole process group on deadline
+    cmd, stopKill = commandWithContext(cmd, e.killGrace())
+    return cmd, stopKill, nil
 }
 
 func minimalEnv() []string {
@@ -99,18 +287,72 @@ func minimalEnv() []string {
     return []string{"PATH=" + path}
 }
 
-// commandWithContext ensures the process receives SIGKILL on context deadline.
-func commandWithContext(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
-    go func() {
-        <-ctx.Done()
-        if ctx.Err() != nil && cmd.Process != nil {
-            // Try SIGTERM then SIGKILL
-            _ = cmd.Process.Signal(syscall.SIGTERM)
-            time.Sleep(500 * time.Millisecond)
-            _ = cmd.Process.Kill()
+// commandWithContext puts cmd in its own process group. When the command's
+// context is done the whole group gets SIGTERM and, after grace, SIGKILL, so
+// grandchildren such as daemons started by init scripts do not survive a
+// timeout. The returned stopKill cancels a pending SIGKILL and must be called
+// once cmd has been waited for: after the leader is reaped its pid, and with
+// it the group id, can be reused by an unrelated process.
+func commandWithContext(cmd *exec.Cmd, grace time.Duration) (*exec.Cmd, func()) {
+    if cmd.SysProcAttr == nil {
+        cmd.SysProcAttr = &syscall.SysProcAttr{}
+    }
+    cmd.SysProcAttr.Setpgid = true
+    var (
+        mu      sync.Mutex
+        kill    *time.Timer
+        stopped bool
+    )
+    cmd.Cancel = func() error {
+        pgid := cmd.Process.Pid
+        mu.Lock()
+        if !stopped {
+            kill = time.AfterFunc(grace, func() { _ = syscall.Kill(-pgid, syscall.SIGKILL) })
+        }
+        mu.Unlock()
+        if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+            return err
+        }
+        return nil
+    }
+    // Do not wait forever on output pipes held by processes that left the group.
+    cmd.WaitDelay = grace + time.Second
+    return cmd, func() {
+        mu.Lock()
+        defer mu.Unlock()
+        stopped = true
+        if kill != nil {
+            kill.Stop()
         }
-    }()
-    return cmd
+    }
+}
+
+// killGrace is the delay between SIGTERM and SIGKILL on timeout.
+func (e *Engine) killGrace() time.Duration {
+    if e.cfg.KillGraceSeconds > 0 {
+        return time.Duration(e.cfg.KillGraceSeconds) * time.Second
+    }
+    return 2 * time.Second
+}
+
+// FormatStep renders a planned command including pipeline stages,
+// redirection and payloads, for display only.
+func FormatStep(pc plan.PlannedCommand) string {
+    if pc.IsWrite() {
+        return fmt.Sprintf("write_file %s (%d bytes)", FormatCommand([]string{pc.WriteFile.Path}), len(pc.WriteFile.Content))
+    }
+    parts := []string{FormatCommand(pc.Command)}
+    for _, st := range pc.Pipeline {
+        parts = append(parts, FormatCommand(st))
+    }
+    s := strings.Join(parts, " | ")
+    if pc.Stdin != "" {
+        s += fmt.Sprintf(" < stdin (%d bytes)", len(pc.Stdin))
+    }
+    if pc.StdoutFile != "" {
+        s += " > " + FormatCommand([]string{pc.StdoutFile})
+    }
+    return s
 }
 
 // FormatCommand returns a shell-like string for logging only (no execution).
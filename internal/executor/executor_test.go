@@ -1,6 +1,31 @@
 package executor
 
-import "testing"
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+
+    "github.com/aezizhu/LuciCodex/internal/config"
+    "github.com/aezizhu/LuciCodex/internal/plan"
+    "github.com/aezizhu/LuciCodex/internal/security"
+)
+
+// TestMain lets the test binary act as the isolation helper, like main does.
+func TestMain(m *testing.M) {
+    if len(os.Args) > 1 && os.Args[1] == security.IsolateArg {
+        os.Exit(security.IsolateMain(os.Args[2:]))
+    }
+    os.Exit(m.Run())
+}
 
 func TestFormatCommand(t *testing.T) {
     got := FormatCommand([]string{"echo", "hello world", "a&b"})
@@ -13,3 +38,329 @@ func TestFormatCommand(t *testing.T) {
 }
 
 
+
+func TestFormatStep(t *testing.T) {
+    got := FormatStep(plan.PlannedCommand{Command: []string{"logread"}, Pipeline: [][]string{{"grep", "-i", "dhcp lease"}}, StdoutFile: "/tmp/lucicodex/out.txt"})
+    want := `logread | grep -i "dhcp lease" > /tmp/lucicodex/out.txt`
+    if got != want {
+        t.Fatalf("expected %q, got %q", want, got)
+    }
+    got = FormatStep(plan.PlannedCommand{Command: []string{"uci", "batch"}, Stdin: "set x.a=b\n"})
+    if want := "uci batch < stdin (10 bytes)"; got != want {
+        t.Fatalf("expected %q, got %q", want, got)
+    }
+    got = FormatStep(plan.PlannedCommand{WriteFile: &plan.WriteFile{Path: "/etc/config/x", Content: "abc"}})
+    if want := "write_file /etc/config/x (3 bytes)"; got != want {
+        t.Fatalf("expected %q, got %q", want, got)
+    }
+}
+
+func TestRunCommand_Pipeline(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 5})
+    pc := plan.PlannedCommand{
+        Command:  []string{"printf", "wan\nlan\nguest\n"},
+        Pipeline: [][]string{{"grep", "an"}, {"tr", "a-z", "A-Z"}},
+    }
+    r := e.RunCommand(context.Background(), 0, pc)
+    if r.Err != nil {
+        t.Fatalf("pipeline failed: %v (%s)", r.Err, r.Output)
+    }
+    if r.Output != "WAN\nLAN\n" {
+        t.Fatalf("unexpected output %q", r.Output)
+    }
+}
+
+func TestRunCommand_PipelineFailure(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 5})
+    pc := plan.PlannedCommand{
+        Command:  []string{"printf", "x\n"},
+        Pipeline: [][]string{{"grep", "nomatch"}, {"cat"}},
+    }
+    r := e.RunCommand(context.Background(), 0, pc)
+    if r.Err == nil || !strings.Contains(r.Err.Error(), "stage 1") {
+        t.Fatalf("expected stage 1 failure, got %v", r.Err)
+    }
+
+    pc = plan.PlannedCommand{Command: []string{"printf", "x"}, Pipeline: [][]string{{"/nonexistent/bin"}}}
+    if r := e.RunCommand(context.Background(), 0, pc); r.Err == nil {
+        t.Fatal("expected start failure")
+    }
+}
+
+func TestRunCommand_StdoutFile(t *testing.T) {
+    dir := t.TempDir()
+    e := New(config.Config{TimeoutSeconds: 5})
+    out := filepath.Join(dir, "sub", "out.txt")
+    pc := plan.PlannedCommand{Command: []string{"printf", "hello"}, StdoutFile: out}
+    r := e.RunCommand(context.Background(), 0, pc)
+    if r.Err != nil {
+        t.Fatalf("redirect failed: %v", r.Err)
+    }
+    if b, _ := os.ReadFile(out); string(b) != "hello" {
+        t.Fatalf("unexpected file content %q", b)
+    }
+    if r.Output != "" {
+        t.Errorf("expected no captured output, got %q", r.Output)
+    }
+
+    link := filepath.Join(dir, "link")
+    if err := os.Symlink(filepath.Join(dir, "sub"), link); err != nil {
+        t.Fatal(err)
+    }
+    pc.StdoutFile = filepath.Join(link, "out.txt")
+    if r := e.RunCommand(context.Background(), 0, pc); r.Err == nil {
+        t.Fatal("expected error for symlinked output directory")
+    }
+}
+
+func TestRunCommand_Stdin(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 5})
+    r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"cat"}, Stdin: "{\"a\":1}"})
+    if r.Err != nil || r.Output != `{"a":1}` {
+        t.Fatalf("unexpected result %q, %v", r.Output, r.Err)
+    }
+    pc := plan.PlannedCommand{Command: []string{"cat"}, Pipeline: [][]string{{"tr", "a-z", "A-Z"}}, Stdin: "lan\n"}
+    if r := e.RunCommand(context.Background(), 0, pc); r.Err != nil || r.Output != "LAN\n" {
+        t.Fatalf("unexpected pipeline result %q, %v", r.Output, r.Err)
+    }
+}
+
+func TestRunCommand_WriteFile(t *testing.T) {
+    dir := t.TempDir()
+    backups := filepath.Join(dir, "backups")
+    e := New(config.Config{WriteBackupDir: backups})
+    target := filepath.Join(dir, "network")
+    if err := os.WriteFile(target, []byte("old\n"), 0o640); err != nil {
+        t.Fatal(err)
+    }
+
+    pc := plan.PlannedCommand{WriteFile: &plan.WriteFile{Path: target, Content: "new\n", Backup: true}}
+    r := e.RunCommand(context.Background(), 0, pc)
+    if r.Err != nil {
+        t.Fatalf("write failed: %v", r.Err)
+    }
+    if b, _ := os.ReadFile(target); string(b) != "new\n" {
+        t.Fatalf("unexpected content %q", b)
+    }
+    if fi, _ := os.Stat(target); fi.Mode().Perm() != 0o640 {
+        t.Errorf("expected existing mode to be kept, got %v", fi.Mode().Perm())
+    }
+    entries, _ := os.ReadDir(backups)
+    if len(entries) != 1 {
+        t.Fatalf("expected one backup, got %d", len(entries))
+    }
+    if b, _ := os.ReadFile(filepath.Join(backups, entries[0].Name())); string(b) != "old\n" {
+        t.Errorf("unexpected backup content %q", b)
+    }
+    if left, _ := filepath.Glob(filepath.Join(dir, ".network.tmp-*")); len(left) != 0 {
+        t.Errorf("temporary files left behind: %v", left)
+    }
+
+    pc.WriteFile = &plan.WriteFile{Path: filepath.Join(dir, "new.json"), Content: "{}", Mode: "0644"}
+    if r := e.RunCommand(context.Background(), 0, pc); r.Err != nil {
+        t.Fatalf("write failed: %v", r.Err)
+    }
+    if fi, _ := os.Stat(pc.WriteFile.Path); fi.Mode().Perm() != 0o644 {
+        t.Errorf("expected mode 0644, got %v", fi.Mode().Perm())
+    }
+
+    link := filepath.Join(dir, "link")
+    if err := os.Symlink(target, link); err != nil {
+        t.Fatal(err)
+    }
+    pc.WriteFile = &plan.WriteFile{Path: link, Content: "x"}
+    if r := e.RunCommand(context.Background(), 0, pc); r.Err == nil {
+        t.Fatal("expected error when the target is a symlink")
+    }
+}
+
+func TestRunCommand_ExitStatus(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 5})
+    r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "echo out; echo err >&2; exit 3"}})
+    if r.Err == nil || r.ExitCode != 3 || r.Signal != "" {
+        t.Fatalf("expected exit 3, got %d %q %v", r.ExitCode, r.Signal, r.Err)
+    }
+    if r.Stdout != "out\n" || r.Stderr != "err\n" || !strings.Contains(r.Output, "out") || !strings.Contains(r.Output, "err") {
+        t.Fatalf("unexpected streams: stdout=%q stderr=%q output=%q", r.Stdout, r.Stderr, r.Output)
+    }
+
+    r = e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "kill -9 $$"}})
+    if r.ExitCode != -1 || r.Signal != "killed" {
+        t.Fatalf("expected SIGKILL, got %d %q", r.ExitCode, r.Signal)
+    }
+
+    r = e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"/nonexistent/bin"}})
+    if r.Err == nil || r.ExitCode != -1 {
+        t.Fatalf("expected start failure with exit code -1, got %d %v", r.ExitCode, r.Err)
+    }
+
+    pc := plan.PlannedCommand{Command: []string{"printf", "x\n"}, Pipeline: [][]string{{"sh", "-c", "cat; exit 2"}, {"cat"}}}
+    if r := e.RunCommand(context.Background(), 0, pc); r.ExitCode != 2 {
+        t.Fatalf("expected pipeline exit 2, got %d %v", r.ExitCode, r.Err)
+    }
+}
+
+func TestRunCommand_OutputCap(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 5, MaxOutputBytes: 10})
+    r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "head -c 100000 /dev/zero; echo e >&2"}})
+    if r.Err != nil {
+        t.Fatalf("capped command must still succeed: %v", r.Err)
+    }
+    if len(r.Stdout) != 10 || !r.StdoutTruncated || r.StderrTruncated || r.Stderr != "e\n" {
+        t.Fatalf("unexpected capture: %d bytes stdout, truncated=%v/%v, stderr=%q", len(r.Stdout), r.StdoutTruncated, r.StderrTruncated, r.Stderr)
+    }
+}
+
+func TestResult_MarshalJSON(t *testing.T) {
+    res := Results{Items: []Result{{Index: 1, Command: []string{"false"}, Step: plan.PlannedCommand{Command: []string{"false"}}, ExitCode: 1, Err: errors.New("exit status 1"), Elapsed: 1500 * time.Millisecond}}, Failed: 1}
+    b, err := json.Marshal(res)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got struct {
+        Items []map[string]any `json:"items"`
+        Failed int             `json:"failed"`
+    }
+    if err := json.Unmarshal(b, &got); err != nil {
+        t.Fatal(err)
+    }
+    it := got.Items[0]
+    if got.Failed != 1 || it["error"] != "exit status 1" || it["exit_code"] != float64(1) || it["elapsed_ms"] != float64(1500) {
+        t.Fatalf("unexpected JSON %s", b)
+    }
+}
+
+func TestRunCommand_SandboxKillsGroup(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 1, Sandbox: true, SandboxMemoryMB: 256})
+    start := time.Now()
+    r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "sleep 30 & echo started; wait"}})
+    if r.Err == nil {
+        t.Fatal("expected timeout error")
+    }
+    if time.Since(start) > 10*time.Second {
+        t.Fatal("background child kept the command alive past the timeout")
+    }
+    if !strings.Contains(r.Stdout, "started") {
+        t.Errorf("expected output before the kill, got %q", r.Stdout)
+    }
+}
+
+func TestRunCommand_IsolatesReadOnly(t *testing.T) {
+    if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+        t.Skip("isolation needs root on Linux")
+    }
+    e := New(config.Config{TimeoutSeconds: 5, Isolate: true, IsolateUID: 65534, IsolateGID: 65534})
+    r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"id", "-u"}})
+    if strings.Contains(r.Output, "operation not permitted") {
+        t.Skipf("namespaces unavailable here: %s", r.Output)
+    }
+    if r.Err != nil || r.Stdout != "65534\n" {
+        t.Fatalf("expected read-only command to run as 65534, got %q, %v", r.Output, r.Err)
+    }
+    // Not classified read-only: runs with the caller's credentials.
+    r = e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "id -u"}})
+    if r.Err != nil || r.Stdout != "0\n" {
+        t.Fatalf("expected unclassified command to run unisolated, got %q, %v", r.Output, r.Err)
+    }
+}
+
+func TestRunCommand_Timeout(t *testing.T) {
+    e := New(config.Config{TimeoutSeconds: 1, KillGraceSeconds: 1})
+    start := time.Now()
+    // The shell ignores SIGTERM, so only the SIGKILL after the grace period
+    // ends it; the background sleep must die with the group.
+    pc := plan.PlannedCommand{Command: []string{"sh", "-c", "trap '' TERM; sleep 30 & echo $!; wait"}}
+    r := e.RunCommand(context.Background(), 0, pc)
+    if !r.TimedOut || r.Err == nil || !strings.Contains(r.Err.Error(), "timed out") {
+        t.Fatalf("expected timeout, got %+v", r)
+    }
+    if d := time.Since(start); d < 2*time.Second || d > 10*time.Second {
+        t.Fatalf("expected SIGKILL after the grace period, took %s", d)
+    }
+    pid, err := strconv.Atoi(strings.TrimSpace(r.Stdout))
+    if err != nil {
+        t.Fatalf("unexpected output %q", r.Stdout)
+    }
+    time.Sleep(100 * time.Millisecond)
+    if alive(pid) {
+        t.Errorf("grandchild %d survived the timeout", pid)
+    }
+
+    r = e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"sh", "-c", "exit 1"}})
+    if r.TimedOut {
+        t.Error("a failing command must not be reported as timed out")
+    }
+}
+
+// alive reports whether pid is running; zombies awaiting their reaper count
+// as dead.
+func alive(pid int) bool {
+    b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+    if err != nil {
+        return syscall.Kill(pid, 0) == nil
+    }
+    s := string(b)
+    if i := strings.LastIndexByte(s, ')'); i >= 0 && i+2 < len(s) {
+        return s[i+2] != 'Z'
+    }
+    return true
+}
+
+func TestRunPlan_Parallel(t *testing.T) {
+    step := func(s string) plan.PlannedCommand {
+        return plan.PlannedCommand{Command: []string{"sh", "-c", "sleep 0.5; echo " + s}, Independent: true}
+    }
+    p := plan.Plan{Commands: []plan.PlannedCommand{step("a"), step("b"), step("c"), step("d")}}
+
+    start := time.Now()
+    res := New(config.Config{MaxParallel: 4}).RunPlan(context.Background(), p)
+    if d := time.Since(start); d > 1500*time.Millisecond {
+        t.Errorf("independent steps did not run concurrently: %s", d)
+    }
+    if res.Failed != 0 || len(res.Items) != 4 {
+        t.Fatalf("unexpected results %+v", res)
+    }
+    for i, want := range []string{"a", "b", "c", "d"} {
+        if it := res.Items[i]; it.Index != i || strings.TrimSpace(it.Stdout) != want {
+            t.Errorf("item %d: got index %d output %q", i, it.Index, it.Stdout)
+        }
+    }
+
+    start = time.Now()
+    New(config.Config{MaxParallel: 1}).RunPlan(context.Background(), p)
+    if d := time.Since(start); d < 2*time.Second {
+        t.Errorf("max_parallel 1 should run sequentially, took %s", d)
+    }
+}
+
+func TestRunPlan_DependentStepIsBarrier(t *testing.T) {
+    f := filepath.Join(t.TempDir(), "done")
+    p := plan.Plan{Commands: []plan.PlannedCommand{
+        {Command: []string{"sh", "-c", "sleep 0.3; touch " + f}, Independent: true},
+        {Command: []string{"test", "-e", f}},
+        {Command: []string{"true"}, Independent: true},
+    }}
+    res := New(config.Config{MaxParallel: 4}).RunPlan(context.Background(), p)
+    if res.Failed != 0 {
+        t.Fatalf("dependent step ran before its predecessor finished: %+v", res.Items[1])
+    }
+}
+
+func TestRunPlan_IndependentConfigStepsRunInOrder(t *testing.T) {
+    // A stand-in uci whose commit fails unless the slow set finished first.
+    dir := t.TempDir()
+    staged := filepath.Join(dir, "staged")
+    script := "#!/bin/sh\ncase $1 in\nset) sleep 0.3; touch " + staged + " ;;\ncommit) test -e " + staged + " ;;\nesac\n"
+    if err := os.WriteFile(filepath.Join(dir, "uci"), []byte(script), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+    p := plan.Plan{Commands: []plan.PlannedCommand{
+        {Command: []string{"uci", "set", "network.lan.ipaddr=192.168.2.1"}, Independent: true},
+        {Command: []string{"uci", "commit", "network"}, Independent: true},
+    }}
+    res := New(config.Config{MaxParallel: 4, TimeoutSeconds: 5}).RunPlan(context.Background(), p)
+    if res.Failed != 0 {
+        t.Fatalf("uci commit ran alongside the set it commits: %+v", res.Items)
+    }
+}
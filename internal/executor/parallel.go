@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// configCommands change configuration or services that later steps depend
+// on, such as a uci set before its commit; the planner's independent flag is
+// not trusted for them.
+var configCommands = map[string]bool{
+	"uci": true, "opkg": true, "ubus": true, "reload_config": true, "wifi": true,
+	"service": true, "fw4": true, "ifup": true, "ifdown": true,
+}
+
+// concurrent reports whether pc may run alongside neighbouring steps: it is
+// classified read-only by the policy, or marked independent by the planner
+// and changes no configuration or service. File writes always run on their
+// own.
+func (e *Engine) concurrent(pc plan.PlannedCommand) bool {
+	if pc.IsWrite() {
+		return false
+	}
+	if e.readOnly(pc) {
+		return true
+	}
+	if !pc.Independent {
+		return false
+	}
+	for _, argv := range pc.Stages() {
+		if len(argv) == 0 || configCommands[filepath.Base(argv[0])] || strings.HasPrefix(argv[0], "/etc/init.d/") {
+			return false
+		}
+	}
+	return true
+}
+
+// workers returns the size of the worker pool for concurrent steps.
+func (e *Engine) workers() int {
+	if e.cfg.MaxParallel < 1 {
+		return 1
+	}
+	return e.cfg.MaxParallel
+}
+
+// runBatch runs steps with a bounded worker pool and stores the result of
+// steps[k], plan index base+k, in out[k].
+func (e *Engine) runBatch(ctx context.Context, base int, steps []plan.PlannedCommand, out []Result) {
+	n := e.workers()
+	if n > len(steps) {
+		n = len(steps)
+	}
+	if n <= 1 {
+		for k, pc := range steps {
+			out[k] = e.runOne(ctx, base+k, pc)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				out[k] = e.runOne(ctx, base+k, steps[k])
+			}
+		}()
+	}
+	for k := range steps {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// runPipeline executes the stages of pc connected with os.Pipe, without a
+// shell. Stderr of all stages is captured; the final stdout goes to out or to
+// pc.StdoutFile. The first failing stage determines the error and exit
+// status, like "set -o pipefail".
+func (e *Engine) runPipeline(ctx context.Context, pc plan.PlannedCommand, out *capture) (int, string, error) {
+	stages := pc.Stages()
+	isolate := e.isolated(pc)
+	cmds := make([]*exec.Cmd, len(stages))
+	for i, argv := range stages {
+		if len(argv) == 0 {
+			return -1, "", fmt.Errorf("pipeline stage %d is empty", i)
+		}
+		cmd, stopKill, err := e.buildCmd(ctx, argv, pc.NeedsRoot, isolate)
+		if err != nil {
+			return -1, "", err
+		}
+		defer stopKill()
+		cmd.Stderr = out.Stderr()
+		cmds[i] = cmd
+	}
+
+	// parentFiles are closed once all stages are started so EOF propagates.
+	var parentFiles []*os.File
+	closeParent := func() {
+		for _, f := range parentFiles {
+			_ = f.Close()
+		}
+		parentFiles = nil
+	}
+	defer closeParent()
+
+	for i := 0; i < len(cmds)-1; i++ {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return -1, "", err
+		}
+		cmds[i].Stdout = pw
+		cmds[i+1].Stdin = pr
+		parentFiles = append(parentFiles, pr, pw)
+	}
+	if pc.Stdin != "" {
+		cmds[0].Stdin = strings.NewReader(pc.Stdin)
+	}
+
+	last := cmds[len(cmds)-1]
+	if pc.StdoutFile != "" {
+		f, err := openOutputFile(pc.StdoutFile)
+		if err != nil {
+			return -1, "", err
+		}
+		last.Stdout = f
+		parentFiles = append(parentFiles, f)
+	} else {
+		last.Stdout = out.Stdout()
+	}
+
+	started := 0
+	var startErr error
+	waits := make([]func() error, len(cmds))
+	for i, c := range cmds {
+		wait, err := e.start(ctx, c)
+		if err != nil {
+			startErr = err
+			break
+		}
+		waits[i] = wait
+		started++
+	}
+	closeParent()
+
+	var firstErr error
+	code, sig := 0, ""
+	for i := 0; i < started; i++ {
+		if startErr != nil {
+			_ = cmds[i].Process.Kill()
+		}
+		if err := waits[i](); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("stage %d: %w", i, err)
+			code, sig = exitStatus(cmds[i].ProcessState)
+		}
+	}
+	if startErr != nil {
+		return -1, "", fmt.Errorf("stage %d: %w", started, startErr)
+	}
+	return code, sig, firstErr
+}
+
+// openOutputFile creates or truncates path for writing. The parent directory
+// is created if needed and must not be a symlink; the file itself is opened
+// with O_NOFOLLOW.
+func openOutputFile(path string) (*os.File, error) {
+	if err := prepareDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, 0o600)
+}
+
+// prepareDir creates dir if needed and rejects it if it is a symlink.
+func prepareDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if real != dir {
+		return errors.New("directory must not be a symlink: " + dir)
+	}
+	return nil
+}
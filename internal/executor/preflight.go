@@ -0,0 +1,355 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// opkgSystem is what the opkg pre-flight reads from the device.
+type opkgSystem interface {
+	// Installed returns the installed packages.
+	Installed() ([]openwrt.OpkgPackage, error)
+	// Info returns the package lists' record of name; ok is false when the
+	// lists do not know it.
+	Info(ctx context.Context, name string) (p openwrt.OpkgPackage, ok bool, err error)
+	// Architectures returns the architectures opkg accepts.
+	Architectures(ctx context.Context) ([]string, error)
+	// Free returns the bytes available to packages and the filesystem
+	// they were measured on.
+	Free() (uint64, string, error)
+}
+
+// deviceOpkg queries opkg and the overlay of the running system.
+type deviceOpkg struct{}
+
+func (deviceOpkg) Installed() ([]openwrt.OpkgPackage, error) {
+	b, err := os.ReadFile(openwrt.OpkgStatusFile)
+	if err != nil {
+		return nil, err
+	}
+	var out []openwrt.OpkgPackage
+	for _, p := range openwrt.ParseOpkgControl(b) {
+		if p.Installed {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (deviceOpkg) Info(ctx context.Context, name string) (openwrt.OpkgPackage, bool, error) {
+	out, err := opkgQuery(ctx, "info", name)
+	if err != nil {
+		return openwrt.OpkgPackage{}, false, err
+	}
+	// opkg prints the installed record and the list's records; prefer the
+	// one that is not installed, which is what install would fetch.
+	var found *openwrt.OpkgPackage
+	for _, p := range openwrt.ParseOpkgControl(out) {
+		if p.Name != name {
+			continue
+		}
+		p := p
+		if found == nil || found.Installed && !p.Installed {
+			found = &p
+		}
+	}
+	if found == nil {
+		return openwrt.OpkgPackage{}, false, nil
+	}
+	return *found, true, nil
+}
+
+func (deviceOpkg) Architectures(ctx context.Context) ([]string, error) {
+	out, err := opkgQuery(ctx, "print-architecture")
+	if err != nil {
+		return nil, err
+	}
+	var archs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) >= 2 && f[0] == "arch" {
+			archs = append(archs, f[1])
+		}
+	}
+	return archs, nil
+}
+
+// Free measures /overlay, where packages go on squashfs images, or / on
+// systems without one.
+func (deviceOpkg) Free() (uint64, string, error) {
+	path := "/overlay"
+	if st, err := os.Stat(path); err != nil || !st.IsDir() {
+		path = "/"
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, path, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), path, nil
+}
+
+func opkgQuery(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "opkg", args...)
+	cmd.Env = minimalEnv()
+	return cmd.Output()
+}
+
+// opkgArgOptions are opkg options that take an argument.
+var opkgArgOptions = map[string]bool{
+	"-d": true, "--dest": true, "-o": true, "--offline-root": true,
+	"-f": true, "--conf": true, "-t": true, "--tmp-dir": true,
+	"-l": true, "--lists-dir": true, "--cache": true,
+	"--add-arch": true, "--add-dest": true,
+}
+
+// parseOpkg splits an opkg argv into its subcommand, options and package
+// arguments. ok is false for other programs.
+func parseOpkg(argv []string) (sub string, opts, pkgs []string, ok bool) {
+	if len(argv) < 2 || filepath.Base(argv[0]) != "opkg" {
+		return "", nil, nil, false
+	}
+	for i := 1; i < len(argv); i++ {
+		a := argv[i]
+		switch {
+		case strings.HasPrefix(a, "-"):
+			opts = append(opts, a)
+			if opkgArgOptions[a] && i+1 < len(argv) {
+				i++
+				opts = append(opts, argv[i])
+			}
+		case sub == "":
+			sub = a
+		default:
+			pkgs = append(pkgs, a)
+		}
+	}
+	return sub, opts, pkgs, true
+}
+
+func hasOpt(opts []string, names ...string) bool {
+	for _, o := range opts {
+		for _, n := range names {
+			if o == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errPreflight marks a step blocked by the opkg pre-flight.
+var errPreflight = errors.New("pre-flight")
+
+// preflight checks "opkg install" and "opkg remove" steps before they run.
+// It returns warnings, and an error when the step must not run: an install
+// whose packages target another architecture or would leave less than
+// cfg.OpkgMinFreeKB free.
+func (e *Engine) preflight(ctx context.Context, pc plan.PlannedCommand) ([]string, error) {
+	if pc.IsWrite() || len(pc.Pipeline) > 0 || e.opkg == nil {
+		return nil, nil
+	}
+	sub, opts, pkgs, ok := parseOpkg(pc.Command)
+	if !ok || len(pkgs) == 0 {
+		return nil, nil
+	}
+	switch sub {
+	case "install":
+		return e.preflightInstall(ctx, opts, pkgs)
+	case "remove":
+		return e.preflightRemove(opts, pkgs)
+	}
+	return nil, nil
+}
+
+func (e *Engine) preflightInstall(ctx context.Context, opts, pkgs []string) ([]string, error) {
+	var warnings []string
+	installed, err := e.opkg.Installed()
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("installed packages unknown: %v", err))
+	}
+	have := providers(installed)
+	archs, err := e.opkg.Architectures(ctx)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("architecture not checked: %v", err))
+	}
+
+	var (
+		need    int64
+		added   []string
+		queue   []string
+		planned = map[string]bool{}
+	)
+	for _, p := range pkgs {
+		if strings.HasSuffix(p, ".ipk") || strings.Contains(p, "/") {
+			if st, err := os.Stat(p); err == nil {
+				need += st.Size()
+			}
+			warnings = append(warnings, fmt.Sprintf("dependencies of %s are not checked", p))
+			continue
+		}
+		queue = append(queue, p)
+		planned[p] = true
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if have[name] {
+			continue
+		}
+		info, ok, err := e.opkg.Info(ctx, name)
+		if err != nil || !ok {
+			warnings = append(warnings, fmt.Sprintf("%s is not in the package lists (run opkg update first)", name))
+			continue
+		}
+		if len(archs) > 0 && info.Architecture != "" && !contains(archs, info.Architecture) {
+			return warnings, fmt.Errorf("%w: %s is built for %s, the device accepts %s", errPreflight, name, info.Architecture, strings.Join(archs, ", "))
+		}
+		size := info.InstalledSize
+		if size == 0 {
+			size = info.Size
+		}
+		need += size
+		if !contains(pkgs, name) {
+			added = append(added, name)
+		}
+		if hasOpt(opts, "--nodeps") {
+			continue
+		}
+		for _, alts := range info.Depends {
+			satisfied := false
+			for _, a := range alts {
+				if have[a] || planned[a] {
+					satisfied = true
+					break
+				}
+			}
+			if !satisfied {
+				planned[alts[0]] = true
+				queue = append(queue, alts[0])
+			}
+		}
+	}
+	if len(added) > 0 {
+		warnings = append(warnings, fmt.Sprintf("also installs %s", strings.Join(added, ", ")))
+	}
+
+	if hasOpt(opts, "-d", "--dest", "-o", "--offline-root") {
+		return append(warnings, "free space not checked for a custom destination"), nil
+	}
+	free, fs, err := e.opkg.Free()
+	if err != nil {
+		return append(warnings, fmt.Sprintf("free space unknown: %v", err)), nil
+	}
+	floor := int64(e.cfg.OpkgMinFreeKB) * 1024
+	if int64(free)-need < floor {
+		return warnings, fmt.Errorf("%w: installing needs about %s but %s has %s free; at least %s must stay free (opkg_min_free_kb)",
+			errPreflight, formatSize(need), fs, formatSize(int64(free)), formatSize(floor))
+	}
+	return warnings, nil
+}
+
+func (e *Engine) preflightRemove(opts, pkgs []string) ([]string, error) {
+	installed, err := e.opkg.Installed()
+	if err != nil {
+		return []string{fmt.Sprintf("installed packages unknown: %v", err)}, nil
+	}
+	var warnings []string
+	have := providers(installed)
+	for _, name := range pkgs {
+		if !have[name] {
+			warnings = append(warnings, fmt.Sprintf("%s is not installed", name))
+		}
+	}
+	// Names, including virtual ones, that no remaining package provides.
+	removed := map[string]bool{}
+	remaining := map[string]bool{}
+	for _, p := range installed {
+		m := remaining
+		if contains(pkgs, p.Name) {
+			m = removed
+		}
+		m[p.Name] = true
+		for _, v := range p.Provides {
+			m[v] = true
+		}
+	}
+	needed := map[string][]string{}
+	var gone []string
+	for _, p := range installed {
+		if contains(pkgs, p.Name) {
+			continue
+		}
+		for _, alts := range p.Depends {
+			lost := ""
+			for _, a := range alts {
+				if remaining[a] {
+					lost = ""
+					break
+				}
+				if removed[a] && lost == "" {
+					lost = a
+				}
+			}
+			if lost != "" {
+				if needed[lost] == nil {
+					gone = append(gone, lost)
+				}
+				needed[lost] = append(needed[lost], p.Name)
+				break
+			}
+		}
+	}
+	effect := "which may stop working"
+	if hasOpt(opts, "--force-removal-of-dependent-packages") {
+		effect = "which are removed too"
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		warnings = append(warnings, fmt.Sprintf("%s is needed by %s, %s", name, strings.Join(needed[name], ", "), effect))
+	}
+	return warnings, nil
+}
+
+// providers returns the names installed packages satisfy, including the
+// virtual ones they provide.
+func providers(installed []openwrt.OpkgPackage) map[string]bool {
+	have := map[string]bool{}
+	for _, p := range installed {
+		have[p.Name] = true
+		for _, v := range p.Provides {
+			have[v] = true
+		}
+	}
+	return have
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KiB", n>>10)
+	}
+	return fmt.Sprintf("%d B", n)
+}
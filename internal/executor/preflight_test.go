@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// fakeOpkg serves package records from memory.
+type fakeOpkg struct {
+	installed []openwrt.OpkgPackage
+	lists     map[string]openwrt.OpkgPackage
+	free      uint64
+	archErr   error
+	// hang makes Info block until its context is done.
+	hang bool
+}
+
+func (f *fakeOpkg) Installed() ([]openwrt.OpkgPackage, error) { return f.installed, nil }
+
+func (f *fakeOpkg) Info(ctx context.Context, name string) (openwrt.OpkgPackage, bool, error) {
+	if f.hang {
+		<-ctx.Done()
+		return openwrt.OpkgPackage{}, false, ctx.Err()
+	}
+	p, ok := f.lists[name]
+	return p, ok, nil
+}
+
+func (f *fakeOpkg) Architectures(ctx context.Context) ([]string, error) {
+	if f.archErr != nil {
+		return nil, f.archErr
+	}
+	return []string{"all", "noarch", "mipsel_24kc"}, nil
+}
+
+func (f *fakeOpkg) Free() (uint64, string, error) { return f.free, "/overlay", nil }
+
+func newFakeOpkg() *fakeOpkg {
+	dep := func(names ...string) [][]string {
+		var out [][]string
+		for _, n := range names {
+			out = append(out, strings.Split(n, "|"))
+		}
+		return out
+	}
+	return &fakeOpkg{
+		installed: []openwrt.OpkgPackage{
+			{Name: "libc", Installed: true},
+			{Name: "dnsmasq-full", Provides: []string{"dnsmasq"}, Installed: true},
+			{Name: "luci-base", Depends: dep("libc"), Installed: true},
+			{Name: "luci-app-firewall", Depends: dep("luci-base"), Installed: true},
+			{Name: "luci-mod-admin-full", Depends: dep("luci-base"), Installed: true},
+			{Name: "odhcpd", Depends: dep("dnsmasq|odhcpd-ipv6only"), Installed: true},
+		},
+		lists: map[string]openwrt.OpkgPackage{
+			"luci-app-sqm": {Name: "luci-app-sqm", Architecture: "all", Depends: dep("luci-base", "sqm-scripts"), InstalledSize: 100 << 10},
+			"sqm-scripts":  {Name: "sqm-scripts", Architecture: "all", Depends: dep("tc-tiny|tc-full", "libc"), InstalledSize: 200 << 10},
+			"tc-tiny":      {Name: "tc-tiny", Architecture: "mipsel_24kc", InstalledSize: 300 << 10},
+			"arm-only":     {Name: "arm-only", Architecture: "aarch64_cortex-a53"},
+		},
+		free: 2 << 20,
+	}
+}
+
+func TestPreflight_Install(t *testing.T) {
+	e := New(config.Config{OpkgMinFreeKB: 1024})
+	fake := newFakeOpkg()
+	e.opkg = fake
+	run := func(cmd string) ([]string, error) {
+		return e.preflight(context.Background(), plan.PlannedCommand{Command: strings.Fields(cmd)})
+	}
+
+	warnings, err := run("opkg install luci-app-sqm")
+	if err != nil {
+		t.Fatalf("600 KiB fits in 2 MiB with a 1 MiB floor: %v", err)
+	}
+	if !reflect.DeepEqual(warnings, []string{"also installs sqm-scripts, tc-tiny"}) {
+		t.Errorf("warnings %q", warnings)
+	}
+
+	fake.free = 1500 << 10
+	_, err = run("opkg install luci-app-sqm")
+	if !errors.Is(err, errPreflight) || !strings.Contains(err.Error(), "needs about 600 KiB but /overlay has 1.5 MiB free") {
+		t.Errorf("floor: %v", err)
+	}
+	// Already installed packages need no space.
+	if _, err := run("opkg install luci-base"); err != nil {
+		t.Errorf("installed package: %v", err)
+	}
+
+	if _, err := run("opkg install arm-only"); err == nil || !strings.Contains(err.Error(), "built for aarch64_cortex-a53") {
+		t.Errorf("architecture: %v", err)
+	}
+	fake.archErr = errors.New("opkg: not found")
+	warnings, err = run("opkg install arm-only")
+	if err != nil || !reflect.DeepEqual(warnings, []string{"architecture not checked: opkg: not found"}) {
+		t.Errorf("unknown architectures: %v %q", err, warnings)
+	}
+	fake.archErr = nil
+	warnings, _ = run("opkg install --nodeps nosuch")
+	if !reflect.DeepEqual(warnings, []string{"nosuch is not in the package lists (run opkg update first)"}) {
+		t.Errorf("unknown package warnings %q", warnings)
+	}
+	warnings, err = run("opkg -d ram install luci-app-sqm")
+	if err != nil || !strings.Contains(strings.Join(warnings, "\n"), "custom destination") {
+		t.Errorf("custom destination: %v %q", err, warnings)
+	}
+}
+
+func TestPreflight_Remove(t *testing.T) {
+	e := New(config.Config{})
+	e.opkg = newFakeOpkg()
+	warnings, err := e.preflight(context.Background(), plan.PlannedCommand{Command: []string{"opkg", "remove", "luci-base", "dnsmasq-full", "nosuch"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nosuch is not installed",
+		"dnsmasq is needed by odhcpd, which may stop working",
+		"luci-base is needed by luci-app-firewall, luci-mod-admin-full, which may stop working",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got  %q\nwant %q", warnings, want)
+	}
+	warnings, _ = e.preflight(context.Background(), plan.PlannedCommand{Command: []string{"opkg", "remove", "--force-removal-of-dependent-packages", "luci-app-firewall"}})
+	if warnings != nil {
+		t.Errorf("nothing depends on luci-app-firewall: %q", warnings)
+	}
+}
+
+func TestPreflight_BlocksStep(t *testing.T) {
+	e := New(config.Config{OpkgMinFreeKB: 4096})
+	e.opkg = newFakeOpkg()
+	r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"opkg", "install", "luci-app-sqm"}})
+	if !errors.Is(r.Err, errPreflight) || r.ExitCode != -1 || !strings.HasPrefix(r.Output, "pre-flight: ") {
+		t.Errorf("result %+v", r)
+	}
+}
+
+func TestPreflight_StepTimeout(t *testing.T) {
+	e := New(config.Config{TimeoutSeconds: 1})
+	fake := newFakeOpkg()
+	fake.hang = true
+	e.opkg = fake
+	start := time.Now()
+	r := e.RunCommand(context.Background(), 0, plan.PlannedCommand{Command: []string{"opkg", "install", "luci-app-sqm"}})
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("pre-flight outlived the step timeout: %s", d)
+	}
+	if !r.TimedOut {
+		t.Errorf("expected a timed out step, got %+v", r)
+	}
+}
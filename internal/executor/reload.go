@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// ReloadSteps returns the steps that apply UCI packages the plan committed
+// but did not reload, judged by the results of the steps that ran: one
+// config.change event per package, which procd turns into the reload of
+// the services reading it, as reload_config does.
+func (e *Engine) ReloadSteps(p plan.Plan, done []Result) []plan.PlannedCommand {
+	succeeded := map[int]bool{}
+	for _, r := range done {
+		if r.Err == nil {
+			succeeded[r.Index] = true
+		}
+	}
+	var steps []plan.PlannedCommand
+	for _, pkg := range openwrt.PendingReloads(p, func(i int) bool { return succeeded[i] }) {
+		steps = append(steps, reloadStep(pkg, needsRoot(p)))
+	}
+	return steps
+}
+
+// needsRoot reports whether a step of p needs root, and so the steps added
+// for it do.
+func needsRoot(p plan.Plan) bool {
+	for _, c := range p.Commands {
+		if c.NeedsRoot {
+			return true
+		}
+	}
+	return false
+}
+
+func reloadStep(pkg string, root bool) plan.PlannedCommand {
+	return plan.PlannedCommand{
+		Command:     openwrt.ReloadCommand(pkg),
+		Description: fmt.Sprintf("reload %s (added automatically)", pkg),
+		NeedsRoot:   root,
+	}
+}
+
+// ReloadRestored reloads the services reading the UCI packages among the
+// restored files, like reload_config, with one automatic step per package:
+// each is checked against the policy and bounded by the step timeout. The
+// error names the reloads that failed or timed out.
+func (e *Engine) ReloadRestored(ctx context.Context, files []string, root bool) ([]Result, error) {
+	var pkgs []string
+	for _, f := range files {
+		if pkg, ok := openwrt.ConfigFilePackage(f); ok && !contains(pkgs, pkg) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	var (
+		results []Result
+		errs    []error
+	)
+	for i, pkg := range pkgs {
+		r := e.RunAuto(ctx, i, reloadStep(pkg, root))
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("reload %s: %w", pkg, r.Err))
+		}
+		results = append(results, r)
+	}
+	return results, errors.Join(errs...)
+}
+
+// RunAuto runs a step the executor appended to the plan, after checking it
+// against the policy like a planned one.
+func (e *Engine) RunAuto(ctx context.Context, index int, pc plan.PlannedCommand) Result {
+	if err := e.policy.ValidatePlan(plan.Plan{Commands: []plan.PlannedCommand{pc}}); err != nil {
+		return Result{Index: index, Command: pc.Command, Step: pc, Auto: true, ExitCode: -1,
+			Err: fmt.Errorf("automatic step rejected: %w", err)}
+	}
+	r := e.runOne(ctx, index, pc)
+	r.Auto = true
+	return r
+}
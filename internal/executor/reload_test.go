@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func TestReloadSteps(t *testing.T) {
+	p := plan.Plan{Commands: []plan.PlannedCommand{
+		{Command: []string{"uci", "set", "network.lan.ipaddr=192.168.2.1"}},
+		{Command: []string{"uci", "commit", "network"}, NeedsRoot: true},
+		{Command: []string{"uci", "commit", "firewall"}},
+	}}
+	e := New(config.Config{})
+	done := []Result{{Index: 0}, {Index: 1}, {Index: 2, Err: context.Canceled}}
+	steps := e.ReloadSteps(p, done)
+	if len(steps) != 1 {
+		t.Fatalf("expected one step, got %+v", steps)
+	}
+	if got := strings.Join(steps[0].Command, " "); !strings.Contains(got, `"package":"network"`) || !steps[0].NeedsRoot {
+		t.Fatalf("unexpected step %q %+v", got, steps[0])
+	}
+	if steps := e.ReloadSteps(p, done[:1]); len(steps) != 0 {
+		t.Fatalf("expected no steps before the commit ran, got %+v", steps)
+	}
+}
+
+func TestRunAuto_Policy(t *testing.T) {
+	e := New(config.Config{TimeoutSeconds: 5, Allowlist: []string{`^uci(\s|$)`}})
+	pc := plan.PlannedCommand{Command: []string{"ubus", "call", "service", "event", "{}"}}
+	r := e.RunAuto(context.Background(), 3, pc)
+	if !r.Auto || r.Index != 3 || r.Err == nil || !strings.Contains(r.Err.Error(), "not allowed") {
+		t.Fatalf("expected a rejected automatic step, got %+v", r)
+	}
+}
+
+func TestRunPlan_AutoReload(t *testing.T) {
+	// A stand-in uci that succeeds; the reload it triggers is not allowed.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "uci"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	p := plan.Plan{Commands: []plan.PlannedCommand{
+		{Command: []string{"uci", "set", "system.@system[0].hostname=gw"}},
+		{Command: []string{"uci", "commit", "system"}},
+	}}
+	cfg := config.Config{TimeoutSeconds: 5, Allowlist: []string{`^uci(\s|$)`}}
+	if res := New(cfg).RunPlan(context.Background(), p); len(res.Items) != 2 || res.Failed != 0 {
+		t.Fatalf("expected no automatic step when disabled, got %+v", res)
+	}
+
+	cfg.AutoReload = true
+	res := New(cfg).RunPlan(context.Background(), p)
+	if len(res.Items) != 3 || res.Failed != 1 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if r := res.Items[2]; !r.Auto || r.Index != 2 || r.Err == nil {
+		t.Fatalf("expected the rejected reload of system, got %+v", r)
+	}
+}
+
+func TestReloadRestored(t *testing.T) {
+	// A stand-in ubus that records its calls and hangs for the firewall.
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$4\" >> " + calls + "\ncase $4 in *firewall*) sleep 5 ;; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "ubus"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	e := New(config.Config{TimeoutSeconds: 1, Allowlist: []string{`^ubus(\s|$)`}})
+	files := []string{"/etc/config/network", "/etc/sysupgrade.conf", "/etc/config/dhcp", "/etc/config/network"}
+	res, err := e.ReloadRestored(context.Background(), files, false)
+	if err != nil || len(res) != 2 || !res[0].Auto {
+		t.Fatalf("expected two automatic reloads, got %+v, %v", res, err)
+	}
+	b, _ := os.ReadFile(calls)
+	if got := string(b); !strings.Contains(got, `"package":"dhcp"`) || strings.Index(got, "dhcp") > strings.Index(got, "network") {
+		t.Errorf("expected dhcp and network reloaded in order, got %q", got)
+	}
+
+	_, err = e.ReloadRestored(context.Background(), []string{"/etc/config/firewall"}, false)
+	if err == nil || !strings.Contains(err.Error(), "reload firewall: timed out") {
+		t.Errorf("expected a timed out reload, got %v", err)
+	}
+	e = New(config.Config{TimeoutSeconds: 1, Allowlist: []string{`^uci(\s|$)`}})
+	if _, err := e.ReloadRestored(context.Background(), files[:1], false); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("expected the policy to reject the reload, got %v", err)
+	}
+}
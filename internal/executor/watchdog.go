@@ -0,0 +1,277 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/backup"
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// watchedPackages are the UCI packages whose changes can cut the router off.
+var watchedPackages = map[string]bool{"network": true, "wireless": true, "firewall": true, "dhcp": true}
+
+// watchdogAttempts bounds how often failing checks are repeated, delay
+// seconds apart, before they count as regressed.
+const watchdogAttempts = 3
+
+// CheckResult is the outcome of one connectivity check.
+type CheckResult struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	OK      bool     `json:"ok"`
+	// Baseline reports whether the check passed before the plan ran; only
+	// checks that did can regress.
+	Baseline bool `json:"baseline"`
+	// Skipped holds why the check did not run, e.g. a policy rejection.
+	Skipped string `json:"skipped,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+// WatchdogReport is the result of the checks after a plan and of the
+// rollback they triggered.
+type WatchdogReport struct {
+	Checks []CheckResult `json:"checks"`
+	// Regressed names the checks that passed before the plan but not after.
+	Regressed []string `json:"regressed,omitempty"`
+	// RolledBack is the backup restored because of a regression.
+	RolledBack    string   `json:"rolled_back,omitempty"`
+	Restored      []string `json:"restored,omitempty"`
+	RollbackError string   `json:"rollback_error,omitempty"`
+	// Recovered reports whether the regressed checks pass after the rollback.
+	Recovered bool `json:"recovered,omitempty"`
+}
+
+// Rollback restores the configuration saved before the plan and reloads the
+// services reading it. It returns the backup ID and the files it restored.
+type Rollback func(ctx context.Context) (id string, restored []string, err error)
+
+// BackupRollback returns a Rollback that restores backup id from store and
+// reloads the restored packages with ReloadRestored, with root when a step
+// of p needed it. A reload that times out is reported as such.
+func (e *Engine) BackupRollback(store *backup.Store, id string, p plan.Plan) Rollback {
+	return func(ctx context.Context) (string, []string, error) {
+		restored, _, err := store.Restore(id)
+		if len(restored) > 0 {
+			if _, rerr := e.ReloadRestored(ctx, restored, needsRoot(p)); err == nil {
+				err = rerr
+			}
+		}
+		return id, restored, err
+	}
+}
+
+// check is a connectivity probe; ok judges its successful output. Probes
+// are built here from the watchdog settings and validated by the policy like
+// planned steps; the default allowlist has entries for exactly their shapes.
+// They run outside isolation: ping needs privileges the isolated user lacks.
+// invalid holds why the settings cannot make a probe.
+type check struct {
+	name    string
+	step    plan.PlannedCommand
+	ok      func(output string) bool
+	invalid string
+}
+
+var (
+	defaultRouteRE = regexp.MustCompile(`(?m)^default\s`)
+	interfaceUpRE  = regexp.MustCompile(`"up":\s*true`)
+)
+
+func (e *Engine) checks() []check {
+	var out []check
+	for _, target := range e.cfg.WatchdogTargets {
+		out = append(out, check{name: "ping " + target, step: probe("ping", "-c", "1", "-W", "2", target), invalid: probeOperand(target)})
+	}
+	out = append(out, check{
+		name: "default route",
+		step: probe("ip", "route", "show", "default"),
+		ok:   defaultRouteRE.MatchString,
+	})
+	if e.cfg.WatchdogDNSName != "" {
+		out = append(out, check{name: "dns " + e.cfg.WatchdogDNSName, step: probe("nslookup", e.cfg.WatchdogDNSName), invalid: probeOperand(e.cfg.WatchdogDNSName)})
+	}
+	if e.cfg.WatchdogLAN != "" {
+		out = append(out, check{
+			name:    "interface " + e.cfg.WatchdogLAN,
+			step:    probe("ifstatus", e.cfg.WatchdogLAN),
+			ok:      interfaceUpRE.MatchString,
+			invalid: probeOperand(e.cfg.WatchdogLAN),
+		})
+	}
+	return out
+}
+
+// probeOperand returns why a setting cannot be a probe's operand: one
+// starting with "-" would be parsed as an option.
+func probeOperand(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return fmt.Sprintf("invalid target %q", s)
+	}
+	return ""
+}
+
+func probe(argv ...string) plan.PlannedCommand {
+	return plan.PlannedCommand{Command: argv, NoIsolate: true}
+}
+
+// Watchdog compares connectivity before and after a plan.
+type Watchdog struct {
+	e        *Engine
+	checks   []check
+	baseline []CheckResult
+}
+
+// Watches reports whether the watchdog is enabled and p changes one of the
+// watched packages.
+func (e *Engine) Watches(p plan.Plan) bool {
+	if !e.cfg.Watchdog {
+		return false
+	}
+	for _, c := range p.Commands {
+		if pkg, ok := openwrt.ConfigFilePackage(c.WritePath()); ok && watchedPackages[pkg] {
+			return true
+		}
+		if uc, ok := openwrt.ParseUCICommand(c.Command); ok && (uc.IsWrite() || uc.Sub == "commit") &&
+			(uc.Package == "" || watchedPackages[uc.Package]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWatchdog runs the checks as a baseline before p executes. It returns
+// nil when the plan is not watched.
+func (e *Engine) NewWatchdog(ctx context.Context, p plan.Plan) *Watchdog {
+	if !e.Watches(p) {
+		return nil
+	}
+	w := &Watchdog{e: e, checks: e.checks()}
+	w.baseline = w.run(ctx, w.checks)
+	return w
+}
+
+// Verify waits for services to settle and repeats the checks. When one that
+// passed before the plan keeps failing, rollback is called, if not nil, and
+// the regressed checks are run once more.
+func (w *Watchdog) Verify(ctx context.Context, rollback Rollback) *WatchdogReport {
+	rep := &WatchdogReport{Checks: make([]CheckResult, len(w.checks))}
+	pending := make([]int, 0, len(w.checks))
+	for i, c := range w.checks {
+		rep.Checks[i] = CheckResult{Name: c.name, Command: c.step.Command, Baseline: w.baseline[i].OK, Skipped: "interrupted"}
+		pending = append(pending, i)
+	}
+	for attempt := 0; attempt < watchdogAttempts && len(pending) > 0; attempt++ {
+		if !w.e.settle(ctx) {
+			return rep
+		}
+		var failing []int
+		for _, i := range pending {
+			r := w.run(ctx, w.checks[i:i+1])[0]
+			rep.Checks[i] = r
+			if !r.OK && r.Baseline && r.Skipped == "" {
+				failing = append(failing, i)
+			}
+		}
+		pending = failing
+	}
+	for _, i := range pending {
+		rep.Regressed = append(rep.Regressed, w.checks[i].name)
+	}
+	if len(pending) == 0 {
+		return rep
+	}
+	if rollback == nil {
+		rep.RollbackError = "no backup to roll back to"
+		return rep
+	}
+	var err error
+	rep.RolledBack, rep.Restored, err = rollback(ctx)
+	if err != nil {
+		rep.RollbackError = err.Error()
+		return rep
+	}
+	rep.Recovered = w.e.settle(ctx)
+	for _, i := range pending {
+		if r := w.run(ctx, w.checks[i:i+1])[0]; !r.OK {
+			rep.Recovered = false
+		}
+	}
+	return rep
+}
+
+// run executes checks through the policy and returns their results.
+func (w *Watchdog) run(ctx context.Context, checks []check) []CheckResult {
+	out := make([]CheckResult, len(checks))
+	for i, c := range checks {
+		r := CheckResult{Name: c.name, Command: c.step.Command}
+		for _, b := range w.baseline {
+			if b.Name == c.name {
+				r.Baseline = b.OK
+			}
+		}
+		if c.invalid != "" {
+			r.Skipped = c.invalid
+			out[i] = r
+			continue
+		}
+		if err := w.e.policy.ValidatePlan(plan.Plan{Commands: []plan.PlannedCommand{c.step}}); err != nil {
+			r.Skipped = err.Error()
+			out[i] = r
+			continue
+		}
+		res := w.e.runOne(ctx, 0, c.step)
+		r.Output = strings.TrimSpace(res.Output)
+		r.OK = res.Err == nil && (c.ok == nil || c.ok(res.Output))
+		out[i] = r
+	}
+	return out
+}
+
+// settle waits cfg.WatchdogDelaySeconds and reports whether ctx is still live.
+func (e *Engine) settle(ctx context.Context) bool {
+	t := time.NewTimer(time.Duration(e.cfg.WatchdogDelaySeconds) * time.Second)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Failed reports whether a check regressed, whether or not the rollback
+// recovered it.
+func (r *WatchdogReport) Failed() bool {
+	return r != nil && len(r.Regressed) > 0
+}
+
+func (r *WatchdogReport) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		status := "ok"
+		switch {
+		case c.Skipped != "":
+			status = "skipped: " + c.Skipped
+		case !c.OK && !c.Baseline:
+			status = "failed, as before the plan"
+		case !c.OK:
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", c.Name, status)
+	}
+	switch {
+	case len(r.Regressed) == 0:
+	case r.RollbackError != "":
+		fmt.Fprintf(&b, "Connectivity lost (%s); rollback failed: %s\n", strings.Join(r.Regressed, ", "), r.RollbackError)
+	case r.Recovered:
+		fmt.Fprintf(&b, "Connectivity lost (%s); rolled back to backup %s (%d files) and recovered\n", strings.Join(r.Regressed, ", "), r.RolledBack, len(r.Restored))
+	default:
+		fmt.Fprintf(&b, "Connectivity lost (%s); rolled back to backup %s (%d files) but the checks still fail\n", strings.Join(r.Regressed, ", "), r.RolledBack, len(r.Restored))
+	}
+	return b.String()
+}
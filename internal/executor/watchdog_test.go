@@ -0,0 +1,190 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// fakeNetwork puts stand-ins for the check commands on PATH. ping fails
+// while the returned file exists.
+func fakeNetwork(t *testing.T) (down string) {
+	t.Helper()
+	dir := t.TempDir()
+	down = filepath.Join(dir, "down")
+	scripts := map[string]string{
+		"ping":     "test ! -e " + down,
+		"ip":       "echo 'default via 192.0.2.1 dev wan'",
+		"nslookup": "echo 'Name: openwrt.org'",
+		"ifstatus": `echo '{ "up": true }'`,
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	return down
+}
+
+// watchdogConfig allows the probes with the default allowlist's entries.
+func watchdogConfig() config.Config {
+	return config.Config{
+		TimeoutSeconds:  5,
+		Watchdog:        true,
+		WatchdogTargets: []string{"192.0.2.1"},
+		WatchdogDNSName: "openwrt.org",
+		WatchdogLAN:     "lan",
+		Allowlist:       []string{`^uci\s`, `^ping -c 1 -W 2 [^-\s]\S*$`, `^ip\s`, `^nslookup [^-\s]\S*$`, `^ifstatus\s`},
+	}
+}
+
+var networkPlan = plan.Plan{Commands: []plan.PlannedCommand{
+	{Command: []string{"uci", "set", "network.lan.ipaddr=192.168.2.1"}},
+	{Command: []string{"uci", "commit", "network"}},
+}}
+
+func TestWatches(t *testing.T) {
+	e := New(watchdogConfig())
+	cases := []struct {
+		argv string
+		want bool
+	}{
+		{"uci commit network", true},
+		{"uci set firewall.@zone[1].input=REJECT", true},
+		{"uci commit", true},
+		{"uci show network", false},
+		{"uci commit system", false},
+		{"logread", false},
+	}
+	for _, c := range cases {
+		p := plan.Plan{Commands: []plan.PlannedCommand{{Command: strings.Fields(c.argv)}}}
+		if got := e.Watches(p); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.argv, c.want, got)
+		}
+	}
+	write := plan.Plan{Commands: []plan.PlannedCommand{{WriteFile: &plan.WriteFile{Path: "/etc/config/wireless"}}}}
+	if !e.Watches(write) {
+		t.Error("expected a write of /etc/config/wireless to be watched")
+	}
+	if New(config.Config{}).Watches(networkPlan) {
+		t.Error("expected nothing watched with the watchdog disabled")
+	}
+}
+
+func TestWatchdog_Rollback(t *testing.T) {
+	down := fakeNetwork(t)
+	e := New(watchdogConfig())
+	w := e.NewWatchdog(context.Background(), networkPlan)
+	if w == nil {
+		t.Fatal("expected a watchdog")
+	}
+	if err := os.WriteFile(down, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rolledBack := false
+	rep := w.Verify(context.Background(), func(context.Context) (string, []string, error) {
+		rolledBack = true
+		return "20261019-120000", []string{"/etc/config/network"}, os.Remove(down)
+	})
+	if !rolledBack || !reflect.DeepEqual(rep.Regressed, []string{"ping 192.0.2.1"}) {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	if rep.RolledBack != "20261019-120000" || !rep.Recovered || !rep.Failed() {
+		t.Fatalf("expected a recovered rollback, got %+v", rep)
+	}
+	for _, c := range rep.Checks[1:] {
+		if !c.OK || !c.Baseline {
+			t.Errorf("expected %s to pass, got %+v", c.Name, c)
+		}
+	}
+}
+
+func TestWatchdog_Baseline(t *testing.T) {
+	down := fakeNetwork(t)
+	if err := os.WriteFile(down, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := watchdogConfig()
+	cfg.Allowlist = cfg.Allowlist[:4] // ifstatus is not allowed
+	w := New(cfg).NewWatchdog(context.Background(), networkPlan)
+	rep := w.Verify(context.Background(), func(context.Context) (string, []string, error) {
+		t.Fatal("unexpected rollback")
+		return "", nil, nil
+	})
+	if len(rep.Regressed) != 0 || rep.Failed() {
+		t.Fatalf("expected no regression, got %+v", rep)
+	}
+	if c := rep.Checks[0]; c.OK || c.Baseline {
+		t.Errorf("expected ping to fail as before, got %+v", c)
+	}
+	for _, c := range rep.Checks[1:3] {
+		if !c.OK || c.Skipped != "" {
+			t.Errorf("expected %s to run and pass, got %+v", c.Name, c)
+		}
+	}
+	if c := rep.Checks[3]; !strings.Contains(c.Skipped, "not allowed by policy") {
+		t.Errorf("expected the ifstatus check to be skipped, got %+v", c)
+	}
+	if !strings.Contains(rep.String(), "failed, as before the plan") {
+		t.Errorf("unexpected summary %q", rep.String())
+	}
+}
+
+func TestWatchdog_NoBackup(t *testing.T) {
+	down := fakeNetwork(t)
+	w := New(watchdogConfig()).NewWatchdog(context.Background(), networkPlan)
+	if err := os.WriteFile(down, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rep := w.Verify(context.Background(), nil)
+	if !rep.Failed() || rep.RollbackError == "" || rep.Recovered {
+		t.Fatalf("expected an unrecovered regression, got %+v", rep)
+	}
+}
+
+func TestWatchdog_ProbesNotIsolated(t *testing.T) {
+	cfg := watchdogConfig()
+	cfg.Isolate = true
+	e := New(cfg)
+	for _, c := range e.checks() {
+		if !e.readOnly(c.step) {
+			continue
+		}
+		if e.isolated(c.step) {
+			t.Errorf("expected %s to run outside isolation", c.name)
+		}
+	}
+	if pc := (plan.PlannedCommand{Command: []string{"ping", "-c", "1", "192.0.2.1"}}); !e.isolated(pc) {
+		t.Error("expected a planned ping to stay isolated")
+	}
+	var pc plan.PlannedCommand
+	if err := json.Unmarshal([]byte(`{"command":["ping"],"NoIsolate":true}`), &pc); err != nil || pc.NoIsolate {
+		t.Errorf("a plan must not opt out of isolation: %+v, %v", pc, err)
+	}
+}
+
+func TestWatchdog_OptionOperands(t *testing.T) {
+	fakeNetwork(t)
+	cfg := watchdogConfig()
+	cfg.WatchdogTargets = []string{"-f"}
+	cfg.WatchdogDNSName = "-type=any"
+	cfg.WatchdogLAN = "--help"
+	cfg.Allowlist = []string{`.`}
+	w := New(cfg).NewWatchdog(context.Background(), networkPlan)
+	for _, i := range []int{0, 2, 3} {
+		if c := w.baseline[i]; c.OK || !strings.HasPrefix(c.Skipped, "invalid target") {
+			t.Errorf("expected %s to be skipped as invalid, got %+v", c.Name, c)
+		}
+	}
+	if c := w.baseline[1]; !c.OK {
+		t.Errorf("expected the default route check to pass, got %+v", c)
+	}
+}
@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// writeFile replaces w.Path atomically: the content goes to a temporary file
+// in the same directory, which is synced and renamed over the target. With
+// w.Backup an existing file is first copied to cfg.WriteBackupDir.
+func (e *Engine) writeFile(w plan.WriteFile) (string, error) {
+	dir := filepath.Dir(w.Path)
+	if err := prepareDir(dir); err != nil {
+		return "", err
+	}
+
+	mode := os.FileMode(0o600)
+	fi, err := os.Lstat(w.Path)
+	existed := err == nil
+	switch {
+	case existed && !fi.Mode().IsRegular():
+		return "", fmt.Errorf("%s is not a regular file", w.Path)
+	case existed:
+		mode = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return "", err
+	}
+	if w.Mode != "" {
+		m, err := strconv.ParseUint(w.Mode, 8, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid mode %q", w.Mode)
+		}
+		mode = os.FileMode(m).Perm()
+	}
+
+	msg := fmt.Sprintf("wrote %d bytes to %s (mode %04o)", len(w.Content), w.Path, mode)
+	if w.Backup && existed {
+		b, err := e.backupFile(w.Path)
+		if err != nil {
+			return "", fmt.Errorf("backup: %w", err)
+		}
+		msg += ", previous file saved to " + b
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(w.Path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.WriteString(w.Content); err != nil {
+		return "", err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), w.Path); err != nil {
+		return "", err
+	}
+	committed = true
+	return msg + "\n", nil
+}
+
+// backupFile copies path into cfg.WriteBackupDir under a timestamped name and
+// returns the backup path. Backups are private (0600) since config files may
+// hold secrets.
+func (e *Engine) backupFile(path string) (string, error) {
+	dir := e.cfg.WriteBackupDir
+	if dir == "" {
+		dir = "/tmp/lucicodex/backups"
+	}
+	if err := prepareDir(dir); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	name := strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "_") + "." + time.Now().Format("20060102-150405.000000000")
+	dst := filepath.Join(dir, name)
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return dst, f.Close()
+}
@@ -0,0 +1,106 @@
+// Package explain asks the model to describe existing commands, plans or
+// configuration without generating or executing anything.
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/llm"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// Subject kinds.
+const (
+	KindCommand = "command"
+	KindPlan    = "plan"
+	KindConfig  = "config"
+)
+
+// Subject is the thing to explain.
+type Subject struct {
+	Kind string
+	Text string
+}
+
+// CommandSubject describes a single argv.
+func CommandSubject(argv []string) Subject {
+	return Subject{Kind: KindCommand, Text: executor.FormatCommand(argv)}
+}
+
+// PlanSubject describes a plan as its JSON form.
+func PlanSubject(p plan.Plan) Subject {
+	p.ConfigDiffs = nil
+	b, _ := json.MarshalIndent(p, "", "  ")
+	return Subject{Kind: KindPlan, Text: string(b)}
+}
+
+// ConfigSubject describes a configuration dump such as "uci show network".
+func ConfigSubject(dump string) Subject {
+	return Subject{Kind: KindConfig, Text: strings.TrimSpace(dump)}
+}
+
+// Explanation is the structured reply.
+type Explanation struct {
+	Purpose         string   `json:"purpose"`
+	Effects         []string `json:"effects"`
+	Risk            string   `json:"risk"`
+	RiskReasons     []string `json:"risk_reasons,omitempty"`
+	RelatedServices []string `json:"related_services,omitempty"`
+	Steps           []string `json:"steps,omitempty"`
+}
+
+// BuildPrompt returns the full prompt for explaining s. facts may be empty.
+func BuildPrompt(s Subject, facts string) string {
+	b := &strings.Builder{}
+	b.WriteString("You are an OpenWrt expert explaining router commands and configuration.\n")
+	b.WriteString("Do not propose, generate or run any commands; only explain.\n")
+	b.WriteString("Output only strict JSON that conforms to this schema:\n")
+	b.WriteString("{\n  \"purpose\": string,\n  \"effects\": [string],\n  \"risk\": \"low\" | \"medium\" | \"high\",\n  \"risk_reasons\": [string],\n  \"related_services\": [string],\n  \"steps\": [string]\n}\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Describe concrete effects: which UCI packages, files, interfaces and services change.\n")
+	b.WriteString("- related_services lists services that must be reloaded or are affected.\n")
+	switch s.Kind {
+	case KindPlan:
+		b.WriteString("- steps explains each command of the plan in order.\n")
+	case KindConfig:
+		b.WriteString("- steps explains each section of the configuration; risk describes the current settings.\n")
+	default:
+		b.WriteString("- steps may be empty for a single command.\n")
+	}
+	b.WriteString(plan.UntrustedRule)
+	if facts != "" {
+		b.WriteString("\n")
+		b.WriteString(plan.FenceUntrusted("Environment facts (read-only)", facts))
+		b.WriteString("\n")
+	}
+	b.WriteString("\nExplain this ")
+	b.WriteString(s.Kind)
+	b.WriteString(":\n")
+	if s.Kind == KindConfig {
+		// Configuration dumps carry device data such as SSIDs and hostnames.
+		b.WriteString(plan.FenceUntrusted("configuration", s.Text))
+	} else {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+// Explain sends the subject to the provider and returns the parsed explanation.
+func Explain(ctx context.Context, p llm.Provider, s Subject, facts string) (Explanation, error) {
+	var e Explanation
+	if strings.TrimSpace(s.Text) == "" {
+		return e, errors.New("nothing to explain")
+	}
+	if err := llm.CompleteJSON(ctx, p, BuildPrompt(s, facts), &e); err != nil {
+		return e, err
+	}
+	e.Risk = strings.ToLower(strings.TrimSpace(e.Risk))
+	if e.Purpose == "" && len(e.Effects) == 0 {
+		return e, errors.New("empty explanation")
+	}
+	return e, nil
+}
@@ -0,0 +1,62 @@
+package explain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+type fakeProvider struct {
+	reply  string
+	prompt string
+}
+
+func (f *fakeProvider) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
+	return plan.Plan{}, nil
+}
+
+func (f *fakeProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	f.prompt = prompt
+	return f.reply, nil
+}
+
+func TestBuildPrompt(t *testing.T) {
+	got := BuildPrompt(CommandSubject([]string{"uci", "set", "network.lan.ipaddr=10.0.0.1"}), "board: x86")
+	for _, want := range []string{"Do not propose", "\"risk\"", "Environment facts", "board: x86", "uci set network.lan.ipaddr=10.0.0.1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected prompt to contain %q", want)
+		}
+	}
+	if strings.Contains(BuildPrompt(ConfigSubject("network.lan=interface"), ""), "Environment facts") {
+		t.Error("expected no facts block when facts are empty")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	fp := &fakeProvider{reply: `Sure: {"purpose":"Change LAN IP","effects":["LAN address becomes 10.0.0.1"],"risk":"High","related_services":["network"]}`}
+	p := plan.Plan{Commands: []plan.PlannedCommand{{Command: []string{"uci", "set", "network.lan.ipaddr=10.0.0.1"}}}}
+	e, err := Explain(context.Background(), fp, PlanSubject(p), "")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if e.Purpose != "Change LAN IP" || e.Risk != "high" || len(e.RelatedServices) != 1 {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+	if !strings.Contains(fp.prompt, "steps explains each command") {
+		t.Error("expected plan-specific rule in prompt")
+	}
+}
+
+func TestExplain_Errors(t *testing.T) {
+	if _, err := Explain(context.Background(), &fakeProvider{}, ConfigSubject("  "), ""); err == nil {
+		t.Error("expected error for empty subject")
+	}
+	if _, err := Explain(context.Background(), &fakeProvider{reply: `{}`}, ConfigSubject("x"), ""); err == nil {
+		t.Error("expected error for empty explanation")
+	}
+	if _, err := Explain(context.Background(), &fakeProvider{reply: `not json`}, ConfigSubject("x"), ""); err == nil {
+		t.Error("expected error for unparseable reply")
+	}
+}
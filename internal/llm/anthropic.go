@@ -37,9 +37,17 @@ type anthropicReq struct {
 type anthropicResp struct { Content []struct{ Text string `json:"text"` } `json:"content"` }
 
 func (c *AnthropicClient) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
-    var zero plan.Plan
+    text, err := c.Complete(ctx, prompt)
+    if err != nil {
+        return plan.Plan{}, err
+    }
+    return plan.TryUnmarshalPlan(text)
+}
+
+// Complete sends the prompt and returns the raw model text.
+func (c *AnthropicClient) Complete(ctx context.Context, prompt string) (string, error) {
     if c.cfg.AnthropicAPIKey == "" {
-        return zero, errors.New("missing ANTHROPIC_API_KEY")
+        return "", errors.New("missing ANTHROPIC_API_KEY")
     }
     model := c.cfg.Model
     if model == "" {
@@ -53,17 +61,16 @@ func (c *AnthropicClient) GeneratePlan(ctx context.Context, prompt string) (plan
     req.Header.Set("x-api-key", c.cfg.AnthropicAPIKey)
     req.Header.Set("anthropic-version", "2023-06-01")
     resp, err := c.httpClient.Do(req)
-    if err != nil { return zero, err }
+    if err != nil { return "", err }
     defer resp.Body.Close()
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
         data, _ := io.ReadAll(resp.Body)
-        return zero, fmt.Errorf("anthropic http %d: %s", resp.StatusCode, string(data))
+        return "", fmt.Errorf("anthropic http %d: %s", resp.StatusCode, string(data))
     }
     var ar anthropicResp
-    if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil { return zero, err }
-    if len(ar.Content) == 0 { return zero, errors.New("empty response") }
-    text := ar.Content[0].Text
-    return plan.TryUnmarshalPlan(text)
+    if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil { return "", err }
+    if len(ar.Content) == 0 { return "", errors.New("empty response") }
+    return ar.Content[0].Text, nil
 }
 
 
@@ -54,8 +54,25 @@ type generateContentResponse struct {
 
 func (c *GeminiClient) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
     var zero plan.Plan
+    text, err := c.Complete(ctx, prompt)
+    if err != nil {
+        return zero, err
+    }
+    p, err := plan.TryUnmarshalPlan(text)
+    if err != nil {
+        // try to extract JSON if wrapped in text
+        if p2, err2 := plan.TryUnmarshalPlan(extractJSON(text)); err2 == nil && len(p2.Commands) > 0 {
+            return p2, nil
+        }
+        return zero, fmt.Errorf("failed to parse plan: %w", err)
+    }
+    return p, nil
+}
+
+// Complete sends the prompt and returns the raw model text (JSON mode).
+func (c *GeminiClient) Complete(ctx context.Context, prompt string) (string, error) {
     if c.cfg.APIKey == "" {
-        return zero, errors.New("missing API key")
+        return "", errors.New("missing API key")
     }
     model := c.cfg.Model
     if model == "" {
@@ -74,38 +91,28 @@ func (c *GeminiClient) GeneratePlan(ctx context.Context, prompt string) (plan.Pl
 
     httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
     if err != nil {
-        return zero, err
+        return "", err
     }
     httpReq.Header.Set("Content-Type", "application/json")
 
     resp, err := c.httpClient.Do(httpReq)
     if err != nil {
-        return zero, err
+        return "", err
     }
     defer resp.Body.Close()
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
         data, _ := io.ReadAll(resp.Body)
-        return zero, fmt.Errorf("gemini http %d: %s", resp.StatusCode, string(data))
+        return "", fmt.Errorf("gemini http %d: %s", resp.StatusCode, string(data))
     }
 
     var gcr generateContentResponse
     if err := json.NewDecoder(resp.Body).Decode(&gcr); err != nil {
-        return zero, err
+        return "", err
     }
     if len(gcr.Candidates) == 0 || len(gcr.Candidates[0].Content.Parts) == 0 {
-        return zero, errors.New("empty response")
-    }
-    text := gcr.Candidates[0].Content.Parts[0].Text
-    p, err := plan.TryUnmarshalPlan(text)
-    if err != nil {
-        // try to extract JSON if wrapped in text
-        var p2 plan.Plan
-        if json.Unmarshal([]byte(extractJSON(text)), &p2) == nil && len(p2.Commands) > 0 {
-            return p2, nil
-        }
-        return zero, fmt.Errorf("failed to parse plan: %w", err)
+        return "", errors.New("empty response")
     }
-    return p, nil
+    return gcr.Candidates[0].Content.Parts[0].Text, nil
 }
 
 func extractJSON(s string) string {
@@ -20,6 +20,18 @@ func NewExternalGeminiClient(cfg config.Config) *ExternalGeminiClient { return &
 
 func (c *ExternalGeminiClient) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
     var zero plan.Plan
+    text, _ := c.Complete(ctx, prompt)
+    // Try parse JSON plan from output
+    p, err := plan.TryUnmarshalPlan(text)
+    if err == nil && len(p.Commands) > 0 { return p, nil }
+    // try extract
+    p2, err2 := plan.TryUnmarshalPlan(extractJSON(text))
+    if err2 == nil && len(p2.Commands) > 0 { return p2, nil }
+    return zero, errors.New("external gemini did not return a valid plan")
+}
+
+// Complete runs the external gemini CLI and returns its combined output.
+func (c *ExternalGeminiClient) Complete(ctx context.Context, prompt string) (string, error) {
     path := c.cfg.ExternalGeminiPath
     if strings.TrimSpace(path) == "" {
         path = "/usr/bin/gemini"
@@ -31,15 +43,8 @@ func (c *ExternalGeminiClient) GeneratePlan(ctx context.Context, prompt string)
     var out bytes.Buffer
     cmd.Stdout = &out
     cmd.Stderr = &out
-    _ = cmd.Run()
-    text := out.String()
-    // Try parse JSON plan from output
-    p, err := plan.TryUnmarshalPlan(text)
-    if err == nil && len(p.Commands) > 0 { return p, nil }
-    // try extract
-    p2, err2 := plan.TryUnmarshalPlan(extractJSON(text))
-    if err2 == nil && len(p2.Commands) > 0 { return p2, nil }
-    return zero, errors.New("external gemini did not return a valid plan")
+    err := cmd.Run()
+    return out.String(), err
 }
 
 
@@ -39,9 +39,17 @@ type openaiResp struct {
 }
 
 func (c *OpenAIClient) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
-    var zero plan.Plan
+    text, err := c.Complete(ctx, prompt)
+    if err != nil {
+        return plan.Plan{}, err
+    }
+    return plan.TryUnmarshalPlan(text)
+}
+
+// Complete sends the prompt and returns the raw model text (JSON mode).
+func (c *OpenAIClient) Complete(ctx context.Context, prompt string) (string, error) {
     if c.cfg.OpenAIAPIKey == "" {
-        return zero, errors.New("missing OPENAI_API_KEY")
+        return "", errors.New("missing OPENAI_API_KEY")
     }
     model := c.cfg.Model
     if model == "" {
@@ -55,17 +63,16 @@ func (c *OpenAIClient) GeneratePlan(ctx context.Context, prompt string) (plan.Pl
     req.Header.Set("Content-Type", "application/json")
     req.Header.Set("Authorization", "Bearer "+c.cfg.OpenAIAPIKey)
     resp, err := c.httpClient.Do(req)
-    if err != nil { return zero, err }
+    if err != nil { return "", err }
     defer resp.Body.Close()
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
         data, _ := io.ReadAll(resp.Body)
-        return zero, fmt.Errorf("openai http %d: %s", resp.StatusCode, string(data))
+        return "", fmt.Errorf("openai http %d: %s", resp.StatusCode, string(data))
     }
     var or openaiResp
-    if err := json.NewDecoder(resp.Body).Decode(&or); err != nil { return zero, err }
-    if len(or.Choices) == 0 { return zero, errors.New("empty response") }
-    text := or.Choices[0].Message.Content
-    return plan.TryUnmarshalPlan(text)
+    if err := json.NewDecoder(resp.Body).Decode(&or); err != nil { return "", err }
+    if len(or.Choices) == 0 { return "", errors.New("empty response") }
+    return or.Choices[0].Message.Content, nil
 }
 
 
@@ -2,28 +2,54 @@ package llm
 
 import (
     "context"
+    "encoding/json"
+    "fmt"
 
     "github.com/aezizhu/LuciCodex/internal/config"
     "github.com/aezizhu/LuciCodex/internal/plan"
+    "github.com/aezizhu/LuciCodex/internal/redact"
 )
 
 // Provider is the interface implemented by LLM clients that can produce plans.
 type Provider interface {
     GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error)
+    // Complete returns the raw model reply for prompts that do not produce plans.
+    Complete(ctx context.Context, prompt string) (string, error)
 }
 
-// NewProvider returns a Provider based on configuration.
+// NewProvider returns a Provider based on configuration. With cfg.Redact,
+// secrets are redacted from prompts before they leave the device.
 func NewProvider(cfg config.Config) Provider {
+    var p Provider
     switch cfg.Provider {
     case "openai":
-        return NewOpenAIClient(cfg)
+        p = NewOpenAIClient(cfg)
     case "anthropic":
-        return NewAnthropicClient(cfg)
+        p = NewAnthropicClient(cfg)
     case "gemini-cli":
-        return NewExternalGeminiClient(cfg)
+        p = NewExternalGeminiClient(cfg)
     default:
-        return NewGeminiClient(cfg)
+        p = NewGeminiClient(cfg)
     }
+    if cfg.Redact {
+        p = WithRedaction(p, redact.New(cfg))
+    }
+    return p
 }
 
 
+
+// CompleteJSON calls p.Complete and decodes the reply into v, tolerating
+// prose around the JSON object.
+func CompleteJSON(ctx context.Context, p Provider, prompt string, v any) error {
+    text, err := p.Complete(ctx, prompt)
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal([]byte(text), v); err != nil {
+        if err2 := json.Unmarshal([]byte(extractJSON(text)), v); err2 != nil {
+            return fmt.Errorf("failed to parse reply: %w", err)
+        }
+    }
+    return nil
+}
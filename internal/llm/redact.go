@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/redact"
+)
+
+// redactingProvider redacts secrets from every prompt before it reaches the
+// wrapped provider and restores them in the plans it returns.
+type redactingProvider struct {
+	inner    Provider
+	redactor *redact.Redactor
+}
+
+// WithRedaction wraps p so that prompts are redacted by r. Replies from
+// Complete keep their placeholders; only plans get the real values back.
+func WithRedaction(p Provider, r *redact.Redactor) Provider {
+	return &redactingProvider{inner: p, redactor: r}
+}
+
+func (p *redactingProvider) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
+	pl, err := p.inner.GeneratePlan(ctx, p.redactor.Redact(prompt))
+	if err != nil {
+		return pl, err
+	}
+	return p.redactor.RestorePlan(pl)
+}
+
+func (p *redactingProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	return p.inner.Complete(ctx, p.redactor.Redact(prompt))
+}
+
+// RedactOutput redacts the output of a step before it is put in a prompt,
+// keyed on the step's argv; see redact.Redactor.RedactOutput.
+func (p *redactingProvider) RedactOutput(pc plan.PlannedCommand, output string) string {
+	return p.redactor.RedactOutput(pc, output)
+}
+
+// OutputRedactor is implemented by providers that redact command output.
+type OutputRedactor interface {
+	RedactOutput(pc plan.PlannedCommand, output string) string
+}
+
+// RedactOutput returns output redacted by p, or unchanged when p does not
+// redact.
+func RedactOutput(p Provider, pc plan.PlannedCommand, output string) string {
+	if r, ok := p.(OutputRedactor); ok {
+		return r.RedactOutput(pc, output)
+	}
+	return output
+}
+
+// Redactor returns the redactor of p, or nil when p does not redact. Share
+// it with anything else that must hide the plan's secrets, such as the
+// audit log.
+func Redactor(p Provider) *redact.Redactor {
+	if r, ok := p.(*redactingProvider); ok {
+		return r.redactor
+	}
+	return nil
+}
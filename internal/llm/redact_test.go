@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/redact"
+)
+
+// recordingProvider records prompts and replies with a fixed plan.
+type recordingProvider struct {
+	prompts []string
+	plan    plan.Plan
+}
+
+func (f *recordingProvider) GeneratePlan(ctx context.Context, prompt string) (plan.Plan, error) {
+	f.prompts = append(f.prompts, prompt)
+	return f.plan, nil
+}
+
+func (f *recordingProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	return "see __SECRET_1__", nil
+}
+
+func TestWithRedaction(t *testing.T) {
+	inner := &recordingProvider{plan: plan.Plan{Commands: []plan.PlannedCommand{
+		{Command: []string{"uci", "set", "wireless.guest.key=__SECRET_1__"}},
+	}}}
+	p := WithRedaction(inner, redact.New(config.Config{}))
+	facts := "uci show wireless:\nwireless.default_radio0.key='hunter2hunter2'"
+
+	got, err := p.GeneratePlan(context.Background(), facts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(inner.prompts[0], "hunter2hunter2") {
+		t.Fatalf("secret sent to provider: %q", inner.prompts[0])
+	}
+	if got.Commands[0].Command[2] != "wireless.guest.key=hunter2hunter2" {
+		t.Errorf("plan not restored: %q", got.Commands[0].Command)
+	}
+
+	reply, err := p.Complete(context.Background(), "outputs: hunter2hunter2")
+	if err != nil || strings.Contains(inner.prompts[1], "hunter2hunter2") || reply != "see __SECRET_1__" {
+		t.Errorf("Complete: prompt %q reply %q err %v", inner.prompts[1], reply, err)
+	}
+
+	inner.plan.Commands[0].Command[2] = "wireless.guest.key=__SECRET_7__"
+	if _, err := p.GeneratePlan(context.Background(), "x"); err == nil {
+		t.Error("expected error for unknown placeholder")
+	}
+}
+
+func TestNewProvider_Redact(t *testing.T) {
+	if _, ok := NewProvider(config.Config{Redact: true}).(*redactingProvider); !ok {
+		t.Error("expected redacting provider")
+	}
+	if _, ok := NewProvider(config.Config{}).(*GeminiClient); !ok {
+		t.Error("expected plain provider without redact")
+	}
+}
+
+func TestRedactOutput(t *testing.T) {
+	inner := &recordingProvider{}
+	p := WithRedaction(inner, redact.New(config.Config{}))
+	get := plan.PlannedCommand{Command: []string{"uci", "get", "wireless.default_radio0.key"}}
+	out := RedactOutput(p, get, "bare-wifi-secret\n")
+	if strings.Contains(out, "bare-wifi-secret") {
+		t.Fatalf("secret not redacted: %q", out)
+	}
+	if _, err := p.Complete(context.Background(), "the key is bare-wifi-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(inner.prompts[0], "bare-wifi-secret") {
+		t.Errorf("secret sent to provider: %q", inner.prompts[0])
+	}
+	if got := RedactOutput(inner, get, "x\n"); got != "x\n" {
+		t.Errorf("expected output unchanged without redaction, got %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package logging
 
 import (
+    "bytes"
     "encoding/json"
     "fmt"
     "os"
@@ -8,15 +9,29 @@ import (
     "time"
 
     "github.com/aezizhu/LuciCodex/internal/plan"
+    "github.com/aezizhu/LuciCodex/internal/redact"
 )
 
 type Logger struct {
     path string
     mu   sync.Mutex
+    // redact, when set, rewrites every string in logged data
+    redact func(string) string
+    // redactOutput, when set, rewrites the output of each logged result
+    // keyed on its argv, e.g. the bare value printed by a secret uci get
+    redactOutput func(plan.PlannedCommand, string) string
 }
 
 func New(path string) *Logger { return &Logger{path: path} }
 
+// SetRedactor passes every string written to the log through r, and the
+// output of results through r.RedactOutput first. Share the redactor of the
+// provider that generated the plan, which knows the plan's secrets.
+func (l *Logger) SetRedactor(r *redact.Redactor) {
+    l.redact = r.Redact
+    l.redactOutput = r.RedactOutput
+}
+
 func (l *Logger) writeJSON(event string, data any) {
     if l.path == "" {
         return
@@ -28,6 +43,9 @@ func (l *Logger) writeJSON(event string, data any) {
         return
     }
     defer f.Close()
+    if l.redact != nil {
+        data = redactStrings(data, l.redact)
+    }
     entry := map[string]any{
         "ts":    time.Now().UTC().Format(time.RFC3339Nano),
         "event": event,
@@ -47,13 +65,64 @@ func (l *Logger) Plan(prompt string, p plan.Plan) {
 type ResultItem struct {
     Index   int           `json:"index"`
     Command []string      `json:"command"`
+    Pipeline   [][]string `json:"pipeline,omitempty"`
+    StdoutFile string     `json:"stdout_file,omitempty"`
+    WriteFile  string     `json:"write_file,omitempty"`
     Output  string        `json:"output"`
+    ExitCode int          `json:"exit_code"`
+    Signal  string        `json:"signal,omitempty"`
+    TimedOut bool         `json:"timed_out,omitempty"`
     Error   string        `json:"error,omitempty"`
     Elapsed time.Duration `json:"elapsed"`
 }
 
 func (l *Logger) Results(items []ResultItem) {
+    if l.redactOutput != nil {
+        redacted := make([]ResultItem, len(items))
+        for i, it := range items {
+            it.Output = l.redactOutput(plan.PlannedCommand{Command: it.Command, Pipeline: it.Pipeline}, it.Output)
+            redacted[i] = it
+        }
+        items = redacted
+    }
     l.writeJSON("results", items)
 }
 
+func (l *Logger) Answer(prompt string, answer any) {
+    l.writeJSON("answer", map[string]any{"prompt": prompt, "answer": answer})
+}
+
+// redactStrings returns data as a generic JSON value with fn applied to
+// every string, map keys included. Data that cannot be encoded is dropped.
+func redactStrings(data any, fn func(string) string) any {
+    b, err := json.Marshal(data)
+    if err != nil {
+        return nil
+    }
+    dec := json.NewDecoder(bytes.NewReader(b))
+    dec.UseNumber()
+    var v any
+    if err := dec.Decode(&v); err != nil {
+        return nil
+    }
+    return redactValue(v, fn)
+}
 
+func redactValue(v any, fn func(string) string) any {
+    switch t := v.(type) {
+    case string:
+        return fn(t)
+    case []any:
+        for i := range t {
+            t[i] = redactValue(t[i], fn)
+        }
+        return t
+    case map[string]any:
+        m := make(map[string]any, len(t))
+        for k, x := range t {
+            m[fn(k)] = redactValue(x, fn)
+        }
+        return m
+    }
+    return v
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/redact"
+)
+
+func TestResults_RedactsSecretReads(t *testing.T) {
+	// A stand-in uci printing a bare key, with nothing like key= around it.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "uci"), []byte("#!/bin/sh\necho hunter2hunter2\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+	step := plan.PlannedCommand{Command: []string{"uci", "get", "wireless.default_radio0.key"}}
+	res := executor.New(config.Config{TimeoutSeconds: 5}).RunCommand(context.Background(), 0, step)
+	if !strings.Contains(res.Output, "hunter2hunter2") {
+		t.Fatalf("unexpected output %q", res.Output)
+	}
+
+	path := filepath.Join(dir, "audit.log")
+	l := New(path)
+	l.SetRedactor(redact.New(config.Config{}))
+	l.Results([]ResultItem{{Index: res.Index, Command: res.Command, Output: res.Output}})
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log := string(b); strings.Contains(log, "hunter2") || !strings.Contains(log, "__SECRET_1__") {
+		t.Fatalf("expected a placeholder in the log, got %s", log)
+	}
+}
@@ -0,0 +1,123 @@
+package openwrt
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+func init() {
+	RegisterCollector(collector{"system", []string{"system", "firmware", "version", "uptime", "memory", "load", "board", "model", "reboot"}, collectSystem, 30 * time.Second})
+	RegisterCollector(collector{"network", []string{"network", "lan", "wan", "ip", "ipv6", "address", "subnet", "dns", "pppoe", "vlan", "bridge", "gateway"}, uciCollector("network"), 10 * time.Minute})
+	RegisterCollector(collector{"wireless", []string{"wifi", "wi-fi", "wireless", "ssid", "wlan", "radio", "channel", "wpa", "guest"}, collectWireless, time.Minute})
+	RegisterCollector(collector{"firewall", []string{"firewall", "port", "forward", "forwarding", "nat", "zone", "block", "allow", "open", "redirect", "masquerade", "fw4"}, uciCollector("firewall"), 10 * time.Minute})
+	RegisterCollector(collector{"dhcp", []string{"dhcp", "lease", "leases", "client", "clients", "device", "devices", "connected", "hostname", "static", "dnsmasq"}, collectDHCP, time.Minute})
+	RegisterCollector(collector{"packages", []string{"package", "packages", "opkg", "install", "installed", "upgrade", "luci-app", "module"}, collectPackages, 10 * time.Minute})
+	RegisterCollector(collector{"interfaces", []string{"interface", "interfaces", "status", "link", "up", "down", "online", "connection", "wan", "traffic"}, collectInterfaces, 30 * time.Second})
+	RegisterCollector(collector{"routes", []string{"route", "routes", "routing", "gateway", "default route", "metric"}, collectRoutes, 30 * time.Second})
+}
+
+// collector is a FactsCollector backed by a function. UCI topics have long
+// TTLs because config changes invalidate the cache anyway.
+type collector struct {
+	name     string
+	keywords []string
+	collect  func(ctx context.Context, r *Router) (any, error)
+	ttl      time.Duration
+}
+
+func (c collector) Name() string       { return c.name }
+func (c collector) Keywords() []string { return c.keywords }
+func (c collector) TTL() time.Duration { return c.ttl }
+func (c collector) Collect(ctx context.Context, r *Router) (any, error) {
+	return c.collect(ctx, r)
+}
+
+// uciCollector returns the sections of a UCI package.
+func uciCollector(pkg string) func(ctx context.Context, r *Router) (any, error) {
+	return func(ctx context.Context, r *Router) (any, error) {
+		return r.UCI(ctx, pkg)
+	}
+}
+
+func collectSystem(ctx context.Context, r *Router) (any, error) {
+	var facts struct {
+		Board *BoardInfo  `json:"board,omitempty"`
+		Info  *SystemInfo `json:"info,omitempty"`
+	}
+	if b, err := r.Board(ctx); err == nil {
+		facts.Board = &b
+	}
+	if s, err := r.SystemInfo(ctx); err == nil {
+		facts.Info = &s
+	}
+	if facts.Board == nil && facts.Info == nil {
+		return nil, errors.New("system: ubus unavailable")
+	}
+	return facts, nil
+}
+
+func collectWireless(ctx context.Context, r *Router) (any, error) {
+	var facts struct {
+		Config []UCISection   `json:"config,omitempty"`
+		Status []WirelessInfo `json:"status,omitempty"`
+	}
+	facts.Config, _ = r.UCI(ctx, "wireless")
+	facts.Status, _ = r.Wireless(ctx)
+	if facts.Config == nil && facts.Status == nil {
+		return nil, errors.New("wireless: no data")
+	}
+	return facts, nil
+}
+
+func collectDHCP(ctx context.Context, r *Router) (any, error) {
+	var facts struct {
+		Leases []Lease      `json:"leases"`
+		Hosts  []HostHint   `json:"hosts,omitempty"`
+		Config []UCISection `json:"config,omitempty"`
+	}
+	leases, err := r.DHCPLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	facts.Leases = leases
+	facts.Hosts, _ = r.HostHints(ctx)
+	facts.Config, _ = r.UCI(ctx, "dhcp")
+	return facts, nil
+}
+
+func collectPackages(ctx context.Context, r *Router) (any, error) {
+	return r.Packages(ctx)
+}
+
+func collectInterfaces(ctx context.Context, r *Router) (any, error) {
+	ifaces, err := r.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Routes are reported by the routes topic.
+	for i := range ifaces {
+		ifaces[i].Routes = nil
+	}
+	return ifaces, nil
+}
+
+// interfaceRoute is a Route with the interface it belongs to.
+type interfaceRoute struct {
+	Interface string `json:"interface"`
+	Route
+}
+
+func collectRoutes(ctx context.Context, r *Router) (any, error) {
+	ifaces, err := r.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	routes := []interfaceRoute{}
+	for _, i := range ifaces {
+		for _, rt := range i.Routes {
+			routes = append(routes, interfaceRoute{Interface: i.Interface, Route: rt})
+		}
+	}
+	return routes, nil
+}
@@ -1,59 +1,218 @@
 package openwrt
 
 import (
-    "bytes"
     "context"
-    "os/exec"
+    "encoding/json"
+    "regexp"
+    "sort"
     "strings"
+    "sync"
     "time"
 )
 
-// CollectFacts gathers lightweight, non-destructive environment information
-// to improve planning quality. It tolerates missing tools and timeouts.
-func CollectFacts(ctx context.Context) string {
+// DefaultFactsTokenBudget is the approximate token limit of the facts block.
+const DefaultFactsTokenBudget = 2000
+
+// FactsCollector gathers one topic of environment facts as structured data.
+type FactsCollector interface {
+    // Name identifies the topic, e.g. "wireless".
+    Name() string
+    // Keywords select the collector when one appears in the prompt.
+    Keywords() []string
+    // Collect returns a JSON-encodable value. Unavailable ubus objects are
+    // errors.
+    Collect(ctx context.Context, r *Router) (any, error)
+}
+
+var (
+    registryMu sync.Mutex
+    registry   []FactsCollector
+    // defaultTopics are collected when the prompt matches no keyword.
+    defaultTopics = []string{"system", "network", "wireless", "firewall"}
+)
+
+// RegisterCollector adds c to the registry. It panics if the name is taken.
+func RegisterCollector(c FactsCollector) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    for _, r := range registry {
+        if r.Name() == c.Name() {
+            panic("openwrt: duplicate facts collector " + c.Name())
+        }
+    }
+    registry = append(registry, c)
+}
+
+// Collectors returns the registered collectors in registration order.
+func Collectors() []FactsCollector {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+    return append([]FactsCollector(nil), registry...)
+}
+
+// SelectCollectors returns the collectors relevant to prompt, most relevant
+// first. "system" is always included; a prompt matching no keyword selects
+// the default topics.
+func SelectCollectors(prompt string) []FactsCollector {
+    all := Collectors()
+    words := strings.ToLower(prompt)
+    score := map[string]int{}
+    matched := false
+    for _, c := range all {
+        for _, k := range c.Keywords() {
+            if keywordRE(k).MatchString(words) {
+                score[c.Name()]++
+                matched = true
+            }
+        }
+    }
+    if !matched {
+        for _, name := range defaultTopics {
+            score[name] = 1
+        }
+    }
+    var out []FactsCollector
+    for _, c := range all {
+        if c.Name() == "system" || score[c.Name()] > 0 {
+            out = append(out, c)
+        }
+    }
+    sort.SliceStable(out, func(i, j int) bool {
+        if (out[i].Name() == "system") != (out[j].Name() == "system") {
+            return out[i].Name() == "system"
+        }
+        return score[out[i].Name()] > score[out[j].Name()]
+    })
+    return out
+}
+
+func keywordRE(k string) *regexp.Regexp {
+    return regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(k)) + `\b`)
+}
+
+// Fact is the collected data of one topic.
+type Fact struct {
+    Name string          `json:"name"`
+    Data json.RawMessage `json:"data"`
+}
+
+// FactsSnapshot is the result of one collection.
+type FactsSnapshot struct {
+    Facts []Fact `json:"facts"`
+    // Omitted lists selected topics dropped to stay within the token budget.
+    Omitted []string `json:"omitted,omitempty"`
+}
+
+// FactsOptions controls CollectFactsSnapshot.
+type FactsOptions struct {
+    // Prompt selects collectors by topic.
+    Prompt string
+    // TokenBudget limits the rendered facts; 0 uses DefaultFactsTokenBudget.
+    TokenBudget int
+    // Router is queried for facts; nil uses the system ubus.
+    Router *Router
+    // Cache, if set, serves fresh facts and stores newly collected ones.
+    Cache *FactsCache
+    // Refresh collects every topic again instead of reading the cache.
+    Refresh bool
+    // All collects every registered topic regardless of the prompt and
+    // token budget.
+    All bool
+}
+
+// CollectFactsSnapshot runs the collectors selected for opts.Prompt
+// concurrently and keeps, in order of relevance, those that fit the token
+// budget. Collectors that fail, e.g. because ubus is missing, are skipped.
+// Topics cached within their TTL are not collected again.
+func CollectFactsSnapshot(ctx context.Context, opts FactsOptions) FactsSnapshot {
     // Apply an overall cap
     ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
     defer cancel()
+    router := opts.Router
+    if router == nil {
+        router = NewRouter(NewUbus(""))
+    }
+    budget := opts.TokenBudget
+    if budget <= 0 {
+        budget = DefaultFactsTokenBudget
+    }
 
-    var b bytes.Buffer
-    add := func(name string, out string) {
-        out = strings.TrimSpace(out)
-        if out == "" {
-            return
+    selected := SelectCollectors(opts.Prompt)
+    if opts.All {
+        selected = Collectors()
+        budget = 0
+    }
+    if opts.Cache != nil {
+        opts.Cache.checkConfig()
+    }
+    data := make([]json.RawMessage, len(selected))
+    var wg sync.WaitGroup
+    for i, c := range selected {
+        if opts.Cache != nil && !opts.Refresh {
+            if b, ok := opts.Cache.get(c.Name(), FactsTTL(c)); ok {
+                data[i] = b
+                continue
+            }
         }
-        if b.Len() > 0 {
-            b.WriteString("\n\n")
+        wg.Add(1)
+        go func(i int, c FactsCollector) {
+            defer wg.Done()
+            v, err := c.Collect(ctx, router)
+            if err != nil || v == nil {
+                return
+            }
+            if b, err := json.Marshal(v); err == nil {
+                data[i] = b
+                if opts.Cache != nil {
+                    opts.Cache.put(c.Name(), b)
+                }
+            }
+        }(i, c)
+    }
+    wg.Wait()
+
+    var snap FactsSnapshot
+    used := 0
+    for i, c := range selected {
+        if data[i] == nil {
+            continue
         }
-        b.WriteString(name)
-        b.WriteString(":\n")
-        // limit very large outputs
-        const max = 4096
-        if len(out) > max {
-            out = out[:max]
+        f := Fact{Name: c.Name(), Data: data[i]}
+        n := EstimateTokens(renderFact(f))
+        if budget > 0 && used+n > budget {
+            snap.Omitted = append(snap.Omitted, f.Name)
+            continue
         }
-        b.WriteString(out)
+        used += n
+        snap.Facts = append(snap.Facts, f)
     }
-
-    add("/etc/os-release", run(ctx, "cat", "/etc/os-release"))
-    add("uname -a", run(ctx, "uname", "-a"))
-    add("ubus system board", run(ctx, "ubus", "call", "system", "board", "{}"))
-    add("uci show network", run(ctx, "uci", "-q", "show", "network"))
-    add("uci show wireless", run(ctx, "uci", "-q", "show", "wireless"))
-    add("fw4 print", run(ctx, "fw4", "print"))
-    return b.String()
+    return snap
 }
 
-func run(ctx context.Context, name string, args ...string) string {
-    // short per-command timeout inside the overall budget
-    cctx, cancel := context.WithTimeout(ctx, 1*time.Second)
-    defer cancel()
-    cmd := exec.CommandContext(cctx, name, args...)
-    // minimal env: rely on PATH
-    out, err := cmd.CombinedOutput()
-    if err != nil {
-        return ""
+// String renders the snapshot as the facts block of a prompt.
+func (s FactsSnapshot) String() string {
+    parts := make([]string, 0, len(s.Facts)+1)
+    for _, f := range s.Facts {
+        parts = append(parts, renderFact(f))
+    }
+    if len(s.Omitted) > 0 {
+        parts = append(parts, "omitted (token budget): "+strings.Join(s.Omitted, ", "))
     }
-    return string(out)
+    return strings.Join(parts, "\n\n")
 }
 
+func renderFact(f Fact) string {
+    return f.Name + ":\n" + string(f.Data)
+}
+
+// EstimateTokens approximates the token count of s at four bytes per token.
+func EstimateTokens(s string) int {
+    return (len(s) + 3) / 4
+}
 
+// CollectFacts gathers lightweight, non-destructive environment information
+// relevant to prompt to improve planning quality. It tolerates a missing ubus
+// and timeouts.
+func CollectFacts(ctx context.Context, prompt string, tokenBudget int) string {
+    return CollectFactsSnapshot(ctx, FactsOptions{Prompt: prompt, TokenBudget: tokenBudget}).String()
+}
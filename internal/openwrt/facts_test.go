@@ -0,0 +1,125 @@
+package openwrt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var routerReplies = map[string]string{
+	"system board":                 `{"model":"Xiaomi Mi Router 4A","hostname":"OpenWrt","release":{"version":"23.05.3"}}`,
+	"system info":                  `{"uptime":3600,"load":[1024,2048,4096]}`,
+	`uci get {"config":"network"}`: `{"values":{"lan":{".anonymous":false,".type":"interface",".name":"lan",".index":1,"proto":"static","ipaddr":"192.168.1.1"}}}`,
+	`uci get {"config":"dhcp"}`:    `{"values":{"lan":{".anonymous":false,".type":"dhcp",".name":"lan",".index":0,"interface":"lan"}}}`,
+	"luci-rpc getDHCPLeases":       `{"dhcp_leases":[{"expires":3600,"hostname":"phone","macaddr":"aa:bb:cc:dd:ee:01","ipaddr":"192.168.1.23"},{"expires":3500,"macaddr":"aa:bb:cc:dd:ee:02","ipaddr":"192.168.1.24"}]}`,
+	"rpc-sys packagelist":          `{"packages":{"luci":"git-24.086","base-files":"1555-r23809"}}`,
+	"network.interface dump":       `{"interface":[{"interface":"wan","up":true,"proto":"dhcp","l3_device":"wan","ipv4-address":[{"address":"203.0.113.5","mask":24}],"route":[{"target":"0.0.0.0","mask":0,"nexthop":"203.0.113.1","metric":0}]}]}`,
+}
+
+func names(cs []FactsCollector) []string {
+	var out []string
+	for _, c := range cs {
+		out = append(out, c.Name())
+	}
+	return out
+}
+
+func TestSelectCollectors(t *testing.T) {
+	cases := []struct {
+		prompt string
+		want   []string
+	}{
+		{"change the wifi password of the guest ssid", []string{"system", "wireless"}},
+		{"which devices are connected to DHCP?", []string{"system", "dhcp"}},
+		{"install luci-app-sqm package", []string{"system", "packages"}},
+		{"show the default route", []string{"system", "routes"}},
+		{"make me a sandwich", []string{"system", "network", "wireless", "firewall"}},
+	}
+	for _, tc := range cases {
+		if got := names(SelectCollectors(tc.prompt)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.prompt, got, tc.want)
+		}
+	}
+	// More keyword hits rank first.
+	got := names(SelectCollectors("open port 22 on the wan firewall zone"))
+	if len(got) < 3 || got[0] != "system" || got[1] != "firewall" {
+		t.Errorf("expected firewall ranked after system, got %v", got)
+	}
+}
+
+func TestCollectFactsSnapshot(t *testing.T) {
+	snap := CollectFactsSnapshot(context.Background(), FactsOptions{
+		Prompt: "list dhcp leases",
+		Router: NewRouter(fakeUbus(routerReplies)),
+	})
+	if len(snap.Facts) != 2 || snap.Facts[0].Name != "system" || snap.Facts[1].Name != "dhcp" {
+		t.Fatalf("unexpected facts %+v", snap)
+	}
+	var dhcp struct {
+		Leases []Lease `json:"leases"`
+	}
+	if err := json.Unmarshal(snap.Facts[1].Data, &dhcp); err != nil {
+		t.Fatal(err)
+	}
+	if len(dhcp.Leases) != 2 || dhcp.Leases[0].Hostname != "phone" || dhcp.Leases[1].Hostname != "" {
+		t.Errorf("leases: %+v", dhcp.Leases)
+	}
+	s := snap.String()
+	if !strings.HasPrefix(s, "system:\n{") || !strings.Contains(s, "\n\ndhcp:\n") {
+		t.Errorf("rendered facts:\n%s", s)
+	}
+}
+
+func TestCollectFactsSnapshot_Budget(t *testing.T) {
+	replies := map[string]string{}
+	for k, v := range routerReplies {
+		replies[k] = v
+	}
+	pkgs := map[string]string{}
+	for i := 0; i < 200; i++ {
+		pkgs[fmt.Sprintf("kmod-something-long-%d", i)] = "5.15.150-1"
+	}
+	b, _ := json.Marshal(map[string]any{"packages": pkgs})
+	replies["rpc-sys packagelist"] = string(b)
+	snap := CollectFactsSnapshot(context.Background(), FactsOptions{
+		Prompt:      "which packages are installed on the wan interface",
+		TokenBudget: 200,
+		Router:      NewRouter(fakeUbus(replies)),
+	})
+	for _, f := range snap.Facts {
+		if f.Name == "packages" {
+			t.Fatal("packages exceed the budget and must be omitted")
+		}
+	}
+	if !reflect.DeepEqual(snap.Omitted, []string{"packages"}) {
+		t.Errorf("omitted: %v", snap.Omitted)
+	}
+	if EstimateTokens(snap.String()) > 220 {
+		t.Errorf("facts exceed budget: %d tokens", EstimateTokens(snap.String()))
+	}
+	if !strings.Contains(snap.String(), "omitted (token budget): packages") {
+		t.Error("omitted topics must be listed")
+	}
+}
+
+func TestCollectFactsSnapshot_NoUbus(t *testing.T) {
+	r := NewRouter(fakeUbus(nil))
+	r.readFile = func(string) ([]byte, error) { return nil, errors.New("no such file") }
+	snap := CollectFactsSnapshot(context.Background(), FactsOptions{Router: r})
+	if len(snap.Facts) != 0 || snap.String() != "" {
+		t.Errorf("expected no facts, got %+v", snap)
+	}
+}
+
+func TestRegisterCollector_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for duplicate name")
+		}
+	}()
+	RegisterCollector(collector{name: "system"})
+}
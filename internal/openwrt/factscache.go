@@ -0,0 +1,166 @@
+package openwrt
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultFactsTTL is how long facts of a collector without a TTL are cached.
+const DefaultFactsTTL = time.Minute
+
+// FactsTTL returns how long c's facts may be served from a FactsCache. A
+// collector sets it by implementing TTL() time.Duration.
+func FactsTTL(c FactsCollector) time.Duration {
+	if t, ok := c.(interface{ TTL() time.Duration }); ok {
+		return t.TTL()
+	}
+	return DefaultFactsTTL
+}
+
+// FactsCache keeps collected facts between prompts and, with a path, between
+// invocations. Entries expire after their collector's TTL and become stale
+// when a file in the config directory changes or Invalidate is called. Stale
+// entries are no longer served but remain the baseline for a facts diff.
+type FactsCache struct {
+	path      string
+	configDir string
+	now       func() time.Time
+
+	mu    sync.Mutex
+	state factsCacheState
+}
+
+type factsCacheState struct {
+	// Config maps the files of the config directory to their mtime.
+	Config  map[string]int64           `json:"config"`
+	Entries map[string]factsCacheEntry `json:"entries"`
+}
+
+type factsCacheEntry struct {
+	Collected time.Time       `json:"collected"`
+	Data      json.RawMessage `json:"data"`
+	Stale     bool            `json:"stale,omitempty"`
+}
+
+// OpenFactsCache returns a cache persisted at path, loading any previous
+// contents. An unreadable file starts an empty cache; an empty path keeps
+// the cache in memory only.
+func OpenFactsCache(path string) *FactsCache {
+	c := &FactsCache{path: path, configDir: "/etc/config", now: time.Now}
+	if path != "" {
+		if b, err := os.ReadFile(path); err == nil {
+			_ = json.Unmarshal(b, &c.state)
+		}
+	}
+	if c.state.Entries == nil {
+		c.state.Entries = map[string]factsCacheEntry{}
+	}
+	return c
+}
+
+// get returns the cached facts of name if they are fresh.
+func (c *FactsCache) get(name string, ttl time.Duration) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.state.Entries[name]
+	if !ok || e.Stale || c.now().Sub(e.Collected) >= ttl {
+		return nil, false
+	}
+	return e.Data, true
+}
+
+func (c *FactsCache) put(name string, data json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Entries[name] = factsCacheEntry{Collected: c.now(), Data: data}
+}
+
+// checkConfig marks every entry stale when the config directory changed
+// since the last check.
+func (c *FactsCache) checkConfig() {
+	mtimes := map[string]int64{}
+	entries, _ := os.ReadDir(c.configDir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			mtimes[e.Name()] = info.ModTime().UnixNano()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Config != nil && !sameMtimes(c.state.Config, mtimes) {
+		c.markStale()
+	}
+	c.state.Config = mtimes
+}
+
+func sameMtimes(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Invalidate marks every entry stale, e.g. after a plan was executed.
+func (c *FactsCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.markStale()
+}
+
+func (c *FactsCache) markStale() {
+	for name, e := range c.state.Entries {
+		e.Stale = true
+		c.state.Entries[name] = e
+	}
+}
+
+// Snapshot returns every cached topic, stale or not, in registration order.
+func (c *FactsCache) Snapshot() FactsSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var snap FactsSnapshot
+	for _, col := range Collectors() {
+		if e, ok := c.state.Entries[col.Name()]; ok {
+			snap.Facts = append(snap.Facts, Fact{Name: col.Name(), Data: e.Data})
+		}
+	}
+	return snap
+}
+
+// Save writes the cache to its path. Facts may contain secrets, so the file
+// is readable by its owner only.
+func (c *FactsCache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	b, err := json.Marshal(c.state)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".facts-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
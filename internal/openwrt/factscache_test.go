@@ -0,0 +1,159 @@
+package openwrt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingUbus counts the calls made to a fakeUbus per "object method".
+type countingUbus struct {
+	fakeUbus
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingUbus) Call(ctx context.Context, object, method string, args any) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.calls[object+" "+method]++
+	c.mu.Unlock()
+	return c.fakeUbus.Call(ctx, object, method, args)
+}
+
+func newTestCache(t *testing.T) (*FactsCache, *time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	c := OpenFactsCache(filepath.Join(dir, "facts.json"))
+	c.configDir = filepath.Join(dir, "config")
+	if err := os.Mkdir(c.configDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(c.configDir, "network"), []byte("config interface 'lan'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestFactsCache_TTL(t *testing.T) {
+	cache, now := newTestCache(t)
+	u := &countingUbus{fakeUbus: routerReplies, calls: map[string]int{}}
+	opts := FactsOptions{Prompt: "list dhcp leases", Router: NewRouter(u), Cache: cache}
+
+	first := CollectFactsSnapshot(context.Background(), opts)
+	second := CollectFactsSnapshot(context.Background(), opts)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached snapshot differs:\n%v\n%v", first, second)
+	}
+	if u.calls["system board"] != 1 || u.calls["luci-rpc getDHCPLeases"] != 1 {
+		t.Errorf("fresh facts were collected again: %v", u.calls)
+	}
+
+	// system expires after 30s, dhcp after a minute.
+	*now = now.Add(45 * time.Second)
+	CollectFactsSnapshot(context.Background(), opts)
+	if u.calls["system board"] != 2 || u.calls["luci-rpc getDHCPLeases"] != 1 {
+		t.Errorf("unexpected calls after 45s: %v", u.calls)
+	}
+
+	opts.Refresh = true
+	CollectFactsSnapshot(context.Background(), opts)
+	if u.calls["system board"] != 3 || u.calls["luci-rpc getDHCPLeases"] != 2 {
+		t.Errorf("refresh must collect again: %v", u.calls)
+	}
+}
+
+func TestFactsCache_Invalidation(t *testing.T) {
+	cache, _ := newTestCache(t)
+	u := &countingUbus{fakeUbus: routerReplies, calls: map[string]int{}}
+	opts := FactsOptions{Prompt: "show the lan network", Router: NewRouter(u), Cache: cache}
+	uciGet := `uci get`
+
+	CollectFactsSnapshot(context.Background(), opts)
+	CollectFactsSnapshot(context.Background(), opts)
+	if u.calls[uciGet] != 1 {
+		t.Fatalf("uci get calls: %d", u.calls[uciGet])
+	}
+
+	// A config file changing makes every entry stale.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(cache.configDir, "network"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	CollectFactsSnapshot(context.Background(), opts)
+	if u.calls[uciGet] != 2 {
+		t.Errorf("config change must invalidate, uci get calls: %d", u.calls[uciGet])
+	}
+
+	cache.Invalidate()
+	CollectFactsSnapshot(context.Background(), opts)
+	if u.calls[uciGet] != 3 {
+		t.Errorf("Invalidate must invalidate, uci get calls: %d", u.calls[uciGet])
+	}
+}
+
+func TestFactsCache_Persistence(t *testing.T) {
+	cache, _ := newTestCache(t)
+	CollectFactsSnapshot(context.Background(), FactsOptions{Prompt: "list dhcp leases", Router: NewRouter(fakeUbus(routerReplies)), Cache: cache})
+	cache.Invalidate()
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(cache.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("cache file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	reopened := OpenFactsCache(cache.path)
+	if got := factNames(reopened.Snapshot()); !reflect.DeepEqual(got, []string{"system", "dhcp"}) {
+		t.Errorf("reopened snapshot topics %v", got)
+	}
+	if _, ok := reopened.get("system", time.Hour); ok {
+		t.Error("stale entries must not be served after reopening")
+	}
+}
+
+func factNames(s FactsSnapshot) []string {
+	var out []string
+	for _, f := range s.Facts {
+		out = append(out, f.Name)
+	}
+	return out
+}
+
+func TestDiffFacts(t *testing.T) {
+	old := FactsSnapshot{Facts: []Fact{
+		{Name: "system", Data: json.RawMessage(`{"board":{"hostname":"OpenWrt"},"info":{"uptime":100,"memory":{"free":1}}}`)},
+		{Name: "firewall", Data: json.RawMessage(`[{"name":"@zone[0]","type":"zone","options":{"name":"lan","input":"ACCEPT"}},{"name":"@zone[1]","type":"zone","options":{"name":"wan"}}]`)},
+		{Name: "dhcp", Data: json.RawMessage(`{"leases":[{"expires":10,"mac":"aa:bb:cc:dd:ee:01","ip":"192.168.1.23"}]}`)},
+		{Name: "routes", Data: json.RawMessage(`[]`)},
+	}}
+	cur := FactsSnapshot{Facts: []Fact{
+		{Name: "system", Data: json.RawMessage(`{"board":{"hostname":"gw"},"info":{"uptime":200,"memory":{"free":2}}}`)},
+		{Name: "firewall", Data: json.RawMessage(`[{"name":"@zone[0]","type":"zone","options":{"name":"lan","input":"REJECT"}},{"name":"@zone[1]","type":"zone","options":{"name":"wan"}}]`)},
+		{Name: "dhcp", Data: json.RawMessage(`{"leases":[{"expires":5,"mac":"aa:bb:cc:dd:ee:02","ip":"192.168.1.24"},{"expires":20,"mac":"aa:bb:cc:dd:ee:01","ip":"192.168.1.23"}]}`)},
+		{Name: "packages", Data: json.RawMessage(`[{"name":"luci"}]`)},
+	}}
+	got := DiffFacts(old, cur)
+	want := []FactChange{
+		{Topic: "system", Path: "board.hostname", Old: `"OpenWrt"`, New: `"gw"`},
+		{Topic: "firewall", Path: "[@zone[0]].options.input", Old: `"ACCEPT"`, New: `"REJECT"`},
+		{Topic: "dhcp", Path: "leases[aa:bb:cc:dd:ee:02].ip", New: `"192.168.1.24"`},
+		{Topic: "dhcp", Path: "leases[aa:bb:cc:dd:ee:02].mac", New: `"aa:bb:cc:dd:ee:02"`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if DiffFacts(cur, cur) != nil {
+		t.Error("identical snapshots must have no changes")
+	}
+}
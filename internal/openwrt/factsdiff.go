@@ -0,0 +1,132 @@
+package openwrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// FactChange is one value that differs between two facts snapshots. Old and
+// New hold JSON values; Old is empty for added values and New for removed
+// ones.
+type FactChange struct {
+	Topic string `json:"topic"`
+	Path  string `json:"path"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// volatileFacts are keys whose values change on their own, such as uptime
+// and counters, and would drown real changes in a diff.
+var volatileFacts = map[string][]string{
+	"system":     {"localtime", "uptime", "load", "memory"},
+	"wireless":   {"signal", "noise"},
+	"dhcp":       {"expires"},
+	"interfaces": {"uptime"},
+}
+
+// identityKeys name the field identifying an element of a list, so that
+// inserting an element does not report every following one as changed.
+var identityKeys = []string{"name", "interface", "device", "mac", "target"}
+
+// DiffFacts compares the topics present in both snapshots and returns the
+// changed values ordered by topic and path. Topics missing from either
+// snapshot are not compared.
+func DiffFacts(old, new FactsSnapshot) []FactChange {
+	before := map[string]json.RawMessage{}
+	for _, f := range old.Facts {
+		before[f.Name] = f.Data
+	}
+	var out []FactChange
+	for _, f := range new.Facts {
+		prev, ok := before[f.Name]
+		if !ok {
+			continue
+		}
+		a, b := flattenFact(f.Name, prev), flattenFact(f.Name, f.Data)
+		var paths []string
+		for p := range a {
+			paths = append(paths, p)
+		}
+		for p := range b {
+			if _, ok := a[p]; !ok {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if a[p] != b[p] {
+				out = append(out, FactChange{Topic: f.Name, Path: p, Old: a[p], New: b[p]})
+			}
+		}
+	}
+	return out
+}
+
+// flattenFact maps the leaf paths of a topic's data to their JSON values.
+func flattenFact(topic string, data json.RawMessage) map[string]string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	out := map[string]string{}
+	if err := dec.Decode(&v); err != nil {
+		out[""] = string(data)
+		return out
+	}
+	skip := map[string]bool{}
+	for _, k := range volatileFacts[topic] {
+		skip[k] = true
+	}
+	flatten(v, "", skip, out)
+	return out
+}
+
+func flatten(v any, path string, skip map[string]bool, out map[string]string) {
+	switch x := v.(type) {
+	case map[string]any:
+		if len(x) == 0 {
+			out[path] = "{}"
+		}
+		for k, e := range x {
+			if skip[k] {
+				continue
+			}
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			flatten(e, p, skip, out)
+		}
+	case []any:
+		if len(x) == 0 {
+			out[path] = "[]"
+		}
+		seen := map[string]bool{}
+		for i, e := range x {
+			key := elementKey(e)
+			if key == "" || seen[key] {
+				key = fmt.Sprint(i)
+			}
+			seen[key] = true
+			flatten(e, path+"["+key+"]", skip, out)
+		}
+	default:
+		b, _ := json.Marshal(x)
+		out[path] = string(b)
+	}
+}
+
+// elementKey returns the identity of a list element, or "".
+func elementKey(v any) string {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return ""
+	}
+	for _, k := range identityKeys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package openwrt
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// OpkgStatusFile is the opkg database of installed packages.
+const OpkgStatusFile = "/usr/lib/opkg/status"
+
+// OpkgPackage is a control record from "opkg info", a package list or the
+// opkg status file.
+type OpkgPackage struct {
+	Name         string
+	Version      string
+	Architecture string
+	// Depends holds one entry per dependency, each listing the
+	// alternatives of "a | b"; version constraints are dropped.
+	Depends  [][]string
+	Provides []string
+	// InstalledSize and Size (the download size) are in bytes, 0 when
+	// unknown.
+	InstalledSize int64
+	Size          int64
+	Installed     bool
+}
+
+// ParseOpkgControl parses the blank-line separated control records printed
+// by "opkg info" and stored in the opkg status file.
+func ParseOpkgControl(b []byte) []OpkgPackage {
+	var out []OpkgPackage
+	var cur OpkgPackage
+	flush := func() {
+		if cur.Name != "" {
+			out = append(out, cur)
+		}
+		cur = OpkgPackage{}
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue // continuation lines of Description
+		}
+		v = strings.TrimSpace(v)
+		switch k {
+		case "Package":
+			if cur.Name != "" {
+				flush()
+			}
+			cur.Name = v
+		case "Version":
+			cur.Version = v
+		case "Architecture":
+			cur.Architecture = v
+		case "Depends":
+			for _, dep := range strings.Split(v, ",") {
+				var alts []string
+				for _, alt := range strings.Split(dep, "|") {
+					if name := packageName(alt); name != "" {
+						alts = append(alts, name)
+					}
+				}
+				if len(alts) > 0 {
+					cur.Depends = append(cur.Depends, alts)
+				}
+			}
+		case "Provides":
+			for _, p := range strings.Split(v, ",") {
+				if name := packageName(p); name != "" {
+					cur.Provides = append(cur.Provides, name)
+				}
+			}
+		case "Installed-Size":
+			cur.InstalledSize, _ = strconv.ParseInt(v, 10, 64)
+		case "Size":
+			cur.Size, _ = strconv.ParseInt(v, 10, 64)
+		case "Status":
+			cur.Installed = strings.HasSuffix(v, " installed")
+		}
+	}
+	flush()
+	return out
+}
+
+// packageName strips a version constraint such as "(>= 1.2)" from a
+// dependency.
+func packageName(dep string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(dep), " ")
+	name, _, _ = strings.Cut(name, "(")
+	return strings.TrimSpace(name)
+}
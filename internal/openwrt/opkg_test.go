@@ -0,0 +1,36 @@
+package openwrt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOpkgControl(t *testing.T) {
+	in := `Package: luci-app-sqm
+Version: 1.2-1
+Depends: libc, sqm-scripts (>= 1.4), luci-lib-jsonc | luci-lib-json
+Architecture: all
+Installed-Size: 12288
+Size: 4821
+Description: Control the simple_qos SQM script
+ with a second line.
+
+Package: dnsmasq-full
+Version: 2.90-1
+Provides: dnsmasq
+Status: install user installed
+Architecture: mipsel_24kc
+`
+	got := ParseOpkgControl([]byte(in))
+	want := []OpkgPackage{
+		{
+			Name: "luci-app-sqm", Version: "1.2-1", Architecture: "all",
+			Depends:       [][]string{{"libc"}, {"sqm-scripts"}, {"luci-lib-jsonc", "luci-lib-json"}},
+			InstalledSize: 12288, Size: 4821,
+		},
+		{Name: "dnsmasq-full", Version: "2.90-1", Architecture: "mipsel_24kc", Provides: []string{"dnsmasq"}, Installed: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
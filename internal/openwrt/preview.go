@@ -0,0 +1,181 @@
+package openwrt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/diff"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// PreviewOptions controls where the UCI preview reads configuration from.
+type PreviewOptions struct {
+	ConfigDir string // defaults to /etc/config
+	UCIPath   string // defaults to "uci" from PATH
+}
+
+// uciWrite is a state-changing uci invocation found in a plan.
+type uciWrite struct {
+	index int
+	pkg   string
+	args  []string
+	err   string
+}
+
+// uciWrites extracts the uci commands of a plan that modify configuration.
+// Options that redirect uci to other files (-c/-f/-p/-P/-t) cannot be
+// previewed faithfully and are reported as errors.
+func uciWrites(p plan.Plan) []uciWrite {
+	var writes []uciWrite
+	for i, c := range p.Commands {
+		uc, ok := ParseUCICommand(c.Command)
+		if !ok || !uc.IsWrite() {
+			continue
+		}
+		w := uciWrite{index: i, pkg: uc.Package, args: append([]string{uc.Sub}, uc.Args...)}
+		switch {
+		case uc.HasOption("-c", "-f", "-p", "-P", "-t"):
+			w.err = "uci options -c/-f/-p/-P/-t are not supported in preview"
+		case uc.Sub == "batch" || uc.Sub == "import":
+			w.err = fmt.Sprintf("uci %s cannot be previewed", uc.Sub)
+		case w.pkg == "" || strings.ContainsAny(w.pkg, "/\x00") || strings.HasPrefix(w.pkg, "."):
+			w.err = "cannot determine config package"
+			w.pkg = ""
+		}
+		writes = append(writes, w)
+	}
+	return writes
+}
+
+// PreviewUCI applies the plan's uci write commands to a throwaway copy of the
+// configuration and returns a unified diff per touched package. Pending changes
+// in the default uci save directory are included on both sides, matching what
+// a later "uci commit" would write. write_file steps are diffed against the
+// current file and reported under their path. It returns nil when the plan
+// changes nothing.
+func PreviewUCI(ctx context.Context, p plan.Plan, opts PreviewOptions) ([]plan.ConfigDiff, error) {
+	files := fileWrites(p)
+	writes := uciWrites(p)
+	if len(writes) == 0 {
+		return files, nil
+	}
+	if opts.ConfigDir == "" {
+		opts.ConfigDir = "/etc/config"
+	}
+	if opts.UCIPath == "" {
+		opts.UCIPath = "uci"
+	}
+	uciPath, err := exec.LookPath(opts.UCIPath)
+	if err != nil {
+		return files, fmt.Errorf("uci not available: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp("", "lucicodex-preview-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	confDir := filepath.Join(tmp, "config")
+	saveDir := filepath.Join(tmp, "delta")
+	for _, d := range []string{confDir, saveDir} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	uci := func(args ...string) (string, error) {
+		argv := append([]string{"-c", confDir, "-P", saveDir}, args...)
+		out, err := exec.CommandContext(ctx, uciPath, argv...).CombinedOutput()
+		if err != nil {
+			msg := strings.TrimSpace(string(out))
+			if msg == "" {
+				msg = err.Error()
+			}
+			return "", errors.New(msg)
+		}
+		return string(out), nil
+	}
+
+	var order []string
+	diffs := map[string]*plan.ConfigDiff{}
+	before := map[string]string{}
+	for _, w := range writes {
+		if w.pkg == "" || diffs[w.pkg] != nil {
+			continue
+		}
+		order = append(order, w.pkg)
+		diffs[w.pkg] = &plan.ConfigDiff{Package: w.pkg}
+		if err := copyConfig(filepath.Join(opts.ConfigDir, w.pkg), filepath.Join(confDir, w.pkg)); err != nil {
+			return nil, err
+		}
+		before[w.pkg], _ = uci("export", w.pkg)
+	}
+
+	var general []string
+	for _, w := range writes {
+		if w.err == "" {
+			if _, err := uci(w.args...); err != nil {
+				w.err = err.Error()
+			}
+		}
+		if w.err == "" {
+			continue
+		}
+		msg := fmt.Sprintf("command %d: %s", w.index+1, w.err)
+		if d := diffs[w.pkg]; d != nil {
+			if d.Error != "" {
+				d.Error += "; "
+			}
+			d.Error += msg
+		} else {
+			general = append(general, msg)
+		}
+	}
+
+	out := make([]plan.ConfigDiff, 0, len(order)+1)
+	for _, pkg := range order {
+		d := diffs[pkg]
+		after, err := uci("export", pkg)
+		if err != nil && d.Error == "" {
+			d.Error = err.Error()
+		}
+		d.Diff = diff.Unified("a/"+pkg, "b/"+pkg, before[pkg], after, 3)
+		out = append(out, *d)
+	}
+	if len(general) > 0 {
+		out = append(out, plan.ConfigDiff{Package: "*", Error: strings.Join(general, "; ")})
+	}
+	return append(out, files...), nil
+}
+
+// fileWrites diffs each write_file step of a plan against the current file.
+func fileWrites(p plan.Plan) []plan.ConfigDiff {
+	var out []plan.ConfigDiff
+	for _, c := range p.Commands {
+		path := c.WritePath()
+		if path == "" {
+			continue
+		}
+		d := plan.ConfigDiff{Package: path}
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			d.Error = err.Error()
+		}
+		d.Diff = diff.Unified("a"+path, "b"+path, string(old), c.WriteFile.Content, 3)
+		out = append(out, d)
+	}
+	return out
+}
+
+func copyConfig(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(dst, b, 0o600)
+}
@@ -0,0 +1,103 @@
+package openwrt
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func cmds(argvs ...[]string) plan.Plan {
+	var p plan.Plan
+	for _, a := range argvs {
+		p.Commands = append(p.Commands, plan.PlannedCommand{Command: a})
+	}
+	return p
+}
+
+func TestUCIWrites(t *testing.T) {
+	p := cmds(
+		[]string{"uci", "show", "network"},
+		[]string{"uci", "set", "network.lan.ipaddr=192.168.2.1"},
+		[]string{"uci", "-q", "delete", "firewall.@rule[0]"},
+		[]string{"uci", "add", "dhcp", "host"},
+		[]string{"uci", "commit", "network"},
+		[]string{"uci", "-c", "/tmp/x", "set", "wireless.radio0.channel=6"},
+		[]string{"uci", "batch"},
+		[]string{"ubus", "call", "network", "reload"},
+	)
+	writes := uciWrites(p)
+	if len(writes) != 5 {
+		t.Fatalf("expected 5 writes, got %d: %+v", len(writes), writes)
+	}
+	wantPkgs := []string{"network", "firewall", "dhcp", "wireless", ""}
+	for i, w := range writes {
+		if w.pkg != wantPkgs[i] {
+			t.Errorf("write %d: expected package %q, got %q", i, wantPkgs[i], w.pkg)
+		}
+	}
+	if strings.Join(writes[1].args, " ") != "delete firewall.@rule[0]" {
+		t.Errorf("unexpected args %v", writes[1].args)
+	}
+	if writes[3].err == "" || writes[4].err == "" {
+		t.Error("expected -c and batch to be reported as unsupported")
+	}
+}
+
+func TestPreviewUCI_NoWrites(t *testing.T) {
+	diffs, err := PreviewUCI(context.Background(), cmds([]string{"uci", "show"}), PreviewOptions{})
+	if err != nil || diffs != nil {
+		t.Fatalf("expected no preview, got %v, %v", diffs, err)
+	}
+}
+
+func TestPreviewUCI(t *testing.T) {
+	if _, err := exec.LookPath("uci"); err != nil {
+		t.Skip("uci not installed")
+	}
+	dir := t.TempDir()
+	conf := "config interface 'lan'\n\toption proto 'static'\n\toption ipaddr '192.168.1.1'\n"
+	if err := os.WriteFile(filepath.Join(dir, "network"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := cmds([]string{"uci", "set", "network.lan.ipaddr=192.168.2.1"}, []string{"uci", "commit", "network"})
+	diffs, err := PreviewUCI(context.Background(), p, PreviewOptions{ConfigDir: dir})
+	if err != nil {
+		t.Fatalf("PreviewUCI failed: %v", err)
+	}
+	if len(diffs) != 1 || !strings.Contains(diffs[0].Diff, "+\toption ipaddr '192.168.2.1'") {
+		t.Fatalf("unexpected diffs: %+v", diffs)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "network")); string(b) != conf {
+		t.Error("preview modified the source configuration")
+	}
+}
+
+func TestPreviewUCI_WriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := plan.Plan{Commands: []plan.PlannedCommand{
+		{WriteFile: &plan.WriteFile{Path: path, Content: "127.0.0.1 localhost\n192.168.1.5 nas\n"}},
+		{WriteFile: &plan.WriteFile{Path: filepath.Join(dir, "new"), Content: "x\n"}},
+	}}
+	diffs, err := PreviewUCI(context.Background(), p, PreviewOptions{})
+	if err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	if len(diffs) != 2 || diffs[0].Package != path {
+		t.Fatalf("expected a diff per write_file step, got %+v", diffs)
+	}
+	if !strings.Contains(diffs[0].Diff, "+192.168.1.5 nas") || strings.Contains(diffs[0].Diff, "-127.0.0.1") {
+		t.Errorf("unexpected diff:\n%s", diffs[0].Diff)
+	}
+	if !strings.Contains(diffs[1].Diff, "+x") {
+		t.Errorf("expected new file as additions:\n%s", diffs[1].Diff)
+	}
+}
@@ -0,0 +1,161 @@
+package openwrt
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// ServiceReload describes how changes to a UCI package are applied.
+type ServiceReload struct {
+	Services []string // init scripts that apply the package
+	Wifi     bool     // "wifi" (reload/up) applies the package
+	Hint     string   // the usual manual command
+}
+
+// serviceReloads maps UCI packages to the services that read them.
+var serviceReloads = map[string]ServiceReload{
+	"network":  {Services: []string{"network"}, Hint: "/etc/init.d/network reload"},
+	"wireless": {Services: []string{"network"}, Wifi: true, Hint: "wifi reload"},
+	"firewall": {Services: []string{"firewall"}, Hint: "fw4 reload"},
+	"dhcp":     {Services: []string{"dnsmasq", "odhcpd"}, Hint: "/etc/init.d/dnsmasq restart"},
+	"system":   {Services: []string{"system", "sysntpd"}, Hint: "/etc/init.d/system reload"},
+	"dropbear": {Services: []string{"dropbear"}, Hint: "/etc/init.d/dropbear restart"},
+	"uhttpd":   {Services: []string{"uhttpd"}, Hint: "/etc/init.d/uhttpd restart"},
+	"sqm":      {Services: []string{"sqm"}, Hint: "/etc/init.d/sqm reload"},
+	"upnpd":    {Services: []string{"miniupnpd"}, Hint: "/etc/init.d/miniupnpd restart"},
+	"ddns":     {Services: []string{"ddns"}, Hint: "/etc/init.d/ddns restart"},
+}
+
+// ReloadFor returns how changes to pkg are applied; ok is false for packages
+// no known service reads.
+func ReloadFor(pkg string) (r ServiceReload, ok bool) {
+	r, ok = serviceReloads[pkg]
+	return r, ok
+}
+
+// ReloadCommand returns the argv that makes procd reload the services of
+// pkg: the config.change event reload_config sends for changed packages.
+func ReloadCommand(pkg string) []string {
+	return []string{"ubus", "call", "service", "event", fmt.Sprintf(`{"type":"config.change","data":{"package":%q}}`, pkg)}
+}
+
+// AppliedBy reports whether argv applies changes of the given package.
+func (r ServiceReload) AppliedBy(pkg string, argv []string) bool {
+	if len(argv) == 0 {
+		return false
+	}
+	name := filepath.Base(argv[0])
+	verb := ""
+	if len(argv) > 1 {
+		verb = argv[1]
+	}
+	isReload := verb == "reload" || verb == "restart" || verb == "start"
+	switch {
+	case name == "reload_config":
+		return true
+	case name == "wifi":
+		return r.Wifi
+	case name == "fw4":
+		return pkg == "firewall" && isReload
+	case name == "ubus":
+		// ubus call network reload, or the config.change event sent by reload_config
+		if len(argv) < 4 || argv[1] != "call" {
+			return false
+		}
+		if argv[2] == "network" && argv[3] == "reload" {
+			return contains(r.Services, "network")
+		}
+		return argv[2] == "service" && argv[3] == "event" && len(argv) > 4 &&
+			strings.Contains(argv[4], "config.change") && strings.Contains(argv[4], `"`+pkg+`"`)
+	case name == "service" && len(argv) > 2:
+		return contains(r.Services, argv[1]) && (argv[2] == "reload" || argv[2] == "restart" || argv[2] == "start")
+	case strings.HasPrefix(argv[0], "/etc/init.d/"):
+		return contains(r.Services, name) && isReload
+	}
+	return false
+}
+
+// ConfigFilePackage returns the UCI package for a path directly inside
+// /etc/config.
+func ConfigFilePackage(path string) (string, bool) {
+	pkg, ok := strings.CutPrefix(path, "/etc/config/")
+	if !ok || pkg == "" || strings.Contains(pkg, "/") || strings.HasPrefix(pkg, ".") {
+		return "", false
+	}
+	return pkg, true
+}
+
+// PendingReloads returns the packages with a known service that the plan
+// commits, or writes directly in /etc/config, without reloading them
+// afterwards, in the order they were first committed. ok reports whether
+// step i ran successfully; steps for which it returns false are ignored.
+func PendingReloads(p plan.Plan, ok func(i int) bool) []string {
+	staged := map[string]bool{}
+	pending := map[string]bool{}
+	var order []string
+	commit := func(pkg string) {
+		if _, known := serviceReloads[pkg]; !known {
+			return
+		}
+		if !pending[pkg] && !contains(order, pkg) {
+			order = append(order, pkg)
+		}
+		pending[pkg] = true
+	}
+	for i, c := range p.Commands {
+		if !ok(i) {
+			continue
+		}
+		for pkg := range pending {
+			if pending[pkg] && serviceReloads[pkg].AppliedBy(pkg, c.Command) {
+				pending[pkg] = false
+			}
+		}
+		if pkg, isConfig := ConfigFilePackage(c.WritePath()); isConfig {
+			commit(pkg)
+			continue
+		}
+		uc, isUCI := ParseUCICommand(c.Command)
+		switch {
+		case !isUCI || uc.Package == "":
+		case uc.Sub == "commit":
+			commit(uc.Package)
+			delete(staged, uc.Package)
+		case uc.Sub == "revert":
+			delete(staged, uc.Package)
+		case uc.IsWrite():
+			staged[uc.Package] = true
+		}
+		if isUCI && uc.Sub == "commit" && uc.Package == "" {
+			names := make([]string, 0, len(staged))
+			for pkg := range staged {
+				names = append(names, pkg)
+			}
+			sort.Strings(names)
+			for _, pkg := range names {
+				commit(pkg)
+			}
+			staged = map[string]bool{}
+		}
+	}
+	var out []string
+	for _, pkg := range order {
+		if pending[pkg] {
+			out = append(out, pkg)
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package openwrt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func TestPendingReloads(t *testing.T) {
+	all := func(int) bool { return true }
+	mk := func(argvs ...string) plan.Plan {
+		var p plan.Plan
+		for _, a := range argvs {
+			p.Commands = append(p.Commands, plan.PlannedCommand{Command: strings.Fields(a)})
+		}
+		return p
+	}
+	cases := []struct {
+		name string
+		p    plan.Plan
+		ok   func(int) bool
+		want string
+	}{
+		{"committed", mk("uci set network.lan.ipaddr=192.168.2.1", "uci commit network"), all, "network"},
+		{"reloaded", mk("uci set network.lan.ipaddr=192.168.2.1", "uci commit network", "/etc/init.d/network reload"), all, ""},
+		{"reloaded before commit", mk("uci set firewall.@zone[0].input=ACCEPT", "fw4 reload", "uci commit firewall"), all, "firewall"},
+		{"bare commit", mk("uci set wireless.radio0.channel=6", "uci add firewall rule", "uci commit"), all, "firewall,wireless"},
+		{"unknown package", mk("uci set lucicodex.@settings[0].dry_run=0", "uci commit lucicodex"), all, ""},
+		{"read only", mk("uci show network", "ubus call system board"), all, ""},
+		{"reload_config", mk("uci set dhcp.lan.start=100", "uci commit dhcp", "uci commit system", "reload_config"), all, ""},
+		{"event", mk("uci commit sqm", `ubus call service event {"type":"config.change","data":{"package":"sqm"}}`), all, ""},
+		{"failed commit", mk("uci set network.lan.ipaddr=192.168.2.1", "uci commit network"), func(i int) bool { return i != 1 }, ""},
+		{"failed reload", mk("uci commit dropbear", "/etc/init.d/dropbear restart"), func(i int) bool { return i != 1 }, "dropbear"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(PendingReloads(c.p, c.ok), ","); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+
+	p := plan.Plan{Commands: []plan.PlannedCommand{{WriteFile: &plan.WriteFile{Path: "/etc/config/uhttpd", Content: "config uhttpd 'main'\n"}}}}
+	if got := PendingReloads(p, all); len(got) != 1 || got[0] != "uhttpd" {
+		t.Errorf("write_file: expected [uhttpd], got %v", got)
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	argv := ReloadCommand("network")
+	if got := strings.Join(argv, " "); got != `ubus call service event {"type":"config.change","data":{"package":"network"}}` {
+		t.Fatalf("unexpected command %q", got)
+	}
+	r, _ := ReloadFor("network")
+	if !r.AppliedBy("network", argv) {
+		t.Error("expected the reload command to apply its package")
+	}
+	if r, _ := ReloadFor("firewall"); r.AppliedBy("firewall", argv) {
+		t.Error("expected the reload command not to apply other packages")
+	}
+}
@@ -0,0 +1,446 @@
+package openwrt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ubus calls methods on ubus objects and returns the JSON reply.
+type Ubus interface {
+	Call(ctx context.Context, object, method string, args any) (json.RawMessage, error)
+}
+
+// NewUbus returns a Ubus backed by the ubus CLI. socket selects a ubusd
+// socket other than the default.
+func NewUbus(socket string) Ubus {
+	return cliUbus{socket: socket}
+}
+
+type cliUbus struct {
+	socket string
+}
+
+func (u cliUbus) Call(ctx context.Context, object, method string, args any) (json.RawMessage, error) {
+	argv := []string{}
+	if u.socket != "" {
+		argv = append(argv, "-s", u.socket)
+	}
+	argv = append(argv, "-S", "call", object, method)
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(argv, string(b))
+	}
+	// short per-call timeout inside the overall budget
+	cctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(cctx, "ubus", argv...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ubus call %s %s: %s", object, method, msg)
+		}
+		return nil, fmt.Errorf("ubus call %s %s: %w", object, method, err)
+	}
+	out = bytes.TrimSpace(out)
+	if !json.Valid(out) {
+		return nil, fmt.Errorf("ubus call %s %s: invalid JSON reply", object, method)
+	}
+	return json.RawMessage(out), nil
+}
+
+// Router is a typed view of the router's state over ubus.
+type Router struct {
+	ubus Ubus
+	// readFile reads fallback sources such as the opkg status file.
+	readFile func(string) ([]byte, error)
+}
+
+// NewRouter returns a Router querying u.
+func NewRouter(u Ubus) *Router {
+	return &Router{ubus: u, readFile: os.ReadFile}
+}
+
+// call invokes a method and decodes the reply into v.
+func (r *Router) call(ctx context.Context, object, method string, args, v any) error {
+	b, err := r.ubus.Call(ctx, object, method, args)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("ubus call %s %s: %w", object, method, err)
+	}
+	return nil
+}
+
+// BoardInfo is the reply of `system board`.
+type BoardInfo struct {
+	Kernel    string `json:"kernel"`
+	Hostname  string `json:"hostname"`
+	System    string `json:"system"`
+	Model     string `json:"model"`
+	BoardName string `json:"board_name"`
+	Release   struct {
+		Distribution string `json:"distribution"`
+		Version      string `json:"version"`
+		Revision     string `json:"revision"`
+		Target       string `json:"target"`
+		Description  string `json:"description"`
+	} `json:"release"`
+}
+
+// Board returns the hardware and firmware description.
+func (r *Router) Board(ctx context.Context) (BoardInfo, error) {
+	var b BoardInfo
+	return b, r.call(ctx, "system", "board", nil, &b)
+}
+
+// SystemInfo is the reply of `system info`. Memory sizes are in bytes.
+type SystemInfo struct {
+	LocalTime int64    `json:"localtime"`
+	Uptime    int64    `json:"uptime"`
+	Load      []uint64 `json:"load"`
+	Memory    struct {
+		Total     uint64 `json:"total"`
+		Free      uint64 `json:"free"`
+		Shared    uint64 `json:"shared"`
+		Buffered  uint64 `json:"buffered"`
+		Available uint64 `json:"available"`
+		Cached    uint64 `json:"cached"`
+	} `json:"memory"`
+	Root struct {
+		Total uint64 `json:"total"`
+		Free  uint64 `json:"free"`
+		Used  uint64 `json:"used"`
+		Avail uint64 `json:"avail"`
+	} `json:"root"`
+}
+
+// SystemInfo returns uptime, load and memory usage.
+func (r *Router) SystemInfo(ctx context.Context) (SystemInfo, error) {
+	var s SystemInfo
+	return s, r.call(ctx, "system", "info", nil, &s)
+}
+
+// InterfaceStatus is the summary of one logical interface from
+// `network.interface dump`.
+type InterfaceStatus struct {
+	Interface string   `json:"interface"`
+	Up        bool     `json:"up"`
+	Proto     string   `json:"proto,omitempty"`
+	Device    string   `json:"device,omitempty"`
+	Uptime    int64    `json:"uptime,omitempty"`
+	IPv4      []string `json:"ipv4,omitempty"`
+	IPv6      []string `json:"ipv6,omitempty"`
+	DNS       []string `json:"dns,omitempty"`
+	Routes    []Route  `json:"routes,omitempty"`
+}
+
+// Route is a route installed by netifd for an interface.
+type Route struct {
+	Target  string `json:"target"`
+	Nexthop string `json:"nexthop,omitempty"`
+	Metric  int    `json:"metric,omitempty"`
+}
+
+type ifaceAddr struct {
+	Address string `json:"address"`
+	Mask    int    `json:"mask"`
+}
+
+type ifaceRoute struct {
+	Target  string `json:"target"`
+	Mask    int    `json:"mask"`
+	Nexthop string `json:"nexthop"`
+	Metric  int    `json:"metric"`
+}
+
+// Interfaces returns the state of all logical interfaces.
+func (r *Router) Interfaces(ctx context.Context) ([]InterfaceStatus, error) {
+	var dump struct {
+		Interface []struct {
+			Interface   string       `json:"interface"`
+			Up          bool         `json:"up"`
+			Proto       string       `json:"proto"`
+			L3Device    string       `json:"l3_device"`
+			Device      string       `json:"device"`
+			Uptime      int64        `json:"uptime"`
+			IPv4Address []ifaceAddr  `json:"ipv4-address"`
+			IPv6Address []ifaceAddr  `json:"ipv6-address"`
+			Route       []ifaceRoute `json:"route"`
+			DNSServer   []string     `json:"dns-server"`
+		} `json:"interface"`
+	}
+	if err := r.call(ctx, "network.interface", "dump", nil, &dump); err != nil {
+		return nil, err
+	}
+	out := make([]InterfaceStatus, 0, len(dump.Interface))
+	for _, i := range dump.Interface {
+		s := InterfaceStatus{Interface: i.Interface, Up: i.Up, Proto: i.Proto, Device: i.L3Device, Uptime: i.Uptime, DNS: i.DNSServer}
+		if s.Device == "" {
+			s.Device = i.Device
+		}
+		for _, a := range i.IPv4Address {
+			s.IPv4 = append(s.IPv4, a.Address+"/"+strconv.Itoa(a.Mask))
+		}
+		for _, a := range i.IPv6Address {
+			s.IPv6 = append(s.IPv6, a.Address+"/"+strconv.Itoa(a.Mask))
+		}
+		for _, rt := range i.Route {
+			s.Routes = append(s.Routes, Route{Target: rt.Target + "/" + strconv.Itoa(rt.Mask), Nexthop: rt.Nexthop, Metric: rt.Metric})
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// WirelessInfo describes one wireless interface as reported by iwinfo.
+type WirelessInfo struct {
+	Device     string `json:"device"`
+	Phy        string `json:"phy,omitempty"`
+	SSID       string `json:"ssid,omitempty"`
+	BSSID      string `json:"bssid,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	Channel    int    `json:"channel,omitempty"`
+	Frequency  int    `json:"frequency,omitempty"`
+	TxPower    int    `json:"txpower,omitempty"`
+	Signal     int    `json:"signal,omitempty"`
+	Noise      int    `json:"noise,omitempty"`
+	HTMode     string `json:"htmode,omitempty"`
+	Encryption struct {
+		Enabled        bool     `json:"enabled"`
+		WPA            []int    `json:"wpa,omitempty"`
+		Authentication []string `json:"authentication,omitempty"`
+		Ciphers        []string `json:"ciphers,omitempty"`
+	} `json:"encryption"`
+	// Stations is the number of associated clients.
+	Stations int `json:"stations"`
+}
+
+// Wireless returns every wireless interface with its associated client count.
+func (r *Router) Wireless(ctx context.Context) ([]WirelessInfo, error) {
+	var devs struct {
+		Devices []string `json:"devices"`
+	}
+	if err := r.call(ctx, "iwinfo", "devices", nil, &devs); err != nil {
+		return nil, err
+	}
+	out := make([]WirelessInfo, 0, len(devs.Devices))
+	for _, d := range devs.Devices {
+		w := WirelessInfo{Device: d}
+		args := map[string]string{"device": d}
+		if err := r.call(ctx, "iwinfo", "info", args, &w); err != nil {
+			return nil, err
+		}
+		w.Device = d
+		var assoc struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		if err := r.call(ctx, "iwinfo", "assoclist", args, &assoc); err == nil {
+			w.Stations = len(assoc.Results)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+// HostHint names a LAN host known from DHCP, ARP or neighbour tables.
+type HostHint struct {
+	MAC  string   `json:"mac"`
+	Name string   `json:"name,omitempty"`
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+}
+
+// HostHints returns the hosts known to LuCI's rpc backend, sorted by MAC.
+func (r *Router) HostHints(ctx context.Context) ([]HostHint, error) {
+	var hints map[string]struct {
+		Name     string   `json:"name"`
+		IPAddrs  []string `json:"ipaddrs"`
+		IP6Addrs []string `json:"ip6addrs"`
+	}
+	if err := r.call(ctx, "luci-rpc", "getHostHints", nil, &hints); err != nil {
+		return nil, err
+	}
+	out := make([]HostHint, 0, len(hints))
+	for mac, h := range hints {
+		out = append(out, HostHint{MAC: mac, Name: h.Name, IPv4: h.IPAddrs, IPv6: h.IP6Addrs})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	return out, nil
+}
+
+// Lease is an active DHCPv4 lease.
+type Lease struct {
+	Expires  int64  `json:"expires"`
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// leaseFile is the dnsmasq lease database used when luci-rpc is missing.
+const leaseFile = "/tmp/dhcp.leases"
+
+// DHCPLeases returns the active DHCPv4 leases from luci-rpc or, without it,
+// the dnsmasq lease file.
+func (r *Router) DHCPLeases(ctx context.Context) ([]Lease, error) {
+	var reply struct {
+		Leases []struct {
+			Expires  int64  `json:"expires"`
+			Hostname string `json:"hostname"`
+			MACAddr  string `json:"macaddr"`
+			IPAddr   string `json:"ipaddr"`
+		} `json:"dhcp_leases"`
+	}
+	if err := r.call(ctx, "luci-rpc", "getDHCPLeases", nil, &reply); err != nil {
+		b, ferr := r.readFile(leaseFile)
+		if ferr != nil {
+			return nil, err
+		}
+		return ParseLeases(b), nil
+	}
+	out := make([]Lease, 0, len(reply.Leases))
+	for _, l := range reply.Leases {
+		out = append(out, Lease{Expires: l.Expires, MAC: l.MACAddr, IP: l.IPAddr, Hostname: l.Hostname})
+	}
+	return out, nil
+}
+
+// ParseLeases parses a dnsmasq lease file.
+func ParseLeases(b []byte) []Lease {
+	out := []Lease{}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 {
+			continue
+		}
+		l := Lease{MAC: f[1], IP: f[2]}
+		l.Expires, _ = strconv.ParseInt(f[0], 10, 64)
+		if f[3] != "*" {
+			l.Hostname = f[3]
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// UCISection is one section of a UCI package. Option values are strings,
+// or string lists for list options. Anonymous sections are named @type[n].
+type UCISection struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// UCI returns the sections of a UCI package in file order.
+func (r *Router) UCI(ctx context.Context, config string) ([]UCISection, error) {
+	var reply struct {
+		Values map[string]map[string]any `json:"values"`
+	}
+	if err := r.call(ctx, "uci", "get", map[string]string{"config": config}, &reply); err != nil {
+		return nil, err
+	}
+	type indexed struct {
+		index int
+		s     UCISection
+		anon  bool
+	}
+	var all []indexed
+	for name, vals := range reply.Values {
+		it := indexed{s: UCISection{Name: name}}
+		for k, v := range vals {
+			switch k {
+			case ".type":
+				it.s.Type, _ = v.(string)
+			case ".index":
+				if f, ok := v.(float64); ok {
+					it.index = int(f)
+				}
+			case ".anonymous":
+				it.anon, _ = v.(bool)
+			case ".name":
+			default:
+				if it.s.Options == nil {
+					it.s.Options = map[string]any{}
+				}
+				it.s.Options[k] = uciValue(v)
+			}
+		}
+		all = append(all, it)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].index < all[j].index })
+	out := make([]UCISection, 0, len(all))
+	count := map[string]int{}
+	for _, it := range all {
+		if it.anon {
+			it.s.Name = fmt.Sprintf("@%s[%d]", it.s.Type, count[it.s.Type])
+		}
+		count[it.s.Type]++
+		out = append(out, it.s)
+	}
+	return out, nil
+}
+
+// uciValue converts a decoded option value to a string or string list.
+func uciValue(v any) any {
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	out := make([]string, 0, len(list))
+	for _, x := range list {
+		out = append(out, fmt.Sprint(x))
+	}
+	return out
+}
+
+// Package is an installed package.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Packages returns the installed packages sorted by name, from rpcd's
+// rpc-sys object or, without it, the opkg status file.
+func (r *Router) Packages(ctx context.Context) ([]Package, error) {
+	var reply struct {
+		Packages map[string]string `json:"packages"`
+	}
+	var out []Package
+	if err := r.call(ctx, "rpc-sys", "packagelist", map[string]bool{"all": false}, &reply); err == nil {
+		for name, version := range reply.Packages {
+			out = append(out, Package{Name: name, Version: version})
+		}
+	} else {
+		b, ferr := r.readFile(OpkgStatusFile)
+		if ferr != nil {
+			return nil, err
+		}
+		out = ParseOpkgStatus(b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ParseOpkgStatus parses installed packages from an opkg status file.
+func ParseOpkgStatus(b []byte) []Package {
+	var out []Package
+	for _, p := range ParseOpkgControl(b) {
+		if p.Installed {
+			out = append(out, Package{Name: p.Name, Version: p.Version})
+		}
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package openwrt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeUbus answers calls from a map keyed by "object method", followed by
+// the JSON arguments when there are any.
+type fakeUbus map[string]string
+
+func (f fakeUbus) Call(ctx context.Context, object, method string, args any) (json.RawMessage, error) {
+	key := object + " " + method
+	if args != nil {
+		b, _ := json.Marshal(args)
+		key += " " + string(b)
+	}
+	if out, ok := f[key]; ok {
+		return json.RawMessage(out), nil
+	}
+	// Fall back to the key without arguments.
+	if out, ok := f[object+" "+method]; ok {
+		return json.RawMessage(out), nil
+	}
+	return nil, errors.New("ubus call " + key + ": Not found")
+}
+
+func TestRouter_UCI(t *testing.T) {
+	r := NewRouter(fakeUbus{`uci get {"config":"firewall"}`: `{"values":{
+		"cfg02dc81":{".anonymous":true,".type":"zone",".name":"cfg02dc81",".index":1,"name":"lan","network":["lan"]},
+		"defaults":{".anonymous":true,".type":"defaults",".name":"defaults",".index":0,"syn_flood":"1"},
+		"cfg03dc81":{".anonymous":true,".type":"zone",".name":"cfg03dc81",".index":2,"name":"wan","network":["wan","wan6"],"masq":"1"},
+		"guest":{".anonymous":false,".type":"zone",".name":"guest",".index":3,"name":"guest"}
+	}}`})
+	got, err := r.UCI(context.Background(), "firewall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UCISection{
+		{Name: "@defaults[0]", Type: "defaults", Options: map[string]any{"syn_flood": "1"}},
+		{Name: "@zone[0]", Type: "zone", Options: map[string]any{"name": "lan", "network": []string{"lan"}}},
+		{Name: "@zone[1]", Type: "zone", Options: map[string]any{"name": "wan", "network": []string{"wan", "wan6"}, "masq": "1"}},
+		{Name: "guest", Type: "zone", Options: map[string]any{"name": "guest"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v", got)
+	}
+}
+
+func TestRouter_Interfaces(t *testing.T) {
+	r := NewRouter(fakeUbus(routerReplies))
+	got, err := r.Interfaces(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterfaceStatus{{
+		Interface: "wan", Up: true, Proto: "dhcp", Device: "wan",
+		IPv4:   []string{"203.0.113.5/24"},
+		Routes: []Route{{Target: "0.0.0.0/0", Nexthop: "203.0.113.1"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestRouter_Wireless(t *testing.T) {
+	r := NewRouter(fakeUbus{
+		"iwinfo devices":                         `{"devices":["phy0-ap0"]}`,
+		`iwinfo info {"device":"phy0-ap0"}`:      `{"phy":"phy0","ssid":"Home","mode":"Master","channel":36,"encryption":{"enabled":true,"wpa":[2],"authentication":["psk"],"ciphers":["ccmp"]}}`,
+		`iwinfo assoclist {"device":"phy0-ap0"}`: `{"results":[{"mac":"AA:BB:CC:DD:EE:01"},{"mac":"AA:BB:CC:DD:EE:02"}]}`,
+	})
+	got, err := r.Wireless(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	w := got[0]
+	if w.Device != "phy0-ap0" || w.SSID != "Home" || w.Channel != 36 || w.Stations != 2 || !w.Encryption.Enabled {
+		t.Errorf("got %+v", w)
+	}
+}
+
+func TestRouter_HostHints(t *testing.T) {
+	r := NewRouter(fakeUbus{"luci-rpc getHostHints": `{
+		"aa:bb:cc:dd:ee:02":{"ipaddrs":["192.168.1.24"]},
+		"aa:bb:cc:dd:ee:01":{"name":"phone","ipaddrs":["192.168.1.23"],"ip6addrs":["fd00::23"]}
+	}`})
+	got, err := r.HostHints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HostHint{
+		{MAC: "aa:bb:cc:dd:ee:01", Name: "phone", IPv4: []string{"192.168.1.23"}, IPv6: []string{"fd00::23"}},
+		{MAC: "aa:bb:cc:dd:ee:02", IPv4: []string{"192.168.1.24"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestRouter_Fallbacks(t *testing.T) {
+	files := map[string]string{
+		leaseFile: "1760870400 aa:bb:cc:dd:ee:01 192.168.1.23 phone 01:aa:bb\n1760870500 aa:bb:cc:dd:ee:02 192.168.1.24 * *\n",
+		OpkgStatusFile: "Package: luci\nVersion: git-24.086\nStatus: install user installed\n\n" +
+			"Package: kmod-foo\nVersion: 1\nStatus: deinstall ok not-installed\n\n" +
+			"Package: base-files\nVersion: 1555-r23809\nStatus: install ok installed\n",
+	}
+	r := NewRouter(fakeUbus(nil))
+	r.readFile = func(name string) ([]byte, error) {
+		if s, ok := files[name]; ok {
+			return []byte(s), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	leases, err := r.DHCPLeases(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLeases := []Lease{
+		{Expires: 1760870400, MAC: "aa:bb:cc:dd:ee:01", IP: "192.168.1.23", Hostname: "phone"},
+		{Expires: 1760870500, MAC: "aa:bb:cc:dd:ee:02", IP: "192.168.1.24"},
+	}
+	if !reflect.DeepEqual(leases, wantLeases) {
+		t.Errorf("leases: %+v", leases)
+	}
+	pkgs, err := r.Packages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPkgs := []Package{{"base-files", "1555-r23809"}, {"luci", "git-24.086"}}
+	if !reflect.DeepEqual(pkgs, wantPkgs) {
+		t.Errorf("packages: %+v", pkgs)
+	}
+
+	r.readFile = func(string) ([]byte, error) { return nil, os.ErrNotExist }
+	if _, err := r.Packages(context.Background()); err == nil || !strings.Contains(err.Error(), "rpc-sys packagelist") {
+		t.Errorf("expected the ubus error, got %v", err)
+	}
+}
+
+func TestRouter_PackagesFromRPC(t *testing.T) {
+	got, err := NewRouter(fakeUbus(routerReplies)).Packages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{{"base-files", "1555-r23809"}, {"luci", "git-24.086"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+// fakeUbusCLI puts a ubus script that logs its arguments and prints reply on
+// PATH and returns the path of the log.
+func fakeUbusCLI(t *testing.T, reply string, exit int) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + log + "\n"
+	if exit != 0 {
+		script += "echo 'Command failed: Not found' >&2\nexit " + strconv.Itoa(exit) + "\n"
+	} else {
+		script += "cat <<'EOF'\n" + reply + "\nEOF\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ubus"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestCLIUbus_Call(t *testing.T) {
+	log := fakeUbusCLI(t, `{"devices":["phy0-ap0"]}`, 0)
+	out, err := NewUbus("/var/run/ubus/ubus.sock").Call(context.Background(), "iwinfo", "info", map[string]string{"device": "phy0-ap0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"devices":["phy0-ap0"]}` {
+		t.Errorf("reply %q", out)
+	}
+	args, _ := os.ReadFile(log)
+	if got, want := strings.TrimSpace(string(args)), `-s /var/run/ubus/ubus.sock -S call iwinfo info {"device":"phy0-ap0"}`; got != want {
+		t.Errorf("args %q, want %q", got, want)
+	}
+}
+
+func TestCLIUbus_Errors(t *testing.T) {
+	fakeUbusCLI(t, "", 4)
+	_, err := NewUbus("").Call(context.Background(), "luci-rpc", "getHostHints", nil)
+	if err == nil || !strings.Contains(err.Error(), "Not found") {
+		t.Errorf("expected stderr in error, got %v", err)
+	}
+
+	fakeUbusCLI(t, "not json", 0)
+	if _, err := NewUbus("").Call(context.Background(), "system", "board", nil); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected invalid JSON error, got %v", err)
+	}
+}
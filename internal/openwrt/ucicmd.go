@@ -0,0 +1,122 @@
+package openwrt
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// UCICommand is a parsed uci invocation such as
+// ["uci", "-q", "set", "network.lan.ipaddr=192.168.1.1"].
+type UCICommand struct {
+	Options []string // leading options, including their arguments
+	Sub     string   // subcommand: set, add, commit, show, ...
+	Args    []string // arguments after the subcommand
+	Package string
+	Section string
+	Option  string
+	Value   string
+	HasVal  bool
+}
+
+// uci options that take an argument.
+var uciArgOptions = map[string]bool{"-c": true, "-d": true, "-f": true, "-p": true, "-P": true, "-t": true}
+
+var uciWriteCommands = map[string]bool{
+	"set": true, "add": true, "add_list": true, "del_list": true,
+	"delete": true, "rename": true, "reorder": true, "revert": true,
+	"batch": true, "import": true,
+}
+
+// ParseUCICommand parses an argv whose program is uci. ok is false for
+// anything else or when no subcommand is present.
+func ParseUCICommand(argv []string) (c UCICommand, ok bool) {
+	if len(argv) < 2 || filepath.Base(argv[0]) != "uci" {
+		return c, false
+	}
+	rest := argv[1:]
+	j := 0
+	for j < len(rest) && strings.HasPrefix(rest[j], "-") {
+		c.Options = append(c.Options, rest[j])
+		if uciArgOptions[rest[j]] && j+1 < len(rest) {
+			j++
+			c.Options = append(c.Options, rest[j])
+		}
+		j++
+	}
+	if j >= len(rest) {
+		return c, false
+	}
+	c.Sub, c.Args = rest[j], rest[j+1:]
+	if len(c.Args) == 0 {
+		return c, true
+	}
+	if c.Sub == "add" {
+		c.Package = c.Args[0]
+		return c, true
+	}
+	key := c.Args[0]
+	if k, v, found := strings.Cut(key, "="); found {
+		key, c.Value, c.HasVal = k, v, true
+	}
+	parts := strings.SplitN(key, ".", 3)
+	c.Package = parts[0]
+	if len(parts) > 1 {
+		c.Section = parts[1]
+	}
+	if len(parts) > 2 {
+		c.Option = parts[2]
+	}
+	return c, true
+}
+
+// IsWrite reports whether the subcommand modifies configuration.
+func (c UCICommand) IsWrite() bool { return uciWriteCommands[c.Sub] }
+
+// HasOption reports whether any of the given options was passed.
+func (c UCICommand) HasOption(opts ...string) bool {
+	for i := 0; i < len(c.Options); i++ {
+		for _, o := range opts {
+			if c.Options[i] == o {
+				return true
+			}
+		}
+		if uciArgOptions[c.Options[i]] {
+			i++
+		}
+	}
+	return false
+}
+
+// UCISectionLookup returns a function reporting whether a named section exists
+// in the live configuration. known is false when uci is unavailable or the
+// query fails for other reasons. Results are cached.
+func UCISectionLookup(ctx context.Context) func(pkg, section string) (exists, known bool) {
+	type answer struct{ exists, known bool }
+	var mu sync.Mutex
+	cache := map[string]answer{}
+	return func(pkg, section string) (bool, bool) {
+		key := pkg + "." + section
+		mu.Lock()
+		defer mu.Unlock()
+		if a, ok := cache[key]; ok {
+			return a.exists, a.known
+		}
+		var a answer
+		if _, err := exec.LookPath("uci"); err == nil {
+			err := exec.CommandContext(ctx, "uci", "-q", "get", key).Run()
+			var exitErr *exec.ExitError
+			switch {
+			case err == nil:
+				a = answer{exists: true, known: true}
+			case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+				a = answer{exists: false, known: true}
+			}
+		}
+		cache[key] = a
+		return a.exists, a.known
+	}
+}
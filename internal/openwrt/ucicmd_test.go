@@ -0,0 +1,31 @@
+package openwrt
+
+import "testing"
+
+func TestParseUCICommand(t *testing.T) {
+	c, ok := ParseUCICommand([]string{"/sbin/uci", "-q", "-d", ",", "set", "wireless.default_radio0.key=a.b=c"})
+	if !ok {
+		t.Fatal("expected uci command")
+	}
+	if c.Sub != "set" || c.Package != "wireless" || c.Section != "default_radio0" || c.Option != "key" {
+		t.Errorf("unexpected parse %+v", c)
+	}
+	if !c.HasVal || c.Value != "a.b=c" {
+		t.Errorf("unexpected value %q", c.Value)
+	}
+	if !c.IsWrite() || !c.HasOption("-q") || c.HasOption(",") {
+		t.Errorf("unexpected options %v", c.Options)
+	}
+
+	c, ok = ParseUCICommand([]string{"uci", "add", "firewall", "rule"})
+	if !ok || c.Package != "firewall" || c.Section != "" {
+		t.Errorf("unexpected add parse %+v", c)
+	}
+
+	if _, ok := ParseUCICommand([]string{"ubus", "call", "system", "board"}); ok {
+		t.Error("expected non-uci argv to be rejected")
+	}
+	if _, ok := ParseUCICommand([]string{"uci", "-q"}); ok {
+		t.Error("expected missing subcommand to be rejected")
+	}
+}
@@ -0,0 +1,162 @@
+// Package lint inspects a plan for OpenWrt-specific mistakes such as
+// uncommitted UCI changes or missing service reloads.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/executor"
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// Finding codes.
+const (
+	CodeUncommitted    = "uncommitted"
+	CodeMissingReload  = "missing-reload"
+	CodeDuplicateStep  = "duplicate-step"
+	CodeMissingSection = "missing-section"
+)
+
+// Finding is a single lint result. Step is the 0-based command index.
+type Finding struct {
+	Step    int    `json:"step"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("lint: step %d: %s", f.Step+1, f.Message)
+}
+
+// SectionLookup reports whether a named section exists in the current
+// configuration. known is false when the answer cannot be determined.
+type SectionLookup func(pkg, section string) (exists, known bool)
+
+// Options configures optional checks.
+type Options struct {
+	// Sections enables the missing-section check when non-nil.
+	Sections SectionLookup
+	// AutoReload reports missing reloads as ones the executor will add.
+	AutoReload bool
+}
+
+// Check runs all lint rules over the plan and returns findings ordered by step.
+func Check(p plan.Plan, opts Options) []Finding {
+	var findings []Finding
+
+	type pkgState struct {
+		lastWrite int
+		commit    int // step of the last commit after lastWrite, -1 if none
+	}
+	pkgs := map[string]*pkgState{}
+	var order []string
+	created := map[string]bool{}
+	seen := map[string]int{}
+
+	for i, c := range p.Commands {
+		key := strings.Join(c.Command, "\x00") + "\x00" + c.Stdin
+		if c.IsWrite() {
+			key = "write_file\x00" + c.WriteFile.Path + "\x00" + c.WriteFile.Content
+		}
+		if j, dup := seen[key]; dup {
+			findings = append(findings, Finding{Step: i, Code: CodeDuplicateStep,
+				Message: fmt.Sprintf("duplicates step %d (%s)", j+1, executor.FormatStep(c))})
+		} else {
+			seen[key] = i
+		}
+
+		// Writing /etc/config/<pkg> directly needs no commit, only a reload.
+		if pkg, ok := openwrt.ConfigFilePackage(c.WritePath()); ok {
+			st := pkgs[pkg]
+			if st == nil {
+				st = &pkgState{}
+				pkgs[pkg] = st
+				order = append(order, pkg)
+			}
+			st.lastWrite, st.commit = i, i
+			continue
+		}
+
+		uc, ok := openwrt.ParseUCICommand(c.Command)
+		if !ok {
+			continue
+		}
+		if uc.Sub == "commit" {
+			for name, st := range pkgs {
+				if len(uc.Args) == 0 || uc.Args[0] == name {
+					st.commit = i
+				}
+			}
+			continue
+		}
+		if !uc.IsWrite() || uc.Package == "" || uc.Sub == "revert" {
+			continue
+		}
+		st := pkgs[uc.Package]
+		if st == nil {
+			st = &pkgState{}
+			pkgs[uc.Package] = st
+			order = append(order, uc.Package)
+		}
+		st.lastWrite, st.commit = i, -1
+
+		if uc.Section == "" || strings.HasPrefix(uc.Section, "@") {
+			continue
+		}
+		sectionKey := uc.Package + "." + uc.Section
+		if uc.Sub == "set" && uc.Option == "" && uc.HasVal {
+			created[sectionKey] = true
+			continue
+		}
+		if created[sectionKey] || opts.Sections == nil {
+			continue
+		}
+		if exists, known := opts.Sections(uc.Package, uc.Section); known && !exists {
+			findings = append(findings, Finding{Step: i, Code: CodeMissingSection,
+				Message: fmt.Sprintf("section %s does not exist in the current config", sectionKey)})
+			created[sectionKey] = true // report once
+		}
+	}
+
+	for _, name := range order {
+		st := pkgs[name]
+		if st.commit < 0 {
+			findings = append(findings, Finding{Step: st.lastWrite, Code: CodeUncommitted,
+				Message: fmt.Sprintf("changes to %s are never committed (add: uci commit %s)", name, name)})
+			continue
+		}
+		r, ok := openwrt.ReloadFor(name)
+		if !ok {
+			continue
+		}
+		reloaded := false
+		for _, c := range p.Commands[st.commit+1:] {
+			if r.AppliedBy(name, c.Command) {
+				reloaded = true
+				break
+			}
+		}
+		if !reloaded && opts.AutoReload {
+			findings = append(findings, Finding{Step: st.commit, Code: CodeMissingReload,
+				Message: fmt.Sprintf("%s is committed but never reloaded (reloaded automatically after the plan)", name)})
+		} else if !reloaded {
+			findings = append(findings, Finding{Step: st.commit, Code: CodeMissingReload,
+				Message: fmt.Sprintf("%s is committed but never reloaded (add: %s)", name, r.Hint)})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Step < findings[j].Step })
+	return findings
+}
+
+// Annotate runs Check and appends the findings to the plan warnings.
+func Annotate(p *plan.Plan, opts Options) []Finding {
+	findings := Check(*p, opts)
+	for _, f := range findings {
+		p.Warnings = append(p.Warnings, f.String())
+	}
+	return findings
+}
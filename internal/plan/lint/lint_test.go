@@ -0,0 +1,133 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func mkPlan(argvs ...string) plan.Plan {
+	var p plan.Plan
+	for _, a := range argvs {
+		p.Commands = append(p.Commands, plan.PlannedCommand{Command: strings.Fields(a)})
+	}
+	return p
+}
+
+func codes(fs []Finding) string {
+	var out []string
+	for _, f := range fs {
+		out = append(out, f.Code)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name string
+		p    plan.Plan
+		want string
+	}{
+		{"clean", mkPlan(
+			"uci set network.lan.ipaddr=192.168.2.1",
+			"uci commit network",
+			"/etc/init.d/network reload",
+		), ""},
+		{"read only", mkPlan("uci show network", "ubus call system board"), ""},
+		{"never committed", mkPlan("uci set network.lan.ipaddr=192.168.2.1"), CodeUncommitted},
+		{"committed other package", mkPlan(
+			"uci set wireless.radio0.channel=6",
+			"uci commit network",
+		), CodeUncommitted},
+		{"write after commit", mkPlan(
+			"uci set firewall.@zone[0].input=ACCEPT",
+			"uci commit",
+			"uci set firewall.@zone[1].input=REJECT",
+			"fw4 reload",
+		), CodeUncommitted},
+		{"missing reload", mkPlan(
+			"uci set wireless.radio0.channel=6",
+			"uci commit wireless",
+		), CodeMissingReload},
+		{"wrong reload", mkPlan(
+			"uci set firewall.@zone[0].input=ACCEPT",
+			"uci commit firewall",
+			"/etc/init.d/network reload",
+		), CodeMissingReload},
+		{"wifi reload", mkPlan(
+			"uci set wireless.radio0.channel=6",
+			"uci commit wireless",
+			"wifi reload",
+		), ""},
+		{"reload_config", mkPlan(
+			"uci add_list dhcp.lan.dhcp_option=6,1.1.1.1",
+			"uci commit dhcp",
+			"reload_config",
+		), ""},
+		{"package without reloader", mkPlan(
+			"uci set lucicodex.@settings[0].dry_run=0",
+			"uci commit lucicodex",
+		), ""},
+		{"duplicate", mkPlan("logread", "ip addr", "logread"), CodeDuplicateStep},
+	}
+	for _, c := range cases {
+		if got := codes(Check(c.p, Options{})); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestCheck_MissingSection(t *testing.T) {
+	lookup := func(pkg, section string) (bool, bool) {
+		return pkg == "network" && section == "lan", true
+	}
+	p := mkPlan(
+		"uci set network.lan.ipaddr=192.168.2.1",
+		"uci set network.guest.proto=static",
+		"uci set network.iot=interface",
+		"uci set network.iot.proto=dhcp",
+		"uci commit network",
+		"ubus call network reload",
+	)
+	fs := Check(p, Options{Sections: lookup})
+	if codes(fs) != CodeMissingSection || fs[0].Step != 1 {
+		t.Fatalf("unexpected findings: %+v", fs)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	p := mkPlan("uci set network.lan.ipaddr=192.168.2.1")
+	Annotate(&p, Options{})
+	if len(p.Warnings) != 1 || !strings.HasPrefix(p.Warnings[0], "lint: step 1:") {
+		t.Fatalf("unexpected warnings: %v", p.Warnings)
+	}
+}
+
+func TestCheck_WriteFile(t *testing.T) {
+	write := func(path, content string) plan.PlannedCommand {
+		return plan.PlannedCommand{WriteFile: &plan.WriteFile{Path: path, Content: content}}
+	}
+	p := plan.Plan{Commands: []plan.PlannedCommand{
+		write("/etc/config/network", "config interface 'lan'\n"),
+		write("/tmp/lucicodex/a.json", "{}"),
+		write("/tmp/lucicodex/b.json", "{}"),
+	}}
+	if got := codes(Check(p, Options{})); got != CodeMissingReload {
+		t.Fatalf("expected only %s, got %q", CodeMissingReload, got)
+	}
+
+	p.Commands = append(p.Commands, plan.PlannedCommand{Command: []string{"reload_config"}},
+		write("/tmp/lucicodex/a.json", "{}"))
+	if got := codes(Check(p, Options{})); got != CodeDuplicateStep {
+		t.Fatalf("expected only %s, got %q", CodeDuplicateStep, got)
+	}
+}
+
+func TestCheck_AutoReload(t *testing.T) {
+	p := mkPlan("uci set wireless.radio0.channel=6", "uci commit wireless")
+	fs := Check(p, Options{AutoReload: true})
+	if codes(fs) != CodeMissingReload || !strings.Contains(fs[0].Message, "automatically") {
+		t.Fatalf("unexpected findings: %+v", fs)
+	}
+}
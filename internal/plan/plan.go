@@ -1,23 +1,77 @@
 package plan
 
 import (
-    "encoding/json"
     "fmt"
     "strings"
 )
 
 // PlannedCommand represents a single command to execute safely without shell interpolation.
 type PlannedCommand struct {
-    Command     []string `json:"command"`
-    Description string   `json:"description,omitempty"`
-    NeedsRoot   bool     `json:"needs_root,omitempty"`
+    Command     []string   `json:"command,omitempty"`
+    Description string     `json:"description,omitempty"`
+    NeedsRoot   bool       `json:"needs_root,omitempty"`
+    // Pipeline lists further argv stages; each reads the previous stage's stdout.
+    Pipeline    [][]string `json:"pipeline,omitempty"`
+    // StdoutFile receives the final stdout instead of the result output.
+    StdoutFile  string     `json:"stdout_file,omitempty"`
+    // Stdin is fed to the first stage's standard input.
+    Stdin       string     `json:"stdin,omitempty"`
+    // WriteFile makes this step a file write instead of a command.
+    WriteFile   *WriteFile `json:"write_file,omitempty"`
+    // Independent marks a step that neither depends on nor affects other
+    // steps, so it may run concurrently with its neighbours.
+    Independent bool       `json:"independent,omitempty"`
+    // NoIsolate runs a step the executor built itself, such as a watchdog
+    // probe, outside isolation. Plans cannot set it.
+    NoIsolate   bool       `json:"-"`
+}
+
+// WriteFile replaces a file atomically with the given content.
+type WriteFile struct {
+    Path    string `json:"path"`
+    Content string `json:"content"`
+    // Mode is an octal permission string such as "0644". Empty keeps the
+    // mode of an existing file, or 0600 for a new one.
+    Mode    string `json:"mode,omitempty"`
+    // Backup keeps a copy of the previous file before it is replaced.
+    Backup  bool   `json:"backup,omitempty"`
+}
+
+// Stages returns the command followed by its pipeline stages.
+func (c PlannedCommand) Stages() [][]string {
+    return append([][]string{c.Command}, c.Pipeline...)
+}
+
+// IsWrite reports whether the step is a write_file step.
+func (c PlannedCommand) IsWrite() bool { return c.WriteFile != nil }
+
+// WritePath returns the target of a write_file step, or "".
+func (c PlannedCommand) WritePath() string {
+    if c.WriteFile == nil {
+        return ""
+    }
+    return c.WriteFile.Path
 }
 
 // Plan is the structured response expected from the model.
 type Plan struct {
+    SchemaVersion int         `json:"schema_version,omitempty"`
     Summary  string           `json:"summary,omitempty"`
     Commands []PlannedCommand `json:"commands"`
     Warnings []string         `json:"warnings,omitempty"`
+    // ConfigDiffs is filled locally by the UCI preview, never by the model.
+    ConfigDiffs []ConfigDiff `json:"config_diffs,omitempty"`
+    // Untrusted is set locally when the plan was generated from device data
+    // that may carry injected instructions; see MarkUntrusted.
+    Untrusted bool `json:"-"`
+}
+
+// ConfigDiff is the previewed change to one UCI package, or to the file of a
+// write_file step, as a unified diff.
+type ConfigDiff struct {
+    Package string `json:"package"`
+    Diff    string `json:"diff,omitempty"`
+    Error   string `json:"error,omitempty"`
 }
 
 // BuildInstruction returns the instruction prefix to reliably elicit a JSON plan.
@@ -26,9 +80,17 @@ func BuildInstruction(cfg interface{}) string {
     b := &strings.Builder{}
     b.WriteString("You are a router command planner.\n")
     b.WriteString("Output only strict JSON that conforms to this schema:\n")
-    b.WriteString("{\n  \"summary\": string,\n  \"commands\": [ { \"command\": [string, ...], \"description\": string, \"needs_root\": bool } ],\n  \"warnings\": [string]\n}\n")
+    b.WriteString("{\n  \"summary\": string,\n  \"commands\": [ { \"command\": [string, ...], \"description\": string, \"needs_root\": bool, \"pipeline\": [[string, ...]], \"stdout_file\": string, \"stdin\": string, \"independent\": bool } | { \"write_file\": { \"path\": string, \"content\": string, \"mode\": string, \"backup\": bool }, \"description\": string } ],\n  \"warnings\": [string]\n}\n")
     b.WriteString("Rules:\n")
-    b.WriteString("- Use explicit argv arrays; do not return shell pipelines or redirections.\n")
+    b.WriteString("- Do not add fields that are not in the schema.\n")
+    b.WriteString("- Use explicit argv arrays; never use shell syntax such as |, >, ; or $().\n")
+    b.WriteString("- To filter output, add \"pipeline\" stages (argv arrays fed the previous stage's stdout) instead of extra steps.\n")
+    b.WriteString("- To save output, set \"stdout_file\" to an absolute path under /tmp/lucicodex; omit both fields otherwise.\n")
+    b.WriteString("- Use \"stdin\" for payloads a command reads from standard input (e.g. uci batch) instead of echo or heredocs.\n")
+    b.WriteString("- To replace a whole file, use a \"write_file\" step (no \"command\") with the full new content; set \"backup\": true when overwriting existing files. Prefer uci commands for /etc/config.\n")
+    b.WriteString("- Set \"independent\": true only on steps that neither depend on nor change anything other steps use (e.g. diagnostics); they may run concurrently.\n")
+    b.WriteString(UntrustedRule)
+    b.WriteString("- Values such as __SECRET_1__ are redacted secrets; copy the placeholder verbatim where the real value is needed.\n")
     b.WriteString("- Prefer OpenWrt tools: uci, ubus, fw4, opkg, logread, dmesg.\n")
     b.WriteString("- Limit commands to safe, idempotent operations when possible.\n")
     b.WriteString("- Keep the commands minimal and directly actionable.\n")
@@ -44,11 +106,10 @@ func BuildInstructionWithLimit(maxCommands int) string {
     return base
 }
 
-// TryUnmarshalPlan attempts to decode a JSON string to Plan.
+// TryUnmarshalPlan decodes a JSON string to Plan, validating it strictly
+// against the plan schema (see DecodeStrict).
 func TryUnmarshalPlan(s string) (Plan, error) {
-    var p Plan
-    err := json.Unmarshal([]byte(s), &p)
-    return p, err
+    return DecodeStrict([]byte(s))
 }
 
 
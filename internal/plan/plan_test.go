@@ -2,6 +2,7 @@ package plan
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -188,13 +189,13 @@ func TestTryUnmarshalPlan_WrongSchema(t *testing.T) {
 		"wrong_field": "value"
 	}`
 
-	plan, err := TryUnmarshalPlan(wrongSchema)
-	if err != nil {
-		t.Fatalf("TryUnmarshalPlan failed: %v", err)
+	_, err := TryUnmarshalPlan(wrongSchema)
+	if err == nil {
+		t.Fatal("expected error for wrong schema")
 	}
-
-	if len(plan.Commands) != 0 {
-		t.Errorf("expected 0 commands for wrong schema, got %d", len(plan.Commands))
+	var se *SchemaError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *SchemaError, got %T: %v", err, err)
 	}
 }
 
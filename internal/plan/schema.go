@@ -0,0 +1,206 @@
+package plan
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SchemaVersion is the plan format version understood by this build.
+const SchemaVersion = 1
+
+//go:embed plan.schema.json
+var schemaJSON []byte
+
+// Schema returns the published JSON Schema for Plan.
+func Schema() []byte { return append([]byte(nil), schemaJSON...) }
+
+// SchemaError reports a schema violation at a JSON path such as
+// $.commands[2].command.
+type SchemaError struct {
+	Path string
+	Msg  string
+}
+
+func (e *SchemaError) Error() string { return e.Path + ": " + e.Msg }
+
+// schemaNode is the subset of JSON Schema used by plan.schema.json.
+type schemaNode struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Enum                 []string               `json:"enum"`
+	OneOf                []*schemaNode          `json:"oneOf"`
+}
+
+var planSchema = mustParseSchema(schemaJSON)
+
+func mustParseSchema(b []byte) *schemaNode {
+	var n schemaNode
+	if err := json.Unmarshal(b, &n); err != nil {
+		panic("plan: invalid embedded schema: " + err.Error())
+	}
+	return &n
+}
+
+// ValidateJSON checks raw JSON against the plan schema and returns the first
+// violation as a *SchemaError.
+func ValidateJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid JSON: trailing data after plan object")
+	}
+	return planSchema.validate("$", v)
+}
+
+// DecodeStrict validates data against the plan schema and decodes it.
+// Unknown fields, wrong types and missing commands are rejected.
+func DecodeStrict(data []byte) (Plan, error) {
+	var p Plan
+	if err := ValidateJSON(data); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, err
+	}
+	if p.SchemaVersion == 0 {
+		p.SchemaVersion = SchemaVersion
+	}
+	return p, nil
+}
+
+func (n *schemaNode) validate(path string, v any) error {
+	fail := func(format string, args ...any) error {
+		return &SchemaError{Path: path, Msg: fmt.Sprintf(format, args...)}
+	}
+	if len(n.OneOf) > 0 {
+		matched := 0
+		var alts []string
+		for _, alt := range n.OneOf {
+			if alt.validate(path, v) == nil {
+				matched++
+			}
+			alts = append(alts, strings.Join(alt.Required, "+"))
+		}
+		if matched != 1 {
+			return fail("expected exactly one of %s", strings.Join(alts, ", "))
+		}
+	}
+	if obj, ok := v.(map[string]any); ok {
+		for _, r := range n.Required {
+			if _, ok := obj[r]; !ok {
+				return fail("missing required field %q", r)
+			}
+		}
+	}
+	switch n.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fail("expected object, got %s", jsonType(v))
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child, ok := n.Properties[k]
+			if !ok {
+				if n.AdditionalProperties != nil && !*n.AdditionalProperties {
+					return fail("unknown field %q", k)
+				}
+				continue
+			}
+			if err := child.validate(path+"."+k, obj[k]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fail("expected array, got %s", jsonType(v))
+		}
+		if n.MinItems != nil && len(arr) < *n.MinItems {
+			return fail("expected at least %d item(s), got %d", *n.MinItems, len(arr))
+		}
+		if n.Items != nil {
+			for i, item := range arr {
+				if err := n.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fail("expected string, got %s", jsonType(v))
+		}
+		if len(n.Enum) > 0 {
+			for _, e := range n.Enum {
+				if s == e {
+					return nil
+				}
+			}
+			return fail("expected one of %s, got %q", strings.Join(n.Enum, ", "), s)
+		}
+	case "integer", "number":
+		num, ok := v.(json.Number)
+		if !ok {
+			return fail("expected %s, got %s", n.Type, jsonType(v))
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fail("invalid number %s", num)
+		}
+		if n.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return fail("expected integer, got %s", num)
+			}
+		}
+		if n.Minimum != nil && f < *n.Minimum {
+			return fail("must be >= %v, got %s", *n.Minimum, num)
+		}
+		if n.Maximum != nil && f > *n.Maximum {
+			return fail("must be <= %v, got %s", *n.Maximum, num)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("expected boolean, got %s", jsonType(v))
+		}
+	}
+	return nil
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
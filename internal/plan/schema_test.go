@@ -0,0 +1,93 @@
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchema_IsValidJSON(t *testing.T) {
+	var v map[string]any
+	if err := json.Unmarshal(Schema(), &v); err != nil {
+		t.Fatalf("embedded schema is not valid JSON: %v", err)
+	}
+	max := planSchema.Properties["schema_version"].Maximum
+	if max == nil || int(*max) != SchemaVersion {
+		t.Errorf("schema_version maximum does not match SchemaVersion %d", SchemaVersion)
+	}
+}
+
+func TestDecodeStrict_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		path string
+	}{
+		{"missing commands", `{"cmds":[{"command":["uci","show"]}]}`, "$"},
+		{"unknown top-level field", `{"commands":[],"cmds":[]}`, "$"},
+		{"null commands", `{"commands":null}`, "$.commands"},
+		{"argv as string", `{"commands":[{"command":["uci"]},{"command":"uci show"}]}`, "$.commands[1].command"},
+		{"empty argv", `{"commands":[{"command":[]}]}`, "$.commands[0].command"},
+		{"non-string arg", `{"commands":[{"command":["uci",1]}]}`, "$.commands[0].command[1]"},
+		{"unknown command field", `{"commands":[{"command":["uci"],"sudo":true}]}`, "$.commands[0]"},
+		{"wrong bool type", `{"commands":[{"command":["uci"],"needs_root":"yes"}]}`, "$.commands[0].needs_root"},
+		{"future version", `{"schema_version":99,"commands":[]}`, "$.schema_version"},
+		{"fractional version", `{"schema_version":1.5,"commands":[]}`, "$.schema_version"},
+		{"not an object", `[]`, "$"},
+		{"step without command or write_file", `{"commands":[{"description":"x"}]}`, "$.commands[0]"},
+		{"command and write_file", `{"commands":[{"command":["uci"],"write_file":{"path":"/tmp/x","content":""}}]}`, "$.commands[0]"},
+		{"write_file without content", `{"commands":[{"write_file":{"path":"/tmp/x"}}]}`, "$.commands[0].write_file"},
+	}
+	for _, c := range cases {
+		_, err := DecodeStrict([]byte(c.in))
+		var se *SchemaError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: expected *SchemaError, got %v", c.name, err)
+			continue
+		}
+		if se.Path != c.path {
+			t.Errorf("%s: expected path %s, got %s (%v)", c.name, c.path, se.Path, se)
+		}
+	}
+}
+
+func TestDecodeStrict_TrailingData(t *testing.T) {
+	if _, err := DecodeStrict([]byte(`{"commands":[]} {"commands":[]}`)); err == nil {
+		t.Fatal("expected error for trailing data")
+	}
+}
+
+func TestDecodeStrict_SetsVersion(t *testing.T) {
+	p, err := DecodeStrict([]byte(`{"commands":[{"command":["uci","show"]}]}`))
+	if err != nil {
+		t.Fatalf("DecodeStrict failed: %v", err)
+	}
+	if p.SchemaVersion != SchemaVersion {
+		t.Errorf("expected schema version %d, got %d", SchemaVersion, p.SchemaVersion)
+	}
+}
+
+func TestDecodeStrict_WriteFile(t *testing.T) {
+	p, err := DecodeStrict([]byte(`{"commands":[{"write_file":{"path":"/etc/config/x","content":"config x\n","mode":"0644","backup":true}},{"command":["uci","batch"],"stdin":"set x.a=b\n"}]}`))
+	if err != nil {
+		t.Fatalf("DecodeStrict failed: %v", err)
+	}
+	w := p.Commands[0].WriteFile
+	if !p.Commands[0].IsWrite() || w.Path != "/etc/config/x" || w.Mode != "0644" || !w.Backup {
+		t.Errorf("unexpected write_file step %+v", w)
+	}
+	if p.Commands[1].IsWrite() || p.Commands[1].Stdin != "set x.a=b\n" {
+		t.Errorf("unexpected stdin step %+v", p.Commands[1])
+	}
+}
+
+func TestDecodeStrict_RoundTrip(t *testing.T) {
+	in := Plan{Commands: []PlannedCommand{{WriteFile: &WriteFile{Path: "/tmp/lucicodex/x", Content: "x"}}, {Command: []string{"cat"}, Stdin: "x"}}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeStrict(b); err != nil {
+		t.Fatalf("marshaled plan does not validate: %v\n%s", err, b)
+	}
+}
@@ -159,8 +159,8 @@ func (p *ExternalPlugin) GeneratePlan(ctx context.Context, prompt string) (plan.
         return plan.Plan{}, fmt.Errorf("plugin execution failed: %w", err)
     }
     
-    var planResult plan.Plan
-    if err := json.Unmarshal(output, &planResult); err != nil {
+    planResult, err := plan.TryUnmarshalPlan(string(output))
+    if err != nil {
         return plan.Plan{}, fmt.Errorf("invalid plan output: %w", err)
     }
     
@@ -2,7 +2,9 @@ package policy
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/aezizhu/LuciCodex/internal/config"
@@ -13,10 +15,12 @@ type Engine struct {
 	cfg      config.Config
 	allowREs []*regexp.Regexp
 	denyREs  []*regexp.Regexp
+	// uciDir is read to find the types of named sections for value checks.
+	uciDir string
 }
 
 func New(cfg config.Config) *Engine {
-	e := &Engine{cfg: cfg}
+	e := &Engine{cfg: cfg, uciDir: "/etc/config"}
 	for _, p := range cfg.Allowlist {
 		if re, err := regexp.Compile(p); err == nil {
 			e.allowREs = append(e.allowREs, re)
@@ -30,39 +34,140 @@ func New(cfg config.Config) *Engine {
 	return e
 }
 
+// RequiresConfirmation reports whether p must be confirmed interactively.
+// Plans generated from untrusted device data may follow instructions
+// injected into that data, so they are never auto-approved.
+func RequiresConfirmation(p plan.Plan, autoApprove bool) bool {
+	return !autoApprove || p.Untrusted
+}
+
 func (e *Engine) ValidatePlan(p plan.Plan) error {
 	for i, c := range p.Commands {
+		if c.IsWrite() {
+			if err := e.validateWrite(c); err != nil {
+				return fmt.Errorf("command %d write_file: %w", i, err)
+			}
+			continue
+		}
 		if len(c.Command) == 0 {
 			return fmt.Errorf("command %d is empty", i)
 		}
-		// Basic argv checks
-		for j, a := range c.Command {
-			if strings.TrimSpace(a) == "" {
-				return fmt.Errorf("command %d arg %d is empty", i, j)
+		for s, stage := range c.Stages() {
+			label := fmt.Sprintf("command %d", i)
+			if s > 0 {
+				label = fmt.Sprintf("command %d stage %d", i, s)
 			}
-			if strings.ContainsAny(a, "\x00") {
-				return fmt.Errorf("command %d arg %d contains NUL", i, j)
+			if err := e.validateArgv(label, stage); err != nil {
+				return err
 			}
 		}
-		if strings.ContainsAny(c.Command[0], "|&;><`$") {
-			return fmt.Errorf("command %d contains shell metacharacters in argv[0]", i)
-		}
-		cmdline := strings.Join(c.Command, " ")
-		for _, re := range e.denyREs {
-			if re.MatchString(cmdline) {
-				return fmt.Errorf("command %d denied by policy: %s", i, cmdline)
+		if c.StdoutFile != "" {
+			if err := e.validateOutputPath(c.StdoutFile); err != nil {
+				return fmt.Errorf("command %d stdout_file: %w", i, err)
 			}
 		}
-		allowed := false
-		for _, re := range e.allowREs {
-			if re.MatchString(cmdline) {
-				allowed = true
-				break
-			}
+		if err := validatePayload(c.Stdin); err != nil {
+			return fmt.Errorf("command %d stdin: %w", i, err)
+		}
+	}
+	for _, pr := range e.checkUCIValues(p) {
+		if !pr.warn {
+			return fmt.Errorf("step %d: invalid uci value: %s", pr.step+1, pr.msg)
+		}
+	}
+	return nil
+}
+
+// validateArgv checks a single argv (a command or one pipeline stage).
+func (e *Engine) validateArgv(label string, argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("%s is empty", label)
+	}
+	// Basic argv checks
+	for j, a := range argv {
+		if strings.TrimSpace(a) == "" {
+			return fmt.Errorf("%s arg %d is empty", label, j)
+		}
+		if strings.ContainsAny(a, "\x00") {
+			return fmt.Errorf("%s arg %d contains NUL", label, j)
+		}
+	}
+	if strings.ContainsAny(argv[0], "|&;><`$") {
+		return fmt.Errorf("%s contains shell metacharacters in argv[0]", label)
+	}
+	cmdline := strings.Join(argv, " ")
+	for _, re := range e.denyREs {
+		if re.MatchString(cmdline) {
+			return fmt.Errorf("%s denied by policy: %s", label, cmdline)
+		}
+	}
+	for _, re := range e.allowREs {
+		if re.MatchString(cmdline) {
+			return nil
 		}
-		if !allowed {
-			return fmt.Errorf("command %d not allowed by policy: %s", i, cmdline)
+	}
+	return fmt.Errorf("%s not allowed by policy: %s", label, cmdline)
+}
+
+// validateOutputPath allows only clean absolute paths inside cfg.OutputDirs.
+func (e *Engine) validateOutputPath(path string) error {
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return fmt.Errorf("%q must be a clean absolute path", path)
+	}
+	for _, dir := range e.cfg.OutputDirs {
+		dir = filepath.Clean(dir)
+		if dir != "/" && strings.HasPrefix(path, dir+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not in an allowed output directory", path)
+}
+
+// maxPayload bounds stdin payloads and write_file content.
+const maxPayload = 256 << 10
+
+var fileModeRE = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// validateWrite checks a write_file step: the path must be a clean absolute
+// path equal to or inside one of cfg.WritePaths, and the mode must not grant
+// write access to others or set special bits.
+func (e *Engine) validateWrite(c plan.PlannedCommand) error {
+	w := c.WriteFile
+	if len(c.Command) > 0 || len(c.Pipeline) > 0 || c.StdoutFile != "" || c.Stdin != "" {
+		return fmt.Errorf("cannot be combined with command, pipeline, stdout_file or stdin")
+	}
+	if !filepath.IsAbs(w.Path) || filepath.Clean(w.Path) != w.Path || w.Path == "/" {
+		return fmt.Errorf("%q must be a clean absolute path", w.Path)
+	}
+	allowed := false
+	for _, p := range e.cfg.WritePaths {
+		p = filepath.Clean(p)
+		if p != "/" && (w.Path == p || strings.HasPrefix(w.Path, p+"/")) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%q is not in an allowed write path", w.Path)
+	}
+	if w.Mode != "" {
+		if !fileModeRE.MatchString(w.Mode) {
+			return fmt.Errorf("mode %q must be octal permissions such as 0644", w.Mode)
 		}
+		if m, _ := strconv.ParseUint(w.Mode, 8, 32); m&0o002 != 0 {
+			return fmt.Errorf("mode %q must not be world-writable", w.Mode)
+		}
+	}
+	return validatePayload(w.Content)
+}
+
+// validatePayload limits the size of stdin and file content and rejects NUL.
+func validatePayload(s string) error {
+	if len(s) > maxPayload {
+		return fmt.Errorf("payload of %d bytes exceeds %d bytes", len(s), maxPayload)
+	}
+	if strings.Contains(s, "\x00") {
+		return fmt.Errorf("payload contains NUL")
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package policy
 
 import (
+    "strings"
     "testing"
 
     "github.com/aezizhu/LuciCodex/internal/config"
@@ -34,3 +35,93 @@ func TestValidatePlan(t *testing.T) {
 }
 
 
+
+func TestValidatePlan_Pipeline(t *testing.T) {
+    cfg := config.Config{
+        Allowlist:  []string{`^logread(\s|$)`, `^grep(\s|$)`},
+        Denylist:   []string{`^rm(\s|$)`},
+        OutputDirs: []string{"/tmp/lucicodex"},
+    }
+    e := New(cfg)
+    step := func(stages [][]string, out string) plan.Plan {
+        return plan.Plan{Commands: []plan.PlannedCommand{{Command: stages[0], Pipeline: stages[1:], StdoutFile: out}}}
+    }
+    cases := []struct {
+        name string
+        p    plan.Plan
+        ok   bool
+    }{
+        {"ok pipeline", step([][]string{{"logread"}, {"grep", "-i", "dhcp|dnsmasq"}}, ""), true},
+        {"ok redirect", step([][]string{{"logread"}}, "/tmp/lucicodex/log.txt"), true},
+        {"stage not allowed", step([][]string{{"logread"}, {"sh", "-c", "id"}}, ""), false},
+        {"stage denied", step([][]string{{"logread"}, {"rm", "x"}}, ""), false},
+        {"empty stage", step([][]string{{"logread"}, {}}, ""), false},
+        {"stage metachar", step([][]string{{"logread"}, {"grep;id"}}, ""), false},
+        {"redirect outside", step([][]string{{"logread"}}, "/etc/passwd"), false},
+        {"redirect traversal", step([][]string{{"logread"}}, "/tmp/lucicodex/../../etc/passwd"), false},
+        {"redirect relative", step([][]string{{"logread"}}, "log.txt"), false},
+        {"redirect dir itself", step([][]string{{"logread"}}, "/tmp/lucicodex"), false},
+    }
+    for _, c := range cases {
+        err := e.ValidatePlan(c.p)
+        if c.ok && err != nil {
+            t.Fatalf("%s unexpected error: %v", c.name, err)
+        }
+        if !c.ok && err == nil {
+            t.Fatalf("%s expected error", c.name)
+        }
+    }
+}
+
+func TestValidatePlan_WriteFile(t *testing.T) {
+    cfg := config.Config{
+        Allowlist:  []string{`^uci(\s|$)`},
+        WritePaths: []string{"/etc/config", "/etc/dropbear/authorized_keys"},
+    }
+    e := New(cfg)
+    write := func(path, mode string) plan.PlannedCommand {
+        return plan.PlannedCommand{WriteFile: &plan.WriteFile{Path: path, Content: "config x\n", Mode: mode}}
+    }
+    withCmd := write("/etc/config/x", "")
+    withCmd.Command = []string{"uci", "show"}
+    cases := []struct {
+        name string
+        c    plan.PlannedCommand
+        ok   bool
+    }{
+        {"ok dir", write("/etc/config/network", "0644"), true},
+        {"ok exact file", write("/etc/dropbear/authorized_keys", "600"), true},
+        {"ok stdin", plan.PlannedCommand{Command: []string{"uci", "batch"}, Stdin: "set x.a=b\n"}, true},
+        {"outside", write("/etc/passwd", ""), false},
+        {"traversal", write("/etc/config/../shadow", ""), false},
+        {"relative", write("config/x", ""), false},
+        {"sibling prefix", write("/etc/config2/x", ""), false},
+        {"world writable", write("/etc/config/x", "0666"), false},
+        {"setuid", write("/etc/config/x", "4755"), false},
+        {"bad mode", write("/etc/config/x", "rw-r--r--"), false},
+        {"combined with command", withCmd, false},
+        {"stdin NUL", plan.PlannedCommand{Command: []string{"uci", "batch"}, Stdin: "a\x00b"}, false},
+        {"stdin too large", plan.PlannedCommand{Command: []string{"uci", "batch"}, Stdin: strings.Repeat("x", maxPayload+1)}, false},
+    }
+    for _, c := range cases {
+        err := e.ValidatePlan(plan.Plan{Commands: []plan.PlannedCommand{c.c}})
+        if c.ok && err != nil {
+            t.Fatalf("%s unexpected error: %v", c.name, err)
+        }
+        if !c.ok && err == nil {
+            t.Fatalf("%s expected error", c.name)
+        }
+    }
+}
+
+func TestRequiresConfirmation(t *testing.T) {
+    if !RequiresConfirmation(plan.Plan{}, false) {
+        t.Error("plans need confirmation without auto-approve")
+    }
+    if RequiresConfirmation(plan.Plan{}, true) {
+        t.Error("auto-approve should skip confirmation for trusted plans")
+    }
+    if !RequiresConfirmation(plan.Plan{Untrusted: true}, true) {
+        t.Error("untrusted plans must always be confirmed")
+    }
+}
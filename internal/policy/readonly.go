@@ -0,0 +1,247 @@
+package policy
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// ReadOnly reports whether a planned step only inspects state. Every stage of
+// a pipeline must be read-only; redirection and file writes never are.
+// Unknown programs are not read-only.
+func (e *Engine) ReadOnly(c plan.PlannedCommand) bool {
+	if c.IsWrite() || c.StdoutFile != "" || len(c.Command) == 0 {
+		return false
+	}
+	for _, argv := range c.Stages() {
+		if !readOnlyArgv(argv) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadOnlyPlan reports whether every step of p is read-only.
+func (e *Engine) ReadOnlyPlan(p plan.Plan) bool {
+	for _, c := range p.Commands {
+		if !e.ReadOnly(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func readOnlyArgv(argv []string) bool {
+	if len(argv) == 0 {
+		return false
+	}
+	check, ok := readOnlyCommands[filepath.Base(argv[0])]
+	return ok && check(argv[1:])
+}
+
+func always(args []string) bool { return true }
+
+func noArgs(args []string) bool { return len(args) == 0 }
+
+// without returns a check rejecting any argument starting with one of the
+// given flags. A single-letter flag such as -c is also found inside a
+// cluster of short flags such as -rc.
+func without(flags ...string) func([]string) bool {
+	return func(args []string) bool {
+		for _, a := range args {
+			if a == "--" {
+				return true
+			}
+			for _, f := range flags {
+				if strings.HasPrefix(a, f) {
+					return false
+				}
+				if len(f) == 2 && f[0] == '-' && len(a) > 1 && a[0] == '-' && a[1] != '-' && strings.IndexByte(a[1:], f[1]) >= 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// firstArgIn accepts commands whose first non-flag argument is one of subs.
+func firstArgIn(subs ...string) func([]string) bool {
+	return func(args []string) bool {
+		words := positional(args)
+		if len(words) == 0 {
+			return false
+		}
+		first := words[0]
+		for _, s := range subs {
+			if first == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// readOnlyCommands maps a program to the check of its arguments.
+var readOnlyCommands = map[string]func([]string) bool{
+	"cat": always, "head": always, "tail": always, "grep": always, "egrep": always,
+	"fgrep": always, "wc": always, "cut": always, "tr": always, "ls": always,
+	"df": always, "du": always, "free": always, "uptime": always, "uname": always,
+	"ps": always, "top": always, "logread": always, "lsmod": always, "id": always,
+	"whoami": always, "which": always, "echo": always, "printf": always, "true": always,
+	"jsonfilter": always, "ifstatus": always, "iwinfo": always, "ping": always,
+	"ping6": always, "traceroute": always, "nslookup": always, "netstat": always,
+	"hostname": noArgs, "mount": noArgs,
+	"sort":  sortReadOnly,
+	"ss":    without("-K", "--kill"),
+	"arp":   without("-d", "-s", "--delete", "--set"),
+	"dmesg": without("-c", "-C", "-n", "-D", "-E", "--clear", "--read-clear", "--console"),
+	"date":  dateReadOnly,
+	"ip":    ipReadOnly,
+	"uci":   uciReadOnly,
+	"ubus":  ubusReadOnly,
+	"opkg":  firstArgIn("list", "list-installed", "list-upgradable", "info", "status", "find", "files", "search", "depends", "whatdepends", "whatprovides"),
+	"fw4":   firstArgIn("print", "check"),
+	"nft":   firstArgIn("list"),
+	"wifi":  firstArgIn("status"),
+}
+
+// dateReadOnly accepts formats and output flags but not setting the clock.
+func dateReadOnly(args []string) bool {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "+") && a != "-u" && a != "-R" && !strings.HasPrefix(a, "-I") {
+			return false
+		}
+	}
+	return true
+}
+
+// sortReadOnly rejects writing the result to a file, whether as --output,
+// -o FILE or an o inside a cluster of short flags such as -uo FILE, and
+// running a compressor for temporary files.
+func sortReadOnly(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return true
+		}
+		if strings.HasPrefix(a, "--") {
+			if strings.HasPrefix(a, "--output") || strings.HasPrefix(a, "--compress-program") {
+				return false
+			}
+			continue
+		}
+		if strings.HasPrefix(a, "-") && strings.ContainsRune(a, 'o') {
+			return false
+		}
+	}
+	return true
+}
+
+// positional returns the non-flag arguments; valueFlags take the next
+// argument as their value.
+func positional(args []string, valueFlags ...string) []string {
+	var words []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") {
+			words = append(words, a)
+			continue
+		}
+		for _, f := range valueFlags {
+			if a == f {
+				i++
+				break
+			}
+		}
+	}
+	return words
+}
+
+// ipReadOnly accepts "ip [options] OBJECT [show|list|get]". Batch mode
+// (-batch, or -force which implies it) reads commands from a file, which
+// may change anything, so it is never read-only. ip accepts any
+// abbreviation of an option and a second leading dash.
+func ipReadOnly(args []string) bool {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			continue
+		}
+		opt := "-" + strings.TrimPrefix(a[1:], "-")
+		if len(opt) >= 2 && strings.HasPrefix("-batch", opt) || len(opt) >= 3 && strings.HasPrefix("-force", opt) {
+			return false
+		}
+	}
+	words := positional(args, "-n", "-netns", "-f", "-family", "-rc", "-rcvbuf")
+	if len(words) < 2 {
+		return len(words) == 1
+	}
+	switch words[1] {
+	case "show", "sh", "list", "lst", "ls", "get":
+		return true
+	}
+	return false
+}
+
+func uciReadOnly(args []string) bool {
+	uc, ok := openwrt.ParseUCICommand(append([]string{"uci"}, args...))
+	if !ok {
+		return false
+	}
+	switch uc.Sub {
+	case "show", "get", "export", "changes":
+		return true
+	}
+	return false
+}
+
+// ubusQueries lists the ubus methods that only report state, as path.Match
+// patterns of object and method. Methods not listed are not read-only, even
+// when their names look like queries.
+var ubusQueries = []struct {
+	object  string
+	methods []string
+}{
+	{"system", []string{"board", "info"}},
+	{"network.interface", []string{"dump"}},
+	{"network.interface.*", []string{"status", "dump"}},
+	{"network.device", []string{"status"}},
+	{"network.wireless", []string{"status"}},
+	{"uci", []string{"get", "changes", "configs"}},
+	{"service", []string{"list"}},
+	{"luci-rpc", []string{"get*"}},
+	{"iwinfo", []string{"devices", "info", "assoclist"}},
+	{"dhcp", []string{"ipv4leases", "ipv6leases"}},
+	{"hostapd.*", []string{"get_clients", "get_status"}},
+	{"log", []string{"read"}},
+}
+
+// ubusReadOnly accepts listing objects and calling the methods in
+// ubusQueries.
+func ubusReadOnly(args []string) bool {
+	words := positional(args, "-s", "-t")
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "list":
+		return true
+	case "call":
+		if len(words) < 3 {
+			return false
+		}
+		for _, q := range ubusQueries {
+			if ok, _ := path.Match(q.object, words[1]); !ok {
+				continue
+			}
+			for _, m := range q.methods {
+				if ok, _ := path.Match(m, words[2]); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func TestReadOnly(t *testing.T) {
+	e := New(config.Config{})
+	cases := []struct {
+		cmd  string
+		want bool
+	}{
+		{"uci show network", true},
+		{"uci -q get network.lan.ipaddr", true},
+		{"uci set network.lan.ipaddr=192.168.2.1", false},
+		{"ubus call system board", true},
+		{"ubus -t 5 call network.interface.wan status", true},
+		{"ubus call network reload", false},
+		{"ubus call network.interface dump", true},
+		{"ubus call network.device status", true},
+		{"ubus call uci get {\"config\":\"network\"}", true},
+		{"ubus call uci set {\"config\":\"network\"}", false},
+		{"ubus call service list", true},
+		{"ubus call luci-rpc getDHCPLeases", true},
+		{"ubus call luci setInitAction", false},
+		{"ubus call rc init {\"name\":\"firewall\",\"action\":\"restart\"}", false},
+		{"ubus call system info_reset", false},
+		{"ubus call file list {\"path\":\"/\"}", false},
+		{"ubus call service event {}", false},
+		{"ubus list", true},
+		{"ip addr", true},
+		{"ip -4 route show", true},
+		{"ip -n blue addr show", true},
+		{"ip addr add 10.0.0.1/24 dev br-lan", false},
+		{"ip link set eth0 down", false},
+		{"/usr/bin/logread -e dnsmasq", true},
+		{"opkg list-installed", true},
+		{"opkg install tcpdump", false},
+		{"dmesg", true},
+		{"dmesg -c", false},
+		{"dmesg -rc", false},
+		{"dmesg -Tc", false},
+		{"dmesg -rT", true},
+		{"dmesg --read-clear", false},
+		{"ss -tK", false},
+		{"ss -tlnp", true},
+		{"arp -nd 1.2.3.4", false},
+		{"arp -ns 1.2.3.4 aa:bb:cc:dd:ee:ff", false},
+		{"arp -an", true},
+		{"ip -b /tmp/x link show", false},
+		{"ip -batch /tmp/x addr show", false},
+		{"ip -force -b /tmp/x addr show", false},
+		{"ip -force addr show", false},
+		{"ip --ba /tmp/x addr show", false},
+		{"ip -fo addr show", false},
+		{"ip -f inet addr show", true},
+		{"ip addr show dev b", true},
+		{"date +%s", true},
+		{"date -s 2024-01-01", false},
+		{"sort -o /etc/passwd x", false},
+		{"sort -uo /etc/passwd x", false},
+		{"sort -ro /etc/passwd x", false},
+		{"sort --output=/etc/passwd x", false},
+		{"sort --compress-program=sh x", false},
+		{"sort -u -k2 x", true},
+		{"hostname", true},
+		{"hostname evil", false},
+		{"fw4 print", true},
+		{"fw4 restart", false},
+		{"reboot", false},
+		{"rm -rf /tmp/x", false},
+	}
+	for _, c := range cases {
+		got := e.ReadOnly(plan.PlannedCommand{Command: strings.Fields(c.cmd)})
+		if got != c.want {
+			t.Errorf("%q: expected %v, got %v", c.cmd, c.want, got)
+		}
+	}
+}
+
+func TestReadOnly_Steps(t *testing.T) {
+	e := New(config.Config{})
+	if !e.ReadOnly(plan.PlannedCommand{Command: []string{"logread"}, Pipeline: [][]string{{"grep", "dhcp"}, {"tail", "-n", "5"}}}) {
+		t.Error("expected read-only pipeline")
+	}
+	if e.ReadOnly(plan.PlannedCommand{Command: []string{"logread"}, Pipeline: [][]string{{"tee", "/etc/x"}}}) {
+		t.Error("pipeline with an unknown stage must not be read-only")
+	}
+	if e.ReadOnly(plan.PlannedCommand{Command: []string{"logread"}, StdoutFile: "/tmp/lucicodex/log"}) {
+		t.Error("redirected command must not be read-only")
+	}
+	if e.ReadOnly(plan.PlannedCommand{WriteFile: &plan.WriteFile{Path: "/tmp/lucicodex/x"}}) {
+		t.Error("write_file step must not be read-only")
+	}
+}
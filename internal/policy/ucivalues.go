@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+	"github.com/aezizhu/LuciCodex/internal/uci"
+)
+
+// uciProblem is a value of a uci write that does not match its schema.
+// warn is set for lenient schemas and for every problem in "warn" mode.
+type uciProblem struct {
+	step int
+	msg  string
+	warn bool
+}
+
+// checkUCIValues checks the values of uci set and add_list steps, including
+// those of "uci batch" scripts on stdin, against uci.Schemas. Section types
+// come from @type[n] references, from sections the plan itself creates and
+// from the live configuration; options of sections whose type stays unknown
+// are checked only when the option is unambiguous within its package.
+func (e *Engine) checkUCIValues(p plan.Plan) []uciProblem {
+	mode := e.cfg.UCIValidation
+	if mode == "off" {
+		return nil
+	}
+	tree := uci.NewTree(e.uciDir)
+	created := map[string]string{}
+	var problems []uciProblem
+	check := func(step int, sub string, k uci.Key) {
+		if k.Section == "" || !k.HasValue {
+			return
+		}
+		if k.Option == "" {
+			if sub == "set" {
+				created[k.Package+"."+k.Section] = k.Value
+			}
+			return
+		}
+		if k.Value == "" || (sub != "set" && sub != "add_list") {
+			return
+		}
+		typ := sectionType(tree, created, k)
+		o, ok := uci.Lookup(k.Package, typ, k.Option)
+		if !ok {
+			return
+		}
+		err := o.Validate(k.Value)
+		if sub == "set" {
+			err = o.ValidateSet(k.Value)
+		}
+		if err != nil {
+			msg := fmt.Sprintf("%s.%s.%s: %v", k.Package, k.Section, k.Option, err)
+			problems = append(problems, uciProblem{step: step, msg: msg, warn: o.Lenient || mode == "warn"})
+		}
+	}
+	for i, c := range p.Commands {
+		uc, ok := openwrt.ParseUCICommand(c.Command)
+		if !ok || uc.HasOption("-c", "-f", "-p", "-P", "-t") {
+			continue
+		}
+		switch uc.Sub {
+		case "set", "add_list":
+			if len(uc.Args) == 1 {
+				if k, err := uci.ParseKey(uc.Args[0]); err == nil {
+					check(i, uc.Sub, k)
+				}
+			}
+		case "batch":
+			for _, line := range strings.Split(c.Stdin, "\n") {
+				words, err := uci.SplitWords(line)
+				if err != nil || len(words) != 2 {
+					continue
+				}
+				if k, err := uci.ParseKey(words[1]); err == nil {
+					check(i, words[0], k)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// sectionType returns the type of the section k refers to, or "" when it
+// cannot be determined.
+func sectionType(tree *uci.Tree, created map[string]string, k uci.Key) string {
+	if typ, ok := created[k.Package+"."+k.Section]; ok {
+		return typ
+	}
+	if strings.HasPrefix(k.Section, "@") {
+		typ, _, _ := strings.Cut(k.Section[1:], "[")
+		return typ
+	}
+	if pkg, err := tree.Package(k.Package); err == nil {
+		if s, err := pkg.Section(k.Section); err == nil {
+			return s.Type
+		}
+	}
+	return ""
+}
+
+// AnnotateUCI appends warnings for uci values that do not match their
+// schema but are not rejected by ValidatePlan: lenient schemas, or every
+// problem when uci_validation is "warn".
+func (e *Engine) AnnotateUCI(p *plan.Plan) {
+	for _, pr := range e.checkUCIValues(*p) {
+		if pr.warn {
+			p.Warnings = append(p.Warnings, fmt.Sprintf("uci: step %d: %s", pr.step+1, pr.msg))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func uciPlan(cmds ...string) plan.Plan {
+	var p plan.Plan
+	for _, c := range cmds {
+		p.Commands = append(p.Commands, plan.PlannedCommand{Command: strings.Fields(c)})
+	}
+	return p
+}
+
+func TestValidatePlan_UCIValues(t *testing.T) {
+	e := New(config.Config{Allowlist: []string{`^uci(\s|$)`}})
+	e.uciDir = "../uci/testdata"
+	cases := []struct {
+		name string
+		p    plan.Plan
+		want string
+	}{
+		{"valid", uciPlan("uci set network.lan.ipaddr=192.168.2.1", "uci set wireless.radio0.channel=36", "uci commit"), ""},
+		{"bad ipaddr", uciPlan("uci set network.lan.ipaddr=not-an-ip"), `step 1: invalid uci value: network.lan.ipaddr: "not-an-ip" is not an IPv4 address`},
+		{"bad channel", uciPlan("uci -q set wireless.radio0.channel=999"), "wireless.radio0.channel"},
+		{"type from reference", uciPlan("uci add_list firewall.@zone[0].network=guest", "uci set firewall.@zone[1].input=OPEN"), "step 2"},
+		{"section created by the plan", uciPlan("uci set firewall.ssh=rule", "uci set firewall.ssh.target=ALLOW"), "step 2: invalid uci value: firewall.ssh.target"},
+		{"unknown section type", uciPlan("uci set firewall.nosuch.target=ALLOW"), ""},
+		{"unknown option", uciPlan("uci set network.lan.foo=bar"), ""},
+		{"delete by empty value", uciPlan("uci set network.lan.mtu="), ""},
+		{"lenient schema", uciPlan("uci set wireless.default_radio0.encryption=wpa5"), ""},
+		{"batch", plan.Plan{Commands: []plan.PlannedCommand{{Command: []string{"uci", "batch"},
+			Stdin: "set network.lan.proto=static\nset network.lan.netmask='255.0.255.0'\ncommit network\n"}}}, "network.lan.netmask"},
+	}
+	for _, c := range cases {
+		err := e.ValidatePlan(c.p)
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("%s: got %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidatePlan_UCILiveSectionType(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "firewall"), []byte("config redirect 'web'\n\toption target 'DNAT'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := New(config.Config{Allowlist: []string{`^uci(\s|$)`}})
+	p := uciPlan("uci set firewall.web.target=ACCEPT")
+
+	// target means different things in rules and redirects, so it is only
+	// checked once the live config tells that web is a redirect.
+	e.uciDir = filepath.Join(dir, "missing")
+	if err := e.ValidatePlan(p); err != nil {
+		t.Errorf("unknown section type: %v", err)
+	}
+	e.uciDir = dir
+	if err := e.ValidatePlan(p); err == nil || !strings.Contains(err.Error(), "one of DNAT, SNAT") {
+		t.Errorf("redirect target: %v", err)
+	}
+}
+
+func TestAnnotateUCI(t *testing.T) {
+	p := uciPlan("uci set wireless.default_radio0.encryption=wpa5", "uci set wireless.radio0.channel=999")
+
+	e := New(config.Config{UCIValidation: "warn"})
+	e.uciDir = "../uci/testdata"
+	e.AnnotateUCI(&p)
+	want := []string{
+		`uci: step 1: wireless.default_radio0.encryption: "wpa5" is not an encryption such as psk2+ccmp or sae`,
+		`uci: step 2: wireless.radio0.channel: "999" is not a channel (1-233 or auto)`,
+	}
+	if strings.Join(p.Warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings:\n%s", strings.Join(p.Warnings, "\n"))
+	}
+
+	// In reject mode only lenient schemas warn; the rest is rejected.
+	p.Warnings = nil
+	New(config.Config{}).AnnotateUCI(&p)
+	if len(p.Warnings) != 1 || !strings.Contains(p.Warnings[0], "encryption") {
+		t.Errorf("reject mode warnings: %v", p.Warnings)
+	}
+
+	off := New(config.Config{UCIValidation: "off", Allowlist: []string{`^uci(\s|$)`}})
+	if err := off.ValidatePlan(p); err != nil {
+		t.Errorf("off: %v", err)
+	}
+	off.AnnotateUCI(&p)
+	if len(p.Warnings) != 1 {
+		t.Errorf("off mode added warnings: %v", p.Warnings)
+	}
+}
@@ -0,0 +1,364 @@
+package recipe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// Supported parameter types.
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypePort   = "port"
+	TypeIP     = "ip"
+	TypeIPv4   = "ipv4"
+	TypeIPv6   = "ipv6"
+	TypeMAC    = "mac"
+	TypeIface  = "iface"
+)
+
+var (
+	placeholderRE = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	nameRE        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	ifaceRE       = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,15}$`)
+)
+
+// Param declares a typed placeholder used by a recipe.
+type Param struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// Recipe is a saved plan whose argv may contain {{placeholders}}.
+type Recipe struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Params      []Param   `json:"params,omitempty"`
+	Plan        plan.Plan `json:"plan"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Placeholders returns the distinct placeholder names referenced by the plan, sorted.
+func Placeholders(p plan.Plan) []string {
+	seen := map[string]bool{}
+	collect := func(s string) {
+		for _, m := range placeholderRE.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	}
+	collect(p.Summary)
+	for _, c := range p.Commands {
+		for _, argv := range c.Stages() {
+			for _, a := range argv {
+				collect(a)
+			}
+		}
+		collect(c.StdoutFile)
+		collect(c.Stdin)
+		if w := c.WriteFile; w != nil {
+			collect(w.Path)
+			collect(w.Content)
+		}
+		collect(c.Description)
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the recipe name, parameter declarations and that every
+// placeholder in the plan is declared.
+func (r Recipe) Validate() error {
+	if !nameRE.MatchString(r.Name) {
+		return fmt.Errorf("invalid recipe name %q", r.Name)
+	}
+	if len(r.Plan.Commands) == 0 {
+		return errors.New("recipe plan has no commands")
+	}
+	declared := map[string]bool{}
+	for _, p := range r.Params {
+		if p.Name == "" {
+			return errors.New("parameter with empty name")
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("parameter %q declared twice", p.Name)
+		}
+		declared[p.Name] = true
+		if _, ok := validators[p.Type]; !ok {
+			return fmt.Errorf("parameter %q has unknown type %q", p.Name, p.Type)
+		}
+		if p.Default != "" {
+			if err := ValidateValue(p.Type, p.Default); err != nil {
+				return fmt.Errorf("parameter %q default: %w", p.Name, err)
+			}
+		}
+	}
+	for _, n := range Placeholders(r.Plan) {
+		if !declared[n] {
+			return fmt.Errorf("placeholder {{%s}} is not declared as a parameter", n)
+		}
+	}
+	return nil
+}
+
+// Render substitutes validated parameter values into a copy of the recipe plan.
+func (r Recipe) Render(values map[string]string) (plan.Plan, error) {
+	var zero plan.Plan
+	if err := r.Validate(); err != nil {
+		return zero, err
+	}
+	resolved := make(map[string]string, len(r.Params))
+	for _, p := range r.Params {
+		v, ok := values[p.Name]
+		if !ok {
+			if p.Default == "" {
+				return zero, fmt.Errorf("missing value for parameter %q (%s)", p.Name, p.Type)
+			}
+			v = p.Default
+		}
+		if err := ValidateValue(p.Type, v); err != nil {
+			return zero, fmt.Errorf("parameter %q: %w", p.Name, err)
+		}
+		resolved[p.Name] = v
+	}
+	for k := range values {
+		if _, ok := resolved[k]; !ok {
+			return zero, fmt.Errorf("unknown parameter %q", k)
+		}
+	}
+
+	subst := func(s string) string {
+		return placeholderRE.ReplaceAllStringFunc(s, func(m string) string {
+			return resolved[placeholderRE.FindStringSubmatch(m)[1]]
+		})
+	}
+	out := plan.Plan{SchemaVersion: r.Plan.SchemaVersion, Summary: subst(r.Plan.Summary)}
+	out.Warnings = append(out.Warnings, r.Plan.Warnings...)
+	for _, c := range r.Plan.Commands {
+		nc := c
+		nc.Command = substAll(c.Command, subst)
+		nc.Pipeline = nil
+		for _, st := range c.Pipeline {
+			nc.Pipeline = append(nc.Pipeline, substAll(st, subst))
+		}
+		nc.StdoutFile = subst(c.StdoutFile)
+		nc.Stdin = subst(c.Stdin)
+		if w := c.WriteFile; w != nil {
+			nw := *w
+			nw.Path, nw.Content = subst(w.Path), subst(w.Content)
+			nc.WriteFile = &nw
+		}
+		nc.Description = subst(c.Description)
+		out.Commands = append(out.Commands, nc)
+	}
+	return out, nil
+}
+
+func substAll(argv []string, subst func(string) string) []string {
+	if argv == nil {
+		return nil
+	}
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		out[i] = subst(a)
+	}
+	return out
+}
+
+var validators = map[string]func(string) error{
+	TypeString: func(v string) error { return nil },
+	TypeInt: func(v string) error {
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%q is not an integer", v)
+		}
+		return nil
+	},
+	TypePort: func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q is not a valid port (1-65535)", v)
+		}
+		return nil
+	},
+	TypeIP: func(v string) error {
+		if net.ParseIP(v) == nil {
+			return fmt.Errorf("%q is not a valid IP address", v)
+		}
+		return nil
+	},
+	TypeIPv4: func(v string) error {
+		if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q is not a valid IPv4 address", v)
+		}
+		return nil
+	},
+	TypeIPv6: func(v string) error {
+		if ip := net.ParseIP(v); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%q is not a valid IPv6 address", v)
+		}
+		return nil
+	},
+	TypeMAC: func(v string) error {
+		if hw, err := net.ParseMAC(v); err != nil || len(hw) != 6 {
+			return fmt.Errorf("%q is not a valid MAC address", v)
+		}
+		return nil
+	},
+	TypeIface: func(v string) error {
+		if !ifaceRE.MatchString(v) {
+			return fmt.Errorf("%q is not a valid interface name", v)
+		}
+		return nil
+	},
+}
+
+// ValidateValue checks v against the named parameter type. All values are
+// rejected if they contain NUL or newline characters.
+func ValidateValue(typ, v string) error {
+	check, ok := validators[typ]
+	if !ok {
+		return fmt.Errorf("unknown parameter type %q", typ)
+	}
+	if v == "" {
+		return errors.New("empty value")
+	}
+	if strings.ContainsAny(v, "\x00\r\n") {
+		return errors.New("value contains control characters")
+	}
+	return check(v)
+}
+
+// ParseParam parses a "name:type[:description]" declaration.
+func ParseParam(s string) (Param, error) {
+	parts := strings.SplitN(s, ":", 3)
+	p := Param{Name: strings.TrimSpace(parts[0]), Type: TypeString}
+	if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+		p.Type = strings.TrimSpace(parts[1])
+	}
+	if len(parts) > 2 {
+		p.Description = strings.TrimSpace(parts[2])
+	}
+	if p.Name == "" {
+		return p, fmt.Errorf("invalid parameter declaration %q", s)
+	}
+	if _, ok := validators[p.Type]; !ok {
+		return p, fmt.Errorf("unknown parameter type %q", p.Type)
+	}
+	return p, nil
+}
+
+// ParseValues parses "key=value" arguments into a map.
+func ParseValues(args []string) (map[string]string, error) {
+	values := make(map[string]string, len(args))
+	for _, a := range args {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid argument %q (expected key=value)", a)
+		}
+		values[strings.TrimSpace(k)] = v
+	}
+	return values, nil
+}
+
+// Store persists recipes as JSON files in a directory.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store { return &Store{dir: dir} }
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Save validates and writes a recipe, replacing any recipe with the same name.
+func (s *Store) Save(r Recipe) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(r.Name) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(r.Name))
+}
+
+// Load reads a recipe by name.
+func (s *Store) Load(name string) (Recipe, error) {
+	var r Recipe
+	if !nameRE.MatchString(name) {
+		return r, fmt.Errorf("invalid recipe name %q", name)
+	}
+	b, err := os.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, fmt.Errorf("recipe %q not found", name)
+		}
+		return r, err
+	}
+	var raw struct {
+		Plan json.RawMessage `json:"plan"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return r, fmt.Errorf("parse recipe %q: %w", name, err)
+	}
+	p, err := plan.DecodeStrict(raw.Plan)
+	if err != nil {
+		return r, fmt.Errorf("recipe %q plan: %w", name, err)
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, fmt.Errorf("parse recipe %q: %w", name, err)
+	}
+	r.Plan = p
+	return r, nil
+}
+
+// List returns all readable recipes sorted by name.
+func (s *Store) List() ([]Recipe, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []Recipe
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		r, err := s.Load(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
@@ -0,0 +1,165 @@
+package recipe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func portForward() Recipe {
+	return Recipe{
+		Name: "port-forward",
+		Params: []Param{
+			{Name: "ext_port", Type: TypePort},
+			{Name: "dest_ip", Type: TypeIPv4},
+			{Name: "dest_port", Type: TypePort, Default: "22"},
+		},
+		Plan: plan.Plan{
+			Summary: "Forward {{ext_port}} to {{dest_ip}}",
+			Commands: []plan.PlannedCommand{
+				{Command: []string{"uci", "add", "firewall", "redirect"}},
+				{Command: []string{"uci", "set", "firewall.@redirect[-1].src_dport={{ext_port}}"}},
+				{Command: []string{"uci", "set", "firewall.@redirect[-1].dest_ip={{ dest_ip }}"}},
+				{Command: []string{"uci", "set", "firewall.@redirect[-1].dest_port={{dest_port}}"}},
+				{Command: []string{"uci", "commit", "firewall"}},
+			},
+		},
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	got := strings.Join(Placeholders(portForward().Plan), ",")
+	if got != "dest_ip,dest_port,ext_port" {
+		t.Fatalf("unexpected placeholders: %s", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	p, err := portForward().Render(map[string]string{"ext_port": "2222", "dest_ip": "192.168.1.10"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if p.Summary != "Forward 2222 to 192.168.1.10" {
+		t.Errorf("unexpected summary %q", p.Summary)
+	}
+	want := []string{
+		"firewall.@redirect[-1].src_dport=2222",
+		"firewall.@redirect[-1].dest_ip=192.168.1.10",
+		"firewall.@redirect[-1].dest_port=22",
+	}
+	for i, w := range want {
+		if got := p.Commands[i+1].Command[2]; got != w {
+			t.Errorf("command %d: expected %q, got %q", i+1, w, got)
+		}
+	}
+}
+
+func TestRender_Payloads(t *testing.T) {
+	r := Recipe{
+		Name:   "hosts",
+		Params: []Param{{Name: "ip", Type: TypeIPv4}, {Name: "name", Type: TypeString}},
+		Plan: plan.Plan{Commands: []plan.PlannedCommand{
+			{WriteFile: &plan.WriteFile{Path: "/tmp/lucicodex/{{name}}.hosts", Content: "{{ip}} {{name}}\n"}},
+			{Command: []string{"uci", "batch"}, Stdin: "set dhcp.{{name}}.ip={{ip}}\n", Pipeline: [][]string{{"grep", "{{name}}"}}},
+		}},
+	}
+	p, err := r.Render(map[string]string{"ip": "192.168.1.5", "name": "nas"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if w := p.Commands[0].WriteFile; w.Path != "/tmp/lucicodex/nas.hosts" || w.Content != "192.168.1.5 nas\n" {
+		t.Errorf("unexpected write_file %+v", w)
+	}
+	if r.Plan.Commands[0].WriteFile.Content != "{{ip}} {{name}}\n" {
+		t.Error("Render modified the recipe plan")
+	}
+	if c := p.Commands[1]; c.Stdin != "set dhcp.nas.ip=192.168.1.5\n" || c.Pipeline[0][1] != "nas" {
+		t.Errorf("unexpected command %+v", c)
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		values map[string]string
+	}{
+		{"missing", map[string]string{"ext_port": "2222"}},
+		{"bad port", map[string]string{"ext_port": "70000", "dest_ip": "192.168.1.10"}},
+		{"bad ip", map[string]string{"ext_port": "2222", "dest_ip": "192.168.1"}},
+		{"unknown", map[string]string{"ext_port": "2222", "dest_ip": "192.168.1.10", "extra": "x"}},
+		{"newline", map[string]string{"ext_port": "2222", "dest_ip": "192.168.1.10", "dest_port": "22\n"}},
+	}
+	for _, c := range cases {
+		if _, err := portForward().Render(c.values); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
+
+func TestValidate_UndeclaredPlaceholder(t *testing.T) {
+	r := portForward()
+	r.Params = r.Params[:1]
+	if err := r.Validate(); err == nil {
+		t.Fatal("expected error for undeclared placeholder")
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	cases := []struct {
+		typ, v string
+		ok     bool
+	}{
+		{TypeMAC, "aa:bb:cc:dd:ee:ff", true},
+		{TypeMAC, "aa:bb:cc", false},
+		{TypeIface, "lan", true},
+		{TypeIface, "br-lan; reboot", false},
+		{TypeIPv6, "fd00::1", true},
+		{TypeIPv6, "10.0.0.1", false},
+		{TypeInt, "-3", true},
+		{"bogus", "x", false},
+	}
+	for _, c := range cases {
+		err := ValidateValue(c.typ, c.v)
+		if c.ok != (err == nil) {
+			t.Errorf("ValidateValue(%s, %q) = %v", c.typ, c.v, err)
+		}
+	}
+}
+
+func TestParseParam(t *testing.T) {
+	p, err := ParseParam("lan_ip:ipv4:LAN address")
+	if err != nil {
+		t.Fatalf("ParseParam failed: %v", err)
+	}
+	if p.Name != "lan_ip" || p.Type != TypeIPv4 || p.Description != "LAN address" {
+		t.Errorf("unexpected param %+v", p)
+	}
+	if p, _ := ParseParam("host"); p.Type != TypeString {
+		t.Errorf("expected default type string, got %q", p.Type)
+	}
+	if _, err := ParseParam("x:colour"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if err := s.Save(portForward()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	r, err := s.Load("port-forward")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(r.Params) != 3 || len(r.Plan.Commands) != 5 || r.CreatedAt.IsZero() {
+		t.Errorf("unexpected loaded recipe %+v", r)
+	}
+	list, err := s.List()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List returned %d recipes, err %v", len(list), err)
+	}
+	if _, err := s.Load("../etc/passwd"); err == nil {
+		t.Error("expected error for invalid name")
+	}
+}
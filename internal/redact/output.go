@@ -0,0 +1,49 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aezizhu/LuciCodex/internal/openwrt"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+var (
+	secretOptionRE = regexp.MustCompile(`^` + secretNames + `$`)
+	// showLineRE matches a line of uci show: pkg.section.option='value'
+	showLineRE = regexp.MustCompile(`^[\w@\[\]\-]+\.[\w@\[\]\-]+\.\w+=(.*)$`)
+)
+
+// SecretRead reports whether argv reads a secret option with uci get or
+// show, such as "uci get wireless.default_radio0.key". Its output is the
+// secret, often without any key name a pattern could match.
+func SecretRead(argv []string) bool {
+	c, ok := openwrt.ParseUCICommand(argv)
+	return ok && (c.Sub == "get" || c.Sub == "show") && c.Option != "" && secretOptionRE.MatchString(c.Option)
+}
+
+// RedactOutput redacts the output of a step. When a stage of the step reads
+// a secret option the whole output is replaced, and the values in it are
+// remembered so that later calls to Redact replace them wherever they
+// appear; other output goes through Redact.
+func (r *Redactor) RedactOutput(pc plan.PlannedCommand, out string) string {
+	secret := false
+	for _, st := range pc.Stages() {
+		secret = secret || SecretRead(st)
+	}
+	trimmed := strings.TrimSpace(out)
+	if !secret || trimmed == "" {
+		return r.Redact(out)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range strings.Split(trimmed, "\n") {
+		if m := showLineRE.FindStringSubmatch(line); m != nil {
+			line = m[1]
+		}
+		if v := strings.Trim(strings.TrimSpace(line), `'"`); v != "" {
+			r.placeholder(v)
+		}
+	}
+	return r.placeholder(trimmed) + "\n"
+}
@@ -0,0 +1,240 @@
+// Package redact replaces secrets such as Wi-Fi keys and passwords with
+// placeholders before text leaves the device or reaches the audit log, and
+// restores them locally when a plan needs the real value.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+// secretNames matches UCI option and JSON key names that hold secrets.
+const secretNames = `(?:key[1-4]?|psk|secret|token|apikey|password|passwd|\w+_(?:key|password|secret|token))`
+
+// value matches a quoted or bare option value; the first group that
+// participates is the secret.
+const value = `(?:'([^'\n]*)'|"([^"\n]*)"|([^\s'"\\]+))`
+
+// builtinPatterns find secrets; each match's first participating capture
+// group, or the whole match without groups, is replaced.
+var builtinPatterns = []string{
+	// uci show / uci set / uci batch: wireless.radio0_ap.key='...'
+	`[\w@\[\]\-]+\.[\w@\[\]\-]+\.` + secretNames + `=` + value,
+	// /etc/config files: option key '...'
+	`\boption\s+` + secretNames + `\s+` + value,
+	// ubus and other JSON: "key": "..."
+	`"` + secretNames + `"\s*:\s*"((?:[^"\\]|\\.)*)"`,
+	`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`,
+	// OpenAI/Anthropic and Google API keys
+	`\bsk-[A-Za-z0-9_\-]{20,}`,
+	`\bAIza[0-9A-Za-z_\-]{35}`,
+}
+
+// placeholderRE matches placeholders produced by Redact.
+var placeholderRE = regexp.MustCompile(`__SECRET_([0-9]+)__`)
+
+// minLiteral is the shortest known secret replaced wherever it appears, not
+// only where a pattern matches.
+const minLiteral = 4
+
+// Redactor replaces secrets with numbered placeholders such as __SECRET_1__.
+// The same secret always gets the same placeholder, and a secret seen once
+// is replaced wherever it appears later. It is safe for concurrent use.
+type Redactor struct {
+	patterns []*regexp.Regexp
+
+	mu      sync.Mutex
+	byValue map[string]string
+	values  []string
+}
+
+// New returns a Redactor with the built-in patterns plus cfg.RedactPatterns.
+// Invalid patterns are ignored, like invalid allowlist entries.
+func New(cfg config.Config) *Redactor {
+	r := &Redactor{byValue: map[string]string{}}
+	for _, p := range append(append([]string{}, builtinPatterns...), cfg.RedactPatterns...) {
+		if re, err := regexp.Compile(p); err == nil {
+			r.patterns = append(r.patterns, re)
+		}
+	}
+	return r
+}
+
+// Redact returns s with every secret replaced by its placeholder.
+func (r *Redactor) Redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, re := range r.patterns {
+		s = r.replace(re, s)
+	}
+	for _, v := range r.values {
+		if len(v) >= minLiteral {
+			s = strings.ReplaceAll(s, v, r.byValue[v])
+		}
+	}
+	return s
+}
+
+// RedactJSON redacts a JSON document as text, so that secrets are found by
+// their key names, and returns it if it is still valid JSON. Otherwise, e.g.
+// when a known secret also appeared as a number, only the string values of
+// the document are redacted.
+func (r *Redactor) RedactJSON(b []byte) []byte {
+	if out := []byte(r.Redact(string(b))); json.Valid(out) {
+		return out
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return b
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+func (r *Redactor) redactValue(v any) any {
+	switch t := v.(type) {
+	case string:
+		return r.Redact(t)
+	case []any:
+		for i := range t {
+			t[i] = r.redactValue(t[i])
+		}
+	case map[string]any:
+		for k, x := range t {
+			t[k] = r.redactValue(x)
+		}
+	}
+	return v
+}
+
+// IsPlaceholder reports whether s is exactly one placeholder.
+func IsPlaceholder(s string) bool {
+	m := placeholderRE.FindStringIndex(s)
+	return m != nil && m[0] == 0 && m[1] == len(s)
+}
+
+// replace substitutes the secret part of each match of re in s.
+func (r *Redactor) replace(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		for g := 2; g+1 < len(m); g += 2 {
+			if m[g] >= 0 {
+				start, end = m[g], m[g+1]
+				break
+			}
+		}
+		v := s[start:end]
+		if v == "" || placeholderRE.MatchString(v) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.placeholder(v))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// placeholder returns the placeholder for v, allocating one if needed.
+// The caller holds r.mu.
+func (r *Redactor) placeholder(v string) string {
+	if p, ok := r.byValue[v]; ok {
+		return p
+	}
+	p := fmt.Sprintf("__SECRET_%d__", len(r.byValue)+1)
+	r.byValue[v] = p
+	r.values = append(r.values, v)
+	// Replace longer secrets first so one never clobbers part of another.
+	sort.SliceStable(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	return p
+}
+
+// Restore replaces placeholders in s with their secrets. It fails on a
+// placeholder this Redactor did not produce.
+func (r *Redactor) Restore(s string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byName := make(map[string]string, len(r.byValue))
+	for v, p := range r.byValue {
+		byName[p] = v
+	}
+	var err error
+	s = placeholderRE.ReplaceAllStringFunc(s, func(p string) string {
+		v, ok := byName[p]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown secret placeholder %s", p)
+			}
+			return p
+		}
+		return v
+	})
+	return s, err
+}
+
+// RestorePlan substitutes secrets back into the executable parts of p:
+// argv, pipeline stages, stdin and write_file content. Descriptions,
+// summary and warnings keep their placeholders.
+func (r *Redactor) RestorePlan(p plan.Plan) (plan.Plan, error) {
+	out := p
+	out.Commands = make([]plan.PlannedCommand, len(p.Commands))
+	for i, c := range p.Commands {
+		var err error
+		restore := func(s string) string {
+			if err != nil {
+				return s
+			}
+			s, err = r.Restore(s)
+			return s
+		}
+		c.Command = restoreAll(c.Command, restore)
+		if c.Pipeline != nil {
+			stages := make([][]string, len(c.Pipeline))
+			for s, st := range c.Pipeline {
+				stages[s] = restoreAll(st, restore)
+			}
+			c.Pipeline = stages
+		}
+		c.Stdin = restore(c.Stdin)
+		if c.WriteFile != nil {
+			w := *c.WriteFile
+			w.Content = restore(w.Content)
+			c.WriteFile = &w
+		}
+		if err != nil {
+			return p, fmt.Errorf("command %d: %w", i, err)
+		}
+		out.Commands[i] = c
+	}
+	return out, nil
+}
+
+func restoreAll(in []string, f func(string) string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	for i, s := range in {
+		out[i] = f(s)
+	}
+	return out
+}
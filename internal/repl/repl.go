@@ -9,12 +9,15 @@ import (
     "strings"
     "time"
 
+    "github.com/aezizhu/LuciCodex/internal/answer"
+    "github.com/aezizhu/LuciCodex/internal/backup"
     "github.com/aezizhu/LuciCodex/internal/config"
     "github.com/aezizhu/LuciCodex/internal/executor"
     "github.com/aezizhu/LuciCodex/internal/llm"
     "github.com/aezizhu/LuciCodex/internal/logging"
     "github.com/aezizhu/LuciCodex/internal/openwrt"
     "github.com/aezizhu/LuciCodex/internal/plan"
+    "github.com/aezizhu/LuciCodex/internal/plan/lint"
     "github.com/aezizhu/LuciCodex/internal/policy"
     "github.com/aezizhu/LuciCodex/internal/ui"
 )
@@ -25,20 +28,31 @@ type REPL struct {
     policyEngine *policy.Engine
     execEngine   *executor.Engine
     logger       *logging.Logger
+    facts        *openwrt.FactsCache
     history      []string
     maxHistory   int
 }
 
 func New(cfg config.Config) *REPL {
-    return &REPL{
+    r := &REPL{
         cfg:          cfg,
-        provider:     llm.NewProvider(cfg),
         policyEngine: policy.New(cfg),
         execEngine:   executor.New(cfg),
         logger:       logging.New(cfg.LogFile),
+        facts:        openwrt.OpenFactsCache(cfg.FactsCacheFile),
         history:      make([]string, 0),
         maxHistory:   100,
     }
+    r.setProvider(llm.NewProvider(cfg))
+    return r
+}
+
+// setProvider switches to p and shares its redactor with the audit log.
+func (r *REPL) setProvider(p llm.Provider) {
+    r.provider = p
+    if red := llm.Redactor(p); red != nil {
+        r.logger.SetRedactor(red)
+    }
 }
 
 func (r *REPL) Run(ctx context.Context, input io.Reader, output io.Writer) error {
@@ -102,12 +116,17 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
     
     // Build instruction with facts
     instruction := plan.BuildInstructionWithLimit(r.cfg.MaxCommands)
+    var facts string
     if true { // facts enabled by default in REPL
         factsCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
         defer cancel()
-        facts := openwrt.CollectFacts(factsCtx)
+        snap := openwrt.CollectFactsSnapshot(factsCtx, openwrt.FactsOptions{Prompt: prompt, TokenBudget: r.cfg.FactsTokenBudget, Cache: r.facts})
+        if err := r.facts.Save(); err != nil {
+            fmt.Fprintf(output, "Warning: facts cache: %v\n", err)
+        }
+        facts = snap.String()
         if facts != "" {
-            instruction += "\n\nEnvironment facts (read-only):\n" + facts
+            instruction += "\n\n" + plan.FenceUntrusted("Environment facts (read-only)", facts)
         }
     }
     
@@ -121,6 +140,7 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
     if err != nil {
         return fmt.Errorf("LLM error: %w", err)
     }
+    p.MarkUntrusted("environment facts", facts)
     
     if len(p.Commands) == 0 {
         fmt.Fprintln(output, "No commands proposed.")
@@ -135,6 +155,17 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
     if err := r.policyEngine.ValidatePlan(p); err != nil {
         return fmt.Errorf("Plan rejected: %w", err)
     }
+    r.policyEngine.AnnotateUCI(&p)
+
+    // Preview resulting UCI changes
+    previewCtx, cancelPreview := context.WithTimeout(ctx, 5*time.Second)
+    p.ConfigDiffs, _ = openwrt.PreviewUCI(previewCtx, p, openwrt.PreviewOptions{})
+    cancelPreview()
+
+    // Flag common OpenWrt mistakes as warnings
+    lintCtx, cancelLint := context.WithTimeout(ctx, 3*time.Second)
+    lint.Annotate(&p, lint.Options{Sections: openwrt.UCISectionLookup(lintCtx), AutoReload: r.cfg.AutoReload})
+    cancelLint()
     
     // Show plan
     ui.PrintPlan(output, p)
@@ -146,7 +177,10 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
     }
     
     // Confirm execution
-    if !r.cfg.AutoApprove {
+    if policy.RequiresConfirmation(p, r.cfg.AutoApprove) {
+        if r.cfg.AutoApprove {
+            fmt.Fprintln(output, "Auto-approve ignored: the plan was generated from untrusted device data")
+        }
         reader := bufio.NewReader(os.Stdin)
         ok, err := ui.Confirm(reader, output, "Execute these commands?")
         if err != nil || !ok {
@@ -155,9 +189,28 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
         }
     }
     
+    watchdog := r.execEngine.NewWatchdog(ctx, p)
+    var rollback executor.Rollback
+    if (r.cfg.Backup || watchdog != nil) && !r.policyEngine.ReadOnlyPlan(p) {
+        store := backup.NewStore(r.cfg.BackupDir, r.cfg.BackupKeep)
+        b, err := store.Create(prompt)
+        if err != nil {
+            return fmt.Errorf("backup: %w", err)
+        }
+        fmt.Fprintf(output, "Saved backup %s (%d files)\n", b.ID, len(b.Files))
+        rollback = r.execEngine.BackupRollback(store, b.ID, p)
+    }
+
     // Execute
     results := r.execEngine.RunPlan(ctx, p)
+    if watchdog != nil {
+        results.Watchdog = watchdog.Verify(ctx, rollback)
+    }
     ui.PrintResults(output, results)
+    r.facts.Invalidate()
+    if err := r.facts.Save(); err != nil {
+        fmt.Fprintf(output, "Warning: facts cache: %v\n", err)
+    }
     
     // Audit results
     items := make([]logging.ResultItem, 0, len(results.Items))
@@ -169,12 +222,31 @@ func (r *REPL) executePrompt(ctx context.Context, prompt string, output io.Write
         items = append(items, logging.ResultItem{
             Index:   it.Index,
             Command: it.Command,
+            Pipeline:   it.Step.Pipeline,
+            StdoutFile: it.Step.StdoutFile,
+            WriteFile:  it.Step.WritePath(),
             Output:  it.Output,
+            ExitCode: it.ExitCode,
+            Signal:  it.Signal,
+            TimedOut: it.TimedOut,
             Error:   errStr,
             Elapsed: it.Elapsed,
         })
     }
     r.logger.Results(items)
+
+    // Optional second pass: answer the question from the outputs
+    if r.cfg.AnswerMode && len(results.Items) > 0 {
+        answerCtx, cancelAnswer := context.WithTimeout(ctx, 60*time.Second)
+        a, err := answer.Summarize(answerCtx, r.provider, prompt, results)
+        cancelAnswer()
+        if err != nil {
+            fmt.Fprintf(output, "Answer error: %v\n", err)
+        } else {
+            r.logger.Answer(prompt, a)
+            ui.PrintAnswer(output, a)
+        }
+    }
     
     return nil
 }
@@ -218,6 +290,7 @@ func (r *REPL) showStatus(output io.Writer) {
     fmt.Fprintf(output, "Model: %s\n", r.cfg.Model)
     fmt.Fprintf(output, "Dry run: %t\n", r.cfg.DryRun)
     fmt.Fprintf(output, "Auto approve: %t\n", r.cfg.AutoApprove)
+    fmt.Fprintf(output, "Answer mode: %t\n", r.cfg.AnswerMode)
     fmt.Fprintf(output, "Max commands: %d\n", r.cfg.MaxCommands)
     fmt.Fprintf(output, "Timeout: %ds\n", r.cfg.TimeoutSeconds)
 }
@@ -234,16 +307,19 @@ func (r *REPL) handleSet(setting string, output io.Writer) error {
     case "dry-run":
         r.cfg.DryRun = value == "true"
         fmt.Fprintf(output, "Set dry-run to %t\n", r.cfg.DryRun)
+    case "answer":
+        r.cfg.AnswerMode = value == "true"
+        fmt.Fprintf(output, "Set answer to %t\n", r.cfg.AnswerMode)
     case "auto-approve":
         r.cfg.AutoApprove = value == "true"
         fmt.Fprintf(output, "Set auto-approve to %t\n", r.cfg.AutoApprove)
     case "provider":
         r.cfg.Provider = value
-        r.provider = llm.NewProvider(r.cfg)
+        r.setProvider(llm.NewProvider(r.cfg))
         fmt.Fprintf(output, "Set provider to %s\n", r.cfg.Provider)
     case "model":
         r.cfg.Model = value
-        r.provider = llm.NewProvider(r.cfg)
+        r.setProvider(llm.NewProvider(r.cfg))
         fmt.Fprintf(output, "Set model to %s\n", r.cfg.Model)
     default:
         return fmt.Errorf("unknown setting: %s", key)
@@ -0,0 +1,109 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+)
+
+// IsolateArg is the hidden first argument that makes the lucicodex binary act
+// as the isolation helper (see IsolateMain).
+const IsolateArg = "__isolate"
+
+// Seccomp profiles for isolate_seccomp_profile. The allowlist permits only
+// the calls read-only diagnostics need and fails the rest with ENOSYS; the
+// denylist fails a fixed set of dangerous calls with EPERM.
+const (
+	SeccompAllowlist = "allowlist"
+	SeccompDenylist  = "denylist"
+)
+
+// validSeccompProfile reports whether p names a seccomp profile; empty means
+// no filter.
+func validSeccompProfile(p string) bool {
+	return p == "" || p == SeccompAllowlist || p == SeccompDenylist
+}
+
+// Isolation is the sandbox profile for read-only commands: a private mount
+// namespace with read-only /etc and a private /tmp, dropped credentials,
+// no_new_privs and optionally a seccomp filter. Commands are started through
+// the lucicodex binary itself, which sets this up and then execs the command.
+type Isolation struct {
+	exe     string
+	uid     int
+	gid     int
+	seccomp string
+	keep    []string
+}
+
+// NewIsolation returns the isolation profile configured in cfg. It returns
+// nil without error when lucicodex does not run as root: there are no
+// privileges to drop and no namespaces can be created.
+func NewIsolation(cfg config.Config) (*Isolation, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+	if err := isolationSupported(cfg.IsolateSeccomp); err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("locate lucicodex binary: %w", err)
+	}
+	if cfg.IsolateUID <= 0 || cfg.IsolateGID <= 0 {
+		return nil, errors.New("isolate_uid and isolate_gid must be unprivileged ids")
+	}
+	seccomp := ""
+	if cfg.IsolateSeccomp {
+		seccomp = cfg.IsolateSeccompProfile
+		if seccomp == "" {
+			seccomp = SeccompAllowlist
+		}
+		if !validSeccompProfile(seccomp) {
+			return nil, fmt.Errorf("unknown isolate_seccomp_profile %q", seccomp)
+		}
+	}
+	return &Isolation{
+		exe:     exe,
+		uid:     cfg.IsolateUID,
+		gid:     cfg.IsolateGID,
+		seccomp: seccomp,
+		keep:    cfg.IsolateKeepPaths,
+	}, nil
+}
+
+// Apply rewrites cmd to start through the isolation helper in a new mount
+// namespace. It must be called after all other changes to cmd.Path and
+// cmd.Args, except Sandbox.Apply.
+func (i *Isolation) Apply(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		// Let Start report the lookup failure.
+		return nil
+	}
+	flags := []string{"-uid", strconv.Itoa(i.uid), "-gid", strconv.Itoa(i.gid)}
+	if i.seccomp != "" {
+		flags = append(flags, "-seccomp", i.seccomp)
+	}
+	for _, k := range i.keep {
+		flags = append(flags, "-keep", k)
+	}
+	wrapHelper(cmd, i.exe, flags)
+	return newMountNamespace(cmd)
+}
+
+// wrapHelper rewrites cmd to start through the helper binary exe with flags.
+// A cmd that already starts through the helper, e.g. for sandbox limits,
+// gets the flags added to that invocation instead of a second helper.
+func wrapHelper(cmd *exec.Cmd, exe string, flags []string) {
+	args := append([]string{exe, IsolateArg}, flags...)
+	if cmd.Path == exe && len(cmd.Args) > 1 && cmd.Args[1] == IsolateArg {
+		cmd.Args = append(args, cmd.Args[2:]...)
+		return
+	}
+	args = append(args, "--", cmd.Path)
+	cmd.Path, cmd.Args = exe, append(args, cmd.Args...)
+}
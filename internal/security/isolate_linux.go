@@ -0,0 +1,175 @@
+package security
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+const prSetNoNewPrivs = 38
+
+// auditArch is the AUDIT_ARCH_* value seccomp reports for each GOARCH.
+var auditArch = map[string]uint32{
+	"386":      0x40000003,
+	"amd64":    0xc000003e,
+	"arm":      0x40000028,
+	"arm64":    0xc00000b7,
+	"mips":     0x00000008,
+	"mipsle":   0x40000008,
+	"mips64":   0x80000008,
+	"mips64le": 0xc0000008,
+	"ppc64le":  0xc0000015,
+	"riscv64":  0xc00000f3,
+}
+
+func isolationSupported(seccomp bool) error {
+	if _, ok := auditArch[runtime.GOARCH]; seccomp && !ok {
+		return fmt.Errorf("seccomp filter not supported on %s", runtime.GOARCH)
+	}
+	return nil
+}
+
+func newMountNamespace(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	return nil
+}
+
+type keepList []string
+
+func (k *keepList) String() string     { return strings.Join(*k, ",") }
+func (k *keepList) Set(v string) error { *k = append(*k, v); return nil }
+
+// IsolateMain runs the helper: args are the helper flags, "--", the program
+// path and its argv. With -uid and -gid it isolates the command; the -as,
+// -fsize, -nproc and -nofile resource limits are set right before exec, so
+// the command and all its children start limited. It only returns on
+// failure, with the exit code to use.
+func IsolateMain(args []string) int {
+	fs := flag.NewFlagSet(IsolateArg, flag.ContinueOnError)
+	uid := fs.Int("uid", -1, "")
+	gid := fs.Int("gid", -1, "")
+	seccomp := fs.String("seccomp", "", "")
+	var keep keepList
+	fs.Var(&keep, "keep", "")
+	var limits rlimitValues
+	fs.Uint64Var(&limits.as, "as", 0, "")
+	fs.Uint64Var(&limits.fsize, "fsize", 0, "")
+	fs.Uint64Var(&limits.nproc, "nproc", 0, "")
+	fs.Uint64Var(&limits.nofile, "nofile", 0, "")
+	err := fs.Parse(args)
+	isolating := *uid != -1 || *gid != -1
+	if err != nil || fs.NArg() < 2 || isolating && (*uid <= 0 || *gid <= 0) || !validSeccompProfile(*seccomp) {
+		fmt.Fprintln(os.Stderr, "isolate: invalid arguments")
+		return 126
+	}
+	path, argv := fs.Arg(0), fs.Args()[1:]
+
+	// no_new_privs and seccomp apply to the calling thread, which must be
+	// the one that execs.
+	runtime.LockOSThread()
+	if isolating {
+		if err := isolate(*uid, *gid, *seccomp, keep); err != nil {
+			fmt.Fprintf(os.Stderr, "isolate: %v\n", err)
+			return 126
+		}
+	}
+	if err := setOwnRlimits(limits); err != nil {
+		fmt.Fprintf(os.Stderr, "isolate: resource limits: %v\n", err)
+		return 126
+	}
+	err = syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "isolate: exec %s: %v\n", path, err)
+	return 127
+}
+
+// isolate drops into the profile; seccomp names the seccomp profile, empty
+// for none.
+func isolate(uid, gid int, seccomp string, keep []string) error {
+	// Keep our mounts out of the parent namespace.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := bindReadOnly("/etc", "/etc"); err != nil {
+		return err
+	}
+	if err := privateTmp(keep); err != nil {
+		return err
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("no_new_privs: %w", errno)
+	}
+	if seccomp != "" {
+		if err := installSeccomp(seccomp); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+	return nil
+}
+
+func bindReadOnly(src, dst string) error {
+	if err := syscall.Mount(src, dst, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", dst, err)
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := syscall.Mount("", dst, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %w", dst, err)
+	}
+	return nil
+}
+
+// privateTmp mounts an empty tmpfs on /tmp and binds the keep paths of the
+// original /tmp (sockets, leases) back read-only.
+func privateTmp(keep []string) error {
+	old, err := os.Open("/tmp")
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=8m,mode=1777"); err != nil {
+		return fmt.Errorf("mount private /tmp: %w", err)
+	}
+	for _, k := range keep {
+		rel, err := filepath.Rel("/tmp", filepath.Clean(k))
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		src := fmt.Sprintf("/proc/self/fd/%d/%s", old.Fd(), rel)
+		fi, err := os.Stat(src)
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join("/tmp", rel)
+		if fi.IsDir() {
+			err = os.MkdirAll(dst, 0o755)
+		} else if err = os.MkdirAll(filepath.Dir(dst), 0o755); err == nil {
+			var f *os.File
+			if f, err = os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0o644); err == nil {
+				err = f.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("keep %s: %w", k, err)
+		}
+		if err := bindReadOnly(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package security
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+var errIsolationUnsupported = errors.New("isolation requires Linux namespaces")
+
+func isolationSupported(seccomp bool) error { return errIsolationUnsupported }
+
+func newMountNamespace(cmd *exec.Cmd) error { return errIsolationUnsupported }
+
+// IsolateMain reports that isolation is unavailable on this platform.
+func IsolateMain(args []string) int {
+	fmt.Fprintf(os.Stderr, "isolate: %v\n", errIsolationUnsupported)
+	return 126
+}
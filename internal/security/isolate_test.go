@@ -0,0 +1,113 @@
+package security
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+)
+
+// TestMain lets the test binary act as the isolation helper, like main does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == IsolateArg {
+		os.Exit(IsolateMain(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func TestIsolation(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("isolation needs root on Linux")
+	}
+	keepDir, err := os.MkdirTemp("/tmp", "lucicodex-keep-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keepDir)
+	if err := os.Chmod(keepDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keepDir, "leases"), []byte("kept\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hidden, err := os.CreateTemp("/tmp", "lucicodex-hidden-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden.Close()
+	defer os.Remove(hidden.Name())
+
+	iso, err := NewIsolation(config.Config{IsolateUID: 65534, IsolateGID: 65534, IsolateSeccomp: true, IsolateKeepPaths: []string{keepDir}})
+	if err != nil {
+		t.Fatalf("NewIsolation failed: %v", err)
+	}
+	script := `id -u; id -g; grep -E '^(NoNewPrivs|Seccomp):' /proc/self/status; ` +
+		`touch /etc/.lucicodex-isolate-test 2>&1; ls /tmp; cat ` + filepath.Join(keepDir, "leases")
+	cmd := exec.CommandContext(context.Background(), "sh", "-c", script)
+	if err := iso.Apply(cmd); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	b, err := cmd.CombinedOutput()
+	out := string(b)
+	if strings.Contains(out, "operation not permitted") {
+		t.Skipf("namespaces unavailable here: %s", out)
+	}
+	if err != nil {
+		t.Fatalf("isolated command failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"65534\n65534\n", "NoNewPrivs:\t1", "Seccomp:\t2", "Read-only file system", filepath.Base(keepDir) + "\n", "kept"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, filepath.Base(hidden.Name())) {
+		t.Errorf("host /tmp is visible:\n%s", out)
+	}
+	if _, err := os.Stat("/etc/.lucicodex-isolate-test"); err == nil {
+		os.Remove("/etc/.lucicodex-isolate-test")
+		t.Error("isolated command wrote to /etc")
+	}
+}
+
+func TestIsolation_SeccompProfiles(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("isolation needs root on Linux")
+	}
+	// mknod is on neither list: the allowlist fails it, the denylist not.
+	for profile, want := range map[string]string{SeccompAllowlist: "Function not implemented", SeccompDenylist: "created"} {
+		iso, err := NewIsolation(config.Config{IsolateUID: 65534, IsolateGID: 65534, IsolateSeccomp: true, IsolateSeccompProfile: profile})
+		if err != nil {
+			t.Fatalf("NewIsolation(%s) failed: %v", profile, err)
+		}
+		cmd := exec.CommandContext(context.Background(), "sh", "-c", "mkfifo /tmp/fifo 2>&1 && echo created")
+		if err := iso.Apply(cmd); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		b, _ := cmd.CombinedOutput()
+		out := string(b)
+		if strings.Contains(out, "operation not permitted") {
+			t.Skipf("namespaces unavailable here: %s", out)
+		}
+		if !strings.Contains(out, want) {
+			t.Errorf("%s: expected output to contain %q:\n%s", profile, want, out)
+		}
+	}
+	if _, err := NewIsolation(config.Config{IsolateUID: 65534, IsolateGID: 65534, IsolateSeccomp: true, IsolateSeccompProfile: "strict"}); err == nil {
+		t.Error("expected an error for an unknown seccomp profile")
+	}
+}
+
+func TestIsolateMain_InvalidArgs(t *testing.T) {
+	if code := IsolateMain([]string{"-uid", "0", "--", "/bin/true", "true"}); code != 126 {
+		t.Errorf("expected exit code 126 for root uid, got %d", code)
+	}
+	if code := IsolateMain([]string{"-uid", "65534", "-gid", "65534", "-seccomp", "strict", "--", "/bin/true", "true"}); code != 126 {
+		t.Errorf("expected exit code 126 for an unknown seccomp profile, got %d", code)
+	}
+}
@@ -0,0 +1,63 @@
+package security
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// rlimitNPROC is not exported by package syscall; MIPS numbers resources
+// differently from the generic Linux ABI.
+func rlimitNPROC() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 8
+	}
+	return 6
+}
+
+// limitFlags returns the helper flags that make IsolateMain apply l before
+// it execs the command.
+func limitFlags(l ResourceLimits) []string {
+	var flags []string
+	add := func(name string, v uint64) {
+		if v > 0 {
+			flags = append(flags, "-"+name, strconv.FormatUint(v, 10))
+		}
+	}
+	add("as", uint64(l.MaxMemoryMB)<<20)
+	add("fsize", uint64(l.MaxFileSize))
+	add("nproc", uint64(l.MaxProcesses))
+	add("nofile", uint64(l.MaxOpenFiles))
+	return flags
+}
+
+// rlimitValues are the limits parsed from the helper flags, in bytes or
+// counts; zero leaves a limit unchanged.
+type rlimitValues struct {
+	as, fsize, nproc, nofile uint64
+}
+
+// setOwnRlimits applies v to the calling process; the command it execs
+// inherits them, and so does everything the command forks.
+func setOwnRlimits(v rlimitValues) error {
+	for _, l := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_AS, v.as},
+		{syscall.RLIMIT_FSIZE, v.fsize},
+		{rlimitNPROC(), v.nproc},
+		// syscall.Setrlimit also stops Exec from restoring the soft
+		// RLIMIT_NOFILE the Go runtime raised at startup.
+		{syscall.RLIMIT_NOFILE, v.nofile},
+	} {
+		if l.value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
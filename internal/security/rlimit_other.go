@@ -0,0 +1,9 @@
+//go:build !linux
+
+package security
+
+// limitFlags returns no flags where the helper is unavailable; only
+// sampling and process-group kill apply.
+func limitFlags(l ResourceLimits) []string {
+	return nil
+}
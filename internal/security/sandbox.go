@@ -6,6 +6,9 @@ import (
     "os"
     "os/exec"
     "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
     "syscall"
     "time"
 
@@ -13,13 +16,26 @@ import (
     "github.com/aezizhu/LuciCodex/internal/plan"
 )
 
-// ResourceLimits defines execution constraints
+// ResourceLimits defines execution constraints. Zero values mean unlimited.
 type ResourceLimits struct {
-    MaxMemoryMB     int           // Maximum memory in MB
-    MaxCPUPercent   int           // Maximum CPU percentage
+    MaxMemoryMB     int           // Maximum memory in MB (RLIMIT_AS and sampled RSS)
+    MaxCPUPercent   int           // Maximum sustained CPU percentage
     MaxExecutionTime time.Duration // Maximum execution time
-    MaxFileSize     int64         // Maximum file size in bytes
-    MaxProcesses    int           // Maximum number of processes
+    MaxFileSize     int64         // Maximum file size in bytes (RLIMIT_FSIZE)
+    MaxProcesses    int           // Maximum number of processes (RLIMIT_NPROC, per user)
+    MaxOpenFiles    int           // Maximum open file descriptors (RLIMIT_NOFILE)
+}
+
+// LimitsFromConfig returns the resource limits configured in cfg.
+func LimitsFromConfig(cfg config.Config) ResourceLimits {
+    return ResourceLimits{
+        MaxMemoryMB:     cfg.SandboxMemoryMB,
+        MaxCPUPercent:   cfg.SandboxCPUPercent,
+        MaxExecutionTime: time.Duration(cfg.TimeoutSeconds) * time.Second,
+        MaxFileSize:     int64(cfg.SandboxFileSizeMB) * 1024 * 1024,
+        MaxProcesses:    cfg.SandboxMaxProcs,
+        MaxOpenFiles:    cfg.SandboxMaxFiles,
+    }
 }
 
 // Sandbox provides isolated command execution
@@ -27,63 +43,95 @@ type Sandbox struct {
     cfg    config.Config
     limits ResourceLimits
     tmpDir string
+    // exe is the lucicodex binary, which applies the rlimits as the helper
+    exe    string
+    exeErr error
 }
 
 func NewSandbox(cfg config.Config) *Sandbox {
+    exe, err := os.Executable()
     return &Sandbox{
-        cfg: cfg,
-        limits: ResourceLimits{
-            MaxMemoryMB:     128,
-            MaxCPUPercent:   50,
-            MaxExecutionTime: time.Duration(cfg.TimeoutSeconds) * time.Second,
-            MaxFileSize:     10 * 1024 * 1024, // 10MB
-            MaxProcesses:    10,
-        },
-        tmpDir: "/tmp/lucicodex-sandbox",
+        cfg:    cfg,
+        limits: LimitsFromConfig(cfg),
+        tmpDir: sandboxDir(cfg),
+        exe:    exe,
+        exeErr: err,
+    }
+}
+
+// sandboxDir is the working, home and temporary directory of sandboxed
+// commands.
+func sandboxDir(cfg config.Config) string {
+    if cfg.SandboxDir != "" {
+        return cfg.SandboxDir
     }
+    return "/tmp/lucicodex-sandbox"
 }
 
 func (s *Sandbox) SetLimits(limits ResourceLimits) {
     s.limits = limits
 }
 
+// Limits returns the limits enforced by monitors of this sandbox.
+func (s *Sandbox) Limits() ResourceLimits {
+    return s.limits
+}
+
+// ExecuteCommand prepares pc for sandboxed execution. The caller's context
+// bounds the run; start the command with NewMonitor to enforce the limits.
 func (s *Sandbox) ExecuteCommand(ctx context.Context, pc plan.PlannedCommand) (*exec.Cmd, error) {
     if len(pc.Command) == 0 {
         return nil, fmt.Errorf("empty command")
     }
+    cmd := exec.CommandContext(ctx, pc.Command[0], pc.Command[1:]...)
+    if err := s.Apply(cmd); err != nil {
+        return nil, err
+    }
+    cmd.Cancel = func() error {
+        return killGroup(cmd)
+    }
+    return cmd, nil
+}
 
+// Apply configures cmd to run in its own process group with a restricted
+// environment whose HOME and TMPDIR are the sandbox directory
+// (cfg.SandboxDir). The directory is also the working directory unless
+// cmd.Dir is already set. Cancellation is left to the caller; a Monitor kills
+// the whole group when a limit is exceeded. The rlimits are set by the lucicodex helper (see
+// IsolateMain) between fork and exec, so nothing the command forks escapes
+// them; Isolation.Apply may be called afterwards.
+func (s *Sandbox) Apply(cmd *exec.Cmd) error {
     // Create isolated environment
     if err := s.setupEnvironment(); err != nil {
-        return nil, fmt.Errorf("setup environment: %w", err)
+        return fmt.Errorf("setup environment: %w", err)
     }
-
-    // Apply timeout from context or limits
-    timeout := s.limits.MaxExecutionTime
-    if timeout <= 0 {
-        timeout = 30 * time.Second
-    }
-    
-    cmdCtx, cancel := context.WithTimeout(ctx, timeout)
-    defer cancel()
-
-    // Prepare command with resource limits
-    cmd := exec.CommandContext(cmdCtx, pc.Command[0], pc.Command[1:]...)
-    
-    // Set restricted environment
     cmd.Env = s.getRestrictedEnv()
-    
-    // Set working directory to sandbox
-    cmd.Dir = s.tmpDir
-    
-    // Apply process limits using SysProcAttr
-    cmd.SysProcAttr = &syscall.SysProcAttr{
-        // Create new process group for better isolation
-        Setpgid: true,
-        // Additional security attributes would go here
-        // Note: Full sandboxing requires more complex setup
+    if cmd.Dir == "" {
+        cmd.Dir = s.tmpDir
+    }
+    if cmd.SysProcAttr == nil {
+        cmd.SysProcAttr = &syscall.SysProcAttr{}
     }
+    cmd.SysProcAttr.Setpgid = true
+    if flags := limitFlags(s.limits); len(flags) > 0 && cmd.Err == nil {
+        if s.exeErr != nil {
+            return fmt.Errorf("locate lucicodex binary: %w", s.exeErr)
+        }
+        wrapHelper(cmd, s.exe, flags)
+    }
+    return nil
+}
 
-    return cmd, nil
+// killGroup sends SIGKILL to the process group of cmd, or to the process
+// itself when it does not lead its own group.
+func killGroup(cmd *exec.Cmd) error {
+    if cmd.Process == nil {
+        return nil
+    }
+    if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+        return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+    }
+    return cmd.Process.Kill()
 }
 
 func (s *Sandbox) setupEnvironment() error {
@@ -124,9 +172,13 @@ func (s *Sandbox) cleanup() error {
 }
 
 func (s *Sandbox) getRestrictedEnv() []string {
+    path := os.Getenv("PATH")
+    if path == "" {
+        path = "/usr/sbin:/usr/bin:/sbin:/bin"
+    }
     // Minimal environment
     return []string{
-        "PATH=/usr/sbin:/usr/bin:/sbin:/bin",
+        "PATH=" + path,
         "HOME=" + s.tmpDir,
         "TMPDIR=" + s.tmpDir,
         "USER=nobody",
@@ -188,6 +240,10 @@ type Monitor struct {
     cmd       *exec.Cmd
     limits    ResourceLimits
     startTime time.Time
+    done      chan struct{}
+
+    mu        sync.Mutex
+    violation string
 }
 
 func NewMonitor(cmd *exec.Cmd, limits ResourceLimits) *Monitor {
@@ -195,40 +251,167 @@ func NewMonitor(cmd *exec.Cmd, limits ResourceLimits) *Monitor {
         cmd:       cmd,
         limits:    limits,
         startTime: time.Now(),
+        done:      make(chan struct{}),
     }
 }
 
+// Start starts the command and begins sampling its memory, CPU and run
+// time. The rlimits themselves are set before exec by a command prepared
+// with Sandbox.Apply; sampling is a backstop, e.g. for RSS below the
+// address-space limit.
 func (m *Monitor) Start(ctx context.Context) error {
-    // Start monitoring in background
+    if err := m.cmd.Start(); err != nil {
+        return err
+    }
+    m.startTime = time.Now()
     go m.monitorResources(ctx)
-    return m.cmd.Start()
+    return nil
 }
 
+// Wait waits for the command and reports a sampled limit violation as the
+// error, wrapping the process error.
 func (m *Monitor) Wait() error {
-    return m.cmd.Wait()
+    err := m.cmd.Wait()
+    close(m.done)
+    if v := m.Violation(); v != "" {
+        if err == nil {
+            return fmt.Errorf("%s limit exceeded", v)
+        }
+        return fmt.Errorf("%s limit exceeded: %w", v, err)
+    }
+    return err
 }
 
+// Violation returns the limit that caused the monitor to kill the command,
+// or "".
+func (m *Monitor) Violation() string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.violation
+}
+
+func (m *Monitor) stop(violation string) {
+    m.mu.Lock()
+    if m.violation == "" {
+        m.violation = violation
+    }
+    m.mu.Unlock()
+    _ = killGroup(m.cmd)
+}
+
+// cpuWindow is the period over which CPU usage is averaged; usage must stay
+// above the limit for cpuStrikes consecutive windows before the command is
+// killed, so short bursts are tolerated.
+const (
+    cpuWindow  = time.Second
+    cpuStrikes = 3
+)
+
 func (m *Monitor) monitorResources(ctx context.Context) {
     ticker := time.NewTicker(100 * time.Millisecond)
     defer ticker.Stop()
 
+    pid := m.cmd.Process.Pid
+    var (
+        windowStart = time.Now()
+        windowTicks int64 = -1
+        strikes     int
+    )
     for {
         select {
         case <-ctx.Done():
             return
+        case <-m.done:
+            return
         case <-ticker.C:
-            if m.cmd.Process == nil {
+            // Check execution time
+            if m.limits.MaxExecutionTime > 0 && time.Since(m.startTime) > m.limits.MaxExecutionTime {
+                m.stop("time")
                 return
             }
 
-            // Check execution time
-            if time.Since(m.startTime) > m.limits.MaxExecutionTime {
-                _ = m.cmd.Process.Kill()
-                return
+            if m.limits.MaxMemoryMB > 0 {
+                if rss, err := readRSSKB(pid); err == nil && rss > int64(m.limits.MaxMemoryMB)*1024 {
+                    m.stop("memory")
+                    return
+                }
+            }
+
+            if m.limits.MaxCPUPercent > 0 {
+                ticks, err := readCPUTicks(pid)
+                if err != nil {
+                    continue
+                }
+                if windowTicks < 0 {
+                    windowStart, windowTicks = time.Now(), ticks
+                    continue
+                }
+                if elapsed := time.Since(windowStart); elapsed >= cpuWindow {
+                    pct := float64(ticks-windowTicks) / clockTicks / elapsed.Seconds() * 100
+                    if pct > float64(m.limits.MaxCPUPercent) {
+                        strikes++
+                    } else {
+                        strikes = 0
+                    }
+                    if strikes >= cpuStrikes {
+                        m.stop("cpu")
+                        return
+                    }
+                    windowStart, windowTicks = time.Now(), ticks
+                }
             }
+        }
+    }
+}
 
-            // Additional resource checks would go here
-            // (memory usage, CPU usage, etc.)
+// clockTicks is USER_HZ, the unit of utime/stime in /proc/<pid>/stat. It is
+// 100 on every Linux architecture OpenWrt supports.
+const clockTicks = 100
+
+// readRSSKB returns VmRSS of pid in kB from /proc/<pid>/status.
+func readRSSKB(pid int) (int64, error) {
+    b, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+    if err != nil {
+        return 0, err
+    }
+    for _, line := range strings.Split(string(b), "\n") {
+        if !strings.HasPrefix(line, "VmRSS:") {
+            continue
         }
+        f := strings.Fields(strings.TrimPrefix(line, "VmRSS:"))
+        if len(f) == 0 {
+            break
+        }
+        return strconv.ParseInt(f[0], 10, 64)
+    }
+    // Zombies and kernel threads have no VmRSS
+    return 0, nil
+}
+
+// readCPUTicks returns utime+stime of pid from /proc/<pid>/stat.
+func readCPUTicks(pid int) (int64, error) {
+    b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+    if err != nil {
+        return 0, err
+    }
+    // The command name may contain spaces; fields resume after the last ')'.
+    s := string(b)
+    i := strings.LastIndexByte(s, ')')
+    if i < 0 {
+        return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+    }
+    f := strings.Fields(s[i+1:])
+    // f[0] is field 3 (state); utime and stime are fields 14 and 15.
+    if len(f) < 13 {
+        return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+    }
+    utime, err := strconv.ParseInt(f[11], 10, 64)
+    if err != nil {
+        return 0, err
+    }
+    stime, err := strconv.ParseInt(f[12], 10, 64)
+    if err != nil {
+        return 0, err
     }
+    return utime + stime, nil
 }
@@ -0,0 +1,161 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aezizhu/LuciCodex/internal/config"
+	"github.com/aezizhu/LuciCodex/internal/plan"
+)
+
+func requireLinux(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are enforced on Linux only")
+	}
+}
+
+// limitOf returns the soft value of a "Max ..." row of /proc/<pid>/limits.
+func limitOf(limits, name string) string {
+	for _, line := range strings.Split(limits, "\n") {
+		if strings.HasPrefix(line, name) {
+			if f := strings.Fields(strings.TrimPrefix(line, name)); len(f) > 0 {
+				return f[0]
+			}
+		}
+	}
+	return ""
+}
+
+// sandboxed returns argv prepared by a sandbox with limits l.
+func sandboxed(t *testing.T, l ResourceLimits, argv ...string) *exec.Cmd {
+	t.Helper()
+	s := NewSandbox(config.Config{})
+	s.SetLimits(l)
+	cmd := exec.CommandContext(context.Background(), argv[0], argv[1:]...)
+	if err := s.Apply(cmd); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	return cmd
+}
+
+func TestSandbox_AppliesRlimitsBeforeExec(t *testing.T) {
+	requireLinux(t)
+	// No delay: the limits are in place before sh runs, and the cat it
+	// forks inherits them.
+	cmd := sandboxed(t, ResourceLimits{MaxMemoryMB: 64, MaxFileSize: 1 << 20, MaxOpenFiles: 64}, "sh", "-c", "cat /proc/self/limits")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	m := NewMonitor(cmd, ResourceLimits{MaxExecutionTime: 5 * time.Second})
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := m.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"Max address space": "67108864",
+		"Max file size":     "1048576",
+		"Max open files":    "64",
+	} {
+		if got := limitOf(out.String(), name); got != want {
+			t.Errorf("expected %s %s, got %q", name, want, got)
+		}
+	}
+}
+
+func TestSandbox_FileSizeLimit(t *testing.T) {
+	requireLinux(t)
+	path := filepath.Join(t.TempDir(), "big")
+	cmd := sandboxed(t, ResourceLimits{MaxFileSize: 1 << 20}, "dd", "if=/dev/zero", "of="+path, "bs=65536", "count=32")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected dd to fail past the file size limit")
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() > 1<<20 {
+		t.Fatalf("file grew past the limit: %v", fi.Size())
+	}
+}
+
+func TestWrapHelper(t *testing.T) {
+	cmd := &exec.Cmd{Path: "/bin/ls", Args: []string{"ls", "-l"}}
+	wrapHelper(cmd, "/usr/bin/lucicodex", []string{"-as", "1"})
+	wrapHelper(cmd, "/usr/bin/lucicodex", []string{"-uid", "65534"})
+	want := "/usr/bin/lucicodex __isolate -uid 65534 -as 1 -- /bin/ls ls -l"
+	if got := strings.Join(cmd.Args, " "); cmd.Path != "/usr/bin/lucicodex" || got != want {
+		t.Fatalf("expected one helper invocation %q, got %s %q", want, cmd.Path, got)
+	}
+}
+
+func TestMonitor_TimeLimit(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	m := NewMonitor(cmd, ResourceLimits{MaxExecutionTime: 200 * time.Millisecond})
+	start := time.Now()
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	err := m.Wait()
+	if err == nil || m.Violation() != "time" {
+		t.Fatalf("expected time violation, got %v (%q)", err, m.Violation())
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("command was not killed in time")
+	}
+}
+
+func TestExecuteCommand_KillsProcessGroup(t *testing.T) {
+	s := NewSandbox(config.Config{TimeoutSeconds: 5})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	// The background sleep inherits stdout; without a group kill Wait would
+	// block until it exits.
+	cmd, err := s.ExecuteCommand(ctx, plan.PlannedCommand{Command: []string{"sh", "-c", "sleep 30 & wait"}})
+	if err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the command to be killed")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("grandchild survived the timeout")
+	}
+}
+
+func TestApply_Dir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sandbox")
+	s := NewSandbox(config.Config{SandboxDir: dir})
+	cmd := exec.Command("true")
+	if err := s.Apply(cmd); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if cmd.Dir != dir || !strings.Contains(strings.Join(cmd.Env, "\n"), "HOME="+dir) {
+		t.Errorf("expected %s as working and home directory, got %q %q", dir, cmd.Dir, cmd.Env)
+	}
+	if cmd.Cancel != nil {
+		t.Error("Apply must leave cancellation to the caller")
+	}
+	cmd = exec.Command("true")
+	cmd.Dir = "/"
+	if err := s.Apply(cmd); err != nil || cmd.Dir != "/" {
+		t.Errorf("expected the caller's directory to be kept, got %q, %v", cmd.Dir, err)
+	}
+}
+
+func TestProcSampling(t *testing.T) {
+	requireLinux(t)
+	if rss, err := readRSSKB(os.Getpid()); err != nil || rss <= 0 {
+		t.Errorf("expected RSS of the test process, got %d, %v", rss, err)
+	}
+	if _, err := readCPUTicks(os.Getpid()); err != nil {
+		t.Errorf("readCPUTicks failed: %v", err)
+	}
+}
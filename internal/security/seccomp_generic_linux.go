@@ -0,0 +1,9 @@
+//go:build linux && (arm64 || riscv64)
+
+package security
+
+import "syscall"
+
+// archSyscalls are the allowlist calls specific to the architectures with
+// the generic syscall table, which has no legacy calls such as open.
+var archSyscalls = []uintptr{syscall.SYS_FSTATAT, syscall.SYS_FADVISE64}
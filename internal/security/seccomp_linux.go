@@ -0,0 +1,153 @@
+//go:build linux && (386 || amd64 || arm || arm64 || riscv64 || mips || mipsle || mips64 || mips64le || ppc64le)
+
+package security
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+	seccompRetAllow   = 0x7fff0000
+	seccompRetErrno   = 0x00050000
+)
+
+// allowedSyscalls are the calls the allowlist profile permits on every
+// architecture: what the C library, busybox and the read-only diagnostics
+// (cat, ip, ubus, uci, logread, ps, df, ...) need to read files, /proc and
+// netlink or ubus sockets. Privileged and configuration-changing calls
+// (mount, module loading, reboot, ptrace, setuid, xattr writes, ...) are
+// absent. archSyscalls and socketSyscalls add the calls whose names differ
+// between architectures.
+var allowedSyscalls = []uintptr{
+	syscall.SYS_BRK, syscall.SYS_CAPGET, syscall.SYS_CHDIR, syscall.SYS_CLOCK_GETRES,
+	syscall.SYS_CLOCK_GETTIME, syscall.SYS_CLOCK_NANOSLEEP, syscall.SYS_CLONE, syscall.SYS_CLOSE,
+	syscall.SYS_DUP, syscall.SYS_DUP3, syscall.SYS_EPOLL_CREATE1, syscall.SYS_EPOLL_CTL,
+	syscall.SYS_EPOLL_PWAIT, syscall.SYS_EVENTFD2, syscall.SYS_EXECVE, syscall.SYS_EXIT,
+	syscall.SYS_EXIT_GROUP, syscall.SYS_FACCESSAT, syscall.SYS_FCHDIR, syscall.SYS_FCNTL,
+	syscall.SYS_FDATASYNC, syscall.SYS_FGETXATTR, syscall.SYS_FLISTXATTR, syscall.SYS_FLOCK,
+	syscall.SYS_FSTAT, syscall.SYS_FSTATFS, syscall.SYS_FSYNC, syscall.SYS_FTRUNCATE,
+	syscall.SYS_FUTEX, syscall.SYS_GETCWD, syscall.SYS_GETDENTS64, syscall.SYS_GETEGID,
+	syscall.SYS_GETEUID, syscall.SYS_GETGID, syscall.SYS_GETGROUPS, syscall.SYS_GETITIMER,
+	syscall.SYS_GETPGID, syscall.SYS_GETPID, syscall.SYS_GETPPID, syscall.SYS_GETPRIORITY,
+	syscall.SYS_GETRESGID, syscall.SYS_GETRESUID, syscall.SYS_GETRLIMIT, syscall.SYS_GETRUSAGE,
+	syscall.SYS_GETSID, syscall.SYS_GETTID, syscall.SYS_GETTIMEOFDAY, syscall.SYS_GETUID,
+	syscall.SYS_GETXATTR, syscall.SYS_GET_ROBUST_LIST, syscall.SYS_INOTIFY_ADD_WATCH,
+	syscall.SYS_INOTIFY_INIT1, syscall.SYS_INOTIFY_RM_WATCH, syscall.SYS_IOCTL, syscall.SYS_IOPRIO_GET,
+	syscall.SYS_KILL, syscall.SYS_LGETXATTR, syscall.SYS_LISTXATTR, syscall.SYS_LLISTXATTR,
+	syscall.SYS_LSEEK, syscall.SYS_MADVISE, syscall.SYS_MINCORE, syscall.SYS_MKDIRAT,
+	syscall.SYS_MMAP, syscall.SYS_MPROTECT, syscall.SYS_MREMAP, syscall.SYS_MSYNC,
+	syscall.SYS_MUNMAP, syscall.SYS_NANOSLEEP, syscall.SYS_OPENAT, syscall.SYS_PIPE2,
+	syscall.SYS_PPOLL, syscall.SYS_PRCTL, syscall.SYS_PREAD64, syscall.SYS_PREADV,
+	syscall.SYS_PRLIMIT64, syscall.SYS_PSELECT6, syscall.SYS_PWRITE64, syscall.SYS_PWRITEV,
+	syscall.SYS_READ, syscall.SYS_READAHEAD, syscall.SYS_READLINKAT, syscall.SYS_READV,
+	syscall.SYS_RECVMMSG, syscall.SYS_RESTART_SYSCALL, syscall.SYS_RT_SIGACTION,
+	syscall.SYS_RT_SIGPENDING, syscall.SYS_RT_SIGPROCMASK, syscall.SYS_RT_SIGQUEUEINFO,
+	syscall.SYS_RT_SIGRETURN, syscall.SYS_RT_SIGSUSPEND, syscall.SYS_RT_SIGTIMEDWAIT,
+	syscall.SYS_RT_TGSIGQUEUEINFO, syscall.SYS_SCHED_GETAFFINITY, syscall.SYS_SCHED_GETPARAM,
+	syscall.SYS_SCHED_GETSCHEDULER, syscall.SYS_SCHED_GET_PRIORITY_MAX,
+	syscall.SYS_SCHED_GET_PRIORITY_MIN, syscall.SYS_SCHED_YIELD, syscall.SYS_SENDFILE,
+	syscall.SYS_SETITIMER, syscall.SYS_SETPGID, syscall.SYS_SETRLIMIT, syscall.SYS_SETSID,
+	syscall.SYS_SET_ROBUST_LIST, syscall.SYS_SET_TID_ADDRESS, syscall.SYS_SIGALTSTACK,
+	syscall.SYS_SIGNALFD4, syscall.SYS_SPLICE, syscall.SYS_STATFS, syscall.SYS_SYSINFO,
+	syscall.SYS_SYSLOG, syscall.SYS_TEE, syscall.SYS_TGKILL, syscall.SYS_TIMERFD_CREATE,
+	syscall.SYS_TIMERFD_GETTIME, syscall.SYS_TIMERFD_SETTIME, syscall.SYS_TIMER_CREATE,
+	syscall.SYS_TIMER_DELETE, syscall.SYS_TIMER_GETOVERRUN, syscall.SYS_TIMER_GETTIME,
+	syscall.SYS_TIMER_SETTIME, syscall.SYS_TIMES, syscall.SYS_TKILL, syscall.SYS_UMASK,
+	syscall.SYS_UNAME, syscall.SYS_UNLINKAT, syscall.SYS_UTIMENSAT, syscall.SYS_WAIT4,
+	syscall.SYS_WAITID, syscall.SYS_WRITE, syscall.SYS_WRITEV,
+}
+
+// deniedSyscalls fail with EPERM under the denylist profile, which permits
+// everything else. It is the fallback for targets whose C library needs a
+// call missing from the allowlist.
+var deniedSyscalls = []uintptr{
+	syscall.SYS_MOUNT, syscall.SYS_UMOUNT2, syscall.SYS_PIVOT_ROOT, syscall.SYS_CHROOT,
+	syscall.SYS_UNSHARE, syscall.SYS_REBOOT, syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_INIT_MODULE, syscall.SYS_DELETE_MODULE, syscall.SYS_PTRACE,
+	syscall.SYS_SWAPON, syscall.SYS_SWAPOFF, syscall.SYS_ACCT, syscall.SYS_SETTIMEOFDAY,
+	syscall.SYS_SETHOSTNAME, syscall.SYS_SETDOMAINNAME, syscall.SYS_PERF_EVENT_OPEN,
+	syscall.SYS_KEYCTL, syscall.SYS_ADD_KEY, syscall.SYS_REQUEST_KEY, syscall.SYS_QUOTACTL,
+}
+
+// time64Syscalls returns the 64-bit time calls of 32-bit architectures,
+// which musl 1.2 tries first, numbered from base (4000 on MIPS o32).
+func time64Syscalls(base uintptr) []uintptr {
+	var out []uintptr
+	// clock_gettime64 through ppoll_time64, recvmmsg_time64,
+	// rt_sigtimedwait_time64 and futex_time64; 404 (clock_settime64) and
+	// 405 (clock_adjtime64) are left out.
+	for _, nr := range []uintptr{403, 406, 407, 408, 409, 410, 411, 412, 413, 414, 417, 421, 422} {
+		out = append(out, base+nr)
+	}
+	return out
+}
+
+// seccompAllowlist returns the complete allowlist for this architecture.
+func seccompAllowlist() []uintptr {
+	list := append([]uintptr{}, allowedSyscalls...)
+	list = append(list, socketSyscalls...)
+	return append(list, archSyscalls...)
+}
+
+// installSeccomp installs the filter of profile on the calling thread. The
+// allowlist fails every other call with ENOSYS, so that the C library falls
+// back from calls newer than the list (statx, clone3, faccessat2, ...) to
+// the listed ones; the denylist fails its calls with EPERM.
+func installSeccomp(profile string) error {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return errors.New("unsupported architecture")
+	}
+	stmt := func(code uint16, k uint32) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, K: k}
+	}
+	jeq := func(k uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: jt, Jf: jf, K: k}
+	}
+	allow := stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow)
+	deny := stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM))
+	calls, match, other := deniedSyscalls, deny, allow
+	if profile == SeccompAllowlist {
+		calls, match = seccompAllowlist(), allow
+		other = stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.ENOSYS))
+	}
+	n := len(calls)
+	if n > 254 {
+		return fmt.Errorf("%d syscalls do not fit the filter's jumps", n)
+	}
+
+	// seccomp_data: int nr; u32 arch; ...
+	prog := []syscall.SockFilter{
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		jeq(arch, 1, 0),
+		deny,
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 0),
+	}
+	if runtime.GOARCH == "amd64" {
+		// Reject x32 calls, which share the amd64 arch value: jump to the
+		// default of the allowlist, or to the denial of the denylist.
+		reject := uint8(n)
+		if profile != SeccompAllowlist {
+			reject++
+		}
+		prog = append(prog, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jt: reject, K: 0x40000000})
+	}
+	// Each listed call jumps over the remaining comparisons and the
+	// default to match.
+	for i, nr := range calls {
+		prog = append(prog, jeq(uint32(nr), uint8(n-i), 0))
+	}
+	prog = append(prog, other, match)
+
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
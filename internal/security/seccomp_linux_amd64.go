@@ -0,0 +1,14 @@
+package security
+
+import "syscall"
+
+// archSyscalls are the allowlist calls specific to amd64.
+var archSyscalls = []uintptr{
+	syscall.SYS_OPEN, syscall.SYS_STAT, syscall.SYS_LSTAT, syscall.SYS_ACCESS, syscall.SYS_PIPE,
+	syscall.SYS_DUP2, syscall.SYS_POLL, syscall.SYS_SELECT, syscall.SYS_READLINK,
+	syscall.SYS_GETDENTS, syscall.SYS_NEWFSTATAT, syscall.SYS_FORK, syscall.SYS_VFORK,
+	syscall.SYS_UNLINK, syscall.SYS_RENAME, syscall.SYS_RENAMEAT, syscall.SYS_MKDIR,
+	syscall.SYS_RMDIR, syscall.SYS_GETPGRP, syscall.SYS_TIME, syscall.SYS_ARCH_PRCTL,
+	syscall.SYS_FADVISE64, syscall.SYS_EPOLL_CREATE, syscall.SYS_EPOLL_WAIT, syscall.SYS_EVENTFD,
+	syscall.SYS_INOTIFY_INIT, syscall.SYS_SIGNALFD, syscall.SYS_ALARM, syscall.SYS_PAUSE,
+}
@@ -0,0 +1,23 @@
+package security
+
+import "syscall"
+
+// archSyscalls are the allowlist calls specific to 32-bit ARM, including
+// the private cacheflush and set_tls calls the C library uses at startup.
+var archSyscalls = append([]uintptr{
+	syscall.SYS_OPEN, syscall.SYS_STAT, syscall.SYS_LSTAT, syscall.SYS_ACCESS, syscall.SYS_PIPE,
+	syscall.SYS_DUP2, syscall.SYS_POLL, syscall.SYS_SELECT, syscall.SYS__NEWSELECT,
+	syscall.SYS_READLINK, syscall.SYS_GETDENTS, syscall.SYS_FSTATAT64, syscall.SYS_FSTAT64,
+	syscall.SYS_STAT64, syscall.SYS_LSTAT64, syscall.SYS_FCNTL64, syscall.SYS__LLSEEK,
+	syscall.SYS_MMAP2, syscall.SYS_STATFS64, syscall.SYS_FSTATFS64, syscall.SYS_FORK,
+	syscall.SYS_VFORK, syscall.SYS_UNLINK, syscall.SYS_RENAME, syscall.SYS_RENAMEAT,
+	syscall.SYS_MKDIR, syscall.SYS_RMDIR, syscall.SYS_GETPGRP, syscall.SYS_TIME,
+	syscall.SYS_GETUID32, syscall.SYS_GETGID32, syscall.SYS_GETEUID32, syscall.SYS_GETEGID32,
+	syscall.SYS_GETGROUPS32, syscall.SYS_GETRESUID32, syscall.SYS_GETRESGID32,
+	syscall.SYS_UGETRLIMIT, syscall.SYS_SIGRETURN, syscall.SYS_SENDFILE64,
+	syscall.SYS_ARM_FADVISE64_64, syscall.SYS_EPOLL_CREATE, syscall.SYS_EPOLL_WAIT,
+	syscall.SYS_EVENTFD, syscall.SYS_INOTIFY_INIT, syscall.SYS_SIGNALFD, syscall.SYS_ALARM,
+	syscall.SYS_PAUSE, syscall.SYS_FTRUNCATE64, syscall.SYS_SIGPROCMASK, syscall.SYS_SIGACTION,
+	0x0f0002, // cacheflush
+	0x0f0005, // set_tls
+}, time64Syscalls(0)...)
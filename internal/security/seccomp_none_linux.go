@@ -0,0 +1,11 @@
+//go:build linux && !(386 || amd64 || arm || arm64 || riscv64 || mips || mipsle || mips64 || mips64le || ppc64le)
+
+package security
+
+import "errors"
+
+// installSeccomp fails on architectures without a syscall list;
+// isolationSupported already rejects isolate_seccomp there.
+func installSeccomp(profile string) error {
+	return errors.New("unsupported architecture")
+}
@@ -0,0 +1,14 @@
+//go:build linux && (amd64 || arm || arm64 || riscv64 || mips || mipsle || mips64 || mips64le || ppc64le)
+
+package security
+
+import "syscall"
+
+// socketSyscalls are the client socket calls of the allowlist: netlink for
+// ip, unix sockets for ubus, UDP for DNS. Listening is not allowed.
+var socketSyscalls = []uintptr{
+	syscall.SYS_SOCKET, syscall.SYS_CONNECT, syscall.SYS_SENDTO, syscall.SYS_RECVFROM,
+	syscall.SYS_SENDMSG, syscall.SYS_RECVMSG, syscall.SYS_BIND, syscall.SYS_GETSOCKNAME,
+	syscall.SYS_GETPEERNAME, syscall.SYS_SETSOCKOPT, syscall.SYS_GETSOCKOPT,
+	syscall.SYS_SHUTDOWN, syscall.SYS_SOCKETPAIR,
+}
@@ -0,0 +1,174 @@
+package uci
+
+import (
+	"fmt"
+)
+
+// Set changes an option value, or with option "" creates section as a
+// named section of type value (or retypes an existing one), like
+// "uci set pkg.section[.option]=value". Setting an option to "" deletes it.
+func (p *Package) Set(section, option, value string) error {
+	if option == "" {
+		if !validType(value) {
+			return fmt.Errorf("%w: section type %q", ErrInvalid, value)
+		}
+		if s, err := p.Section(section); err == nil {
+			s.Type = value
+			return nil
+		}
+		if !validName(section) {
+			return fmt.Errorf("%w: section %q", ErrInvalid, section)
+		}
+		p.counter++
+		p.Sections = append(p.Sections, &Section{Type: value, Name: section})
+		return nil
+	}
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	if !validName(option) {
+		return fmt.Errorf("%w: option %q", ErrInvalid, option)
+	}
+	if value == "" {
+		s.deleteOption(option)
+		return nil
+	}
+	s.setOption(option, value)
+	return nil
+}
+
+// Add appends an anonymous section of type typ and returns its generated
+// name, like "uci add pkg type".
+func (p *Package) Add(typ string) (string, error) {
+	if !validType(typ) {
+		return "", fmt.Errorf("%w: section type %q", ErrInvalid, typ)
+	}
+	s := &Section{Type: typ, Anonymous: true}
+	p.counter++
+	p.Sections = append(p.Sections, s)
+	p.fixup(s)
+	return s.Name, nil
+}
+
+// Delete removes an option, or with option "" the whole section.
+func (p *Package) Delete(section, option string) error {
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	if option == "" {
+		for i, o := range p.Sections {
+			if o == s {
+				p.Sections = append(p.Sections[:i], p.Sections[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	if s.Option(option) == nil {
+		return fmt.Errorf("%w: %s.%s.%s", ErrNotFound, p.Name, section, option)
+	}
+	s.deleteOption(option)
+	return nil
+}
+
+func (s *Section) deleteOption(name string) {
+	for i, o := range s.Options {
+		if o.Name == name {
+			s.Options = append(s.Options[:i], s.Options[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddList appends value to a list option, turning a plain option into a
+// list.
+func (p *Package) AddList(section, option, value string) error {
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	if !validName(option) {
+		return fmt.Errorf("%w: option %q", ErrInvalid, option)
+	}
+	s.addList(option, value)
+	return nil
+}
+
+// DelList removes every occurrence of value from a list option.
+func (p *Package) DelList(section, option, value string) error {
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	o := s.Option(option)
+	if o == nil {
+		return fmt.Errorf("%w: %s.%s.%s", ErrNotFound, p.Name, section, option)
+	}
+	if !o.IsList {
+		return fmt.Errorf("%w: %s.%s.%s is not a list", ErrInvalid, p.Name, section, option)
+	}
+	kept := o.Values[:0]
+	for _, v := range o.Values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	o.Values = kept
+	if len(o.Values) == 0 {
+		s.deleteOption(option)
+	}
+	return nil
+}
+
+// Rename gives a section, or with option != "" one of its options, a new
+// name. Renaming an anonymous section makes it named.
+func (p *Package) Rename(section, option, name string) error {
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	if !validName(name) {
+		return fmt.Errorf("%w: name %q", ErrInvalid, name)
+	}
+	if option == "" {
+		if o := p.named(name); o != nil && o != s {
+			return fmt.Errorf("%w: section %s.%s already exists", ErrInvalid, p.Name, name)
+		}
+		s.Name, s.Anonymous = name, false
+		return nil
+	}
+	o := s.Option(option)
+	if o == nil {
+		return fmt.Errorf("%w: %s.%s.%s", ErrNotFound, p.Name, section, option)
+	}
+	if x := s.Option(name); x != nil && x != o {
+		return fmt.Errorf("%w: option %s already exists", ErrInvalid, name)
+	}
+	o.Name = name
+	return nil
+}
+
+// Reorder moves a section to position pos among all sections of the
+// package; positions past the end move it last.
+func (p *Package) Reorder(section string, pos int) error {
+	s, err := p.Section(section)
+	if err != nil {
+		return err
+	}
+	if pos < 0 {
+		return fmt.Errorf("%w: position %d", ErrInvalid, pos)
+	}
+	for i, o := range p.Sections {
+		if o == s {
+			p.Sections = append(p.Sections[:i], p.Sections[i+1:]...)
+			break
+		}
+	}
+	if pos > len(p.Sections) {
+		pos = len(p.Sections)
+	}
+	p.Sections = append(p.Sections[:pos], append([]*Section{s}, p.Sections[pos:]...)...)
+	return nil
+}
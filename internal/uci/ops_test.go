@@ -0,0 +1,155 @@
+package uci
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	p := load(t, "network")
+	if err := p.Set("lan", "ipaddr", "192.168.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := p.Get("lan", "ipaddr"); v != "192.168.2.1" {
+		t.Errorf("ipaddr = %q", v)
+	}
+	// Setting a list option replaces the list with a single value.
+	if err := p.Set("@device[0]", "ports", "lan4"); err != nil {
+		t.Fatal(err)
+	}
+	if o := mustSection(t, p, "@device[0]").Option("ports"); o.IsList || o.Value() != "lan4" {
+		t.Errorf("ports: %+v", o)
+	}
+	// An empty value deletes the option.
+	if err := p.Set("lan", "ip6assign", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get("lan", "ip6assign"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ip6assign still set: %v", err)
+	}
+	// pkg.section=type creates a named section or changes its type.
+	if err := p.Set("guest", "", "interface"); err != nil {
+		t.Fatal(err)
+	}
+	if s := mustSection(t, p, "guest"); s.Type != "interface" || s.Anonymous || p.Sections[len(p.Sections)-1] != s {
+		t.Errorf("guest: %+v", s)
+	}
+	if err := p.Set("guest", "", "alias"); err != nil || mustSection(t, p, "guest").Type != "alias" {
+		t.Errorf("retype: %v", err)
+	}
+
+	if err := p.Set("nosuch", "proto", "static"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing section: %v", err)
+	}
+	if err := p.Set("lan", "bad-option", "x"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bad option name: %v", err)
+	}
+	if err := p.Set("bad-name", "", "interface"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bad section name: %v", err)
+	}
+}
+
+func TestAddDelete(t *testing.T) {
+	p := load(t, "firewall")
+	name, err := p.Add("rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Set("@rule[-1]", "name", "Allow-SSH"); err != nil {
+		t.Fatal(err)
+	}
+	if s := mustSection(t, p, name); p.Ref(s) != "@rule[1]" || s.Option("name").Value() != "Allow-SSH" {
+		t.Errorf("added rule %s: %+v", p.Ref(s), s)
+	}
+	if err := p.Delete("@zone[1]", "mtu_fix"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Delete("@zone[1]", "mtu_fix"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a missing option: %v", err)
+	}
+	if err := p.Delete("@zone[0]", ""); err != nil {
+		t.Fatal(err)
+	}
+	if v := mustSection(t, p, "@zone[0]").Option("name").Value(); v != "wan" {
+		t.Errorf("@zone[0] after delete is %q", v)
+	}
+	if _, err := p.Add("bad type"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("bad type: %v", err)
+	}
+}
+
+func TestLists(t *testing.T) {
+	p := load(t, "firewall")
+	if err := p.AddList("@zone[1]", "network", "wwan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DelList("@zone[1]", "network", "wan6"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustSection(t, p, "@zone[1]").Option("network").Values; !reflect.DeepEqual(got, []string{"wan", "wwan"}) {
+		t.Errorf("network = %v", got)
+	}
+	// add_list turns a plain option into a list.
+	if err := p.AddList("@zone[1]", "input", "DROP"); err != nil {
+		t.Fatal(err)
+	}
+	if o := mustSection(t, p, "@zone[1]").Option("input"); !o.IsList || !reflect.DeepEqual(o.Values, []string{"REJECT", "DROP"}) {
+		t.Errorf("input: %+v", o)
+	}
+	// Removing the last value removes the option.
+	if err := p.DelList("@zone[0]", "network", "lan"); err != nil {
+		t.Fatal(err)
+	}
+	if o := mustSection(t, p, "@zone[0]").Option("network"); o != nil {
+		t.Errorf("empty list kept: %+v", o)
+	}
+	if err := p.DelList("@zone[0]", "name", "lan"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("del_list on an option: %v", err)
+	}
+}
+
+func TestRenameReorder(t *testing.T) {
+	p := load(t, "firewall")
+	if err := p.Rename("@zone[0]", "", "lan_zone"); err != nil {
+		t.Fatal(err)
+	}
+	if s := mustSection(t, p, "lan_zone"); s.Anonymous || p.Ref(s) != "lan_zone" {
+		t.Errorf("renamed: %+v", s)
+	}
+	if err := p.Rename("@zone[1]", "", "lan_zone"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("duplicate name: %v", err)
+	}
+	if err := p.Rename("lan_zone", "forward", "fwd"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := p.Get("lan_zone", "fwd"); v != "ACCEPT" {
+		t.Errorf("renamed option = %q", v)
+	}
+	if err := p.Rename("lan_zone", "fwd", "input"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("option rename onto existing: %v", err)
+	}
+
+	if err := p.Reorder("@rule[0]", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reorder("@defaults[0]", 99); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, s := range p.Sections {
+		types = append(types, s.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"rule", "zone", "zone", "forwarding", "defaults"}) {
+		t.Errorf("order %v", types)
+	}
+}
+
+func mustSection(t *testing.T, p *Package, ref string) *Section {
+	t.Helper()
+	s, err := p.Section(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,499 @@
+package uci
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OptionSchema describes the values an option accepts.
+type OptionSchema struct {
+	// Type is one of bool, uint, port, portrange, ipaddr, ip4addr, ip6addr,
+	// cidr, cidr4, cidr6, ipmask, netmask, macaddr, wifimac (a MAC address
+	// or random), hostname, host, duration, channel, country, encryption, protocol, string or enum.
+	Type string
+	// Min and Max bound uint values and string lengths; Max 0 is unbounded.
+	Min, Max int
+	// Values lists the accepted enum values.
+	Values []string
+	// FoldCase compares enum values case-insensitively.
+	FoldCase bool
+	// List options take several values; "uci set" may give them separated
+	// by spaces.
+	List bool
+	// Lenient marks types whose catalog may lag behind newer OpenWrt
+	// releases or packages, so a mismatch only deserves a warning.
+	Lenient bool
+}
+
+// SectionSchema maps option names to their schema.
+type SectionSchema map[string]OptionSchema
+
+var (
+	boolean  = OptionSchema{Type: "bool"}
+	ip4      = OptionSchema{Type: "ip4addr"}
+	fwPolicy = OptionSchema{Type: "enum", Values: []string{"ACCEPT", "REJECT", "DROP"}, FoldCase: true}
+	family   = OptionSchema{Type: "enum", Values: []string{"any", "ipv4", "ipv6"}}
+	ports    = OptionSchema{Type: "portrange", List: true}
+	fwProto  = OptionSchema{Type: "protocol", List: true, Lenient: true}
+	fwIP     = OptionSchema{Type: "ipmask", List: true}
+	mtu      = OptionSchema{Type: "uint", Min: 68, Max: 65535}
+	mac      = OptionSchema{Type: "macaddr"}
+	leases   = OptionSchema{Type: "duration"}
+	odhcpdOp = OptionSchema{Type: "enum", Values: []string{"disabled", "server", "relay", "hybrid"}}
+)
+
+// Schemas is the catalog of known options by package and section type. It
+// covers the options of network, wireless, firewall, dhcp and system that
+// are most often changed; options missing from it are not checked.
+var Schemas = map[string]map[string]SectionSchema{
+	"network": {
+		"interface": {
+			"ipaddr":       {Type: "cidr4", List: true},
+			"netmask":      {Type: "netmask"},
+			"gateway":      ip4,
+			"broadcast":    ip4,
+			"ip6addr":      {Type: "cidr6", List: true},
+			"ip6gw":        {Type: "ip6addr"},
+			"ip6assign":    {Type: "uint", Max: 64},
+			"dns":          {Type: "ipaddr", List: true},
+			"mtu":          mtu,
+			"metric":       {Type: "uint"},
+			"macaddr":      mac,
+			"auto":         boolean,
+			"disabled":     boolean,
+			"defaultroute": boolean,
+			"peerdns":      boolean,
+			"delegate":     boolean,
+			"force_link":   boolean,
+		},
+		"device": {
+			"mtu":            mtu,
+			"macaddr":        mac,
+			"vlan_filtering": boolean,
+			"ipv6":           boolean,
+		},
+		"route": {
+			"target":  {Type: "cidr4"},
+			"netmask": {Type: "netmask"},
+			"gateway": ip4,
+			"metric":  {Type: "uint"},
+			"mtu":     mtu,
+		},
+	},
+	"wireless": {
+		"wifi-device": {
+			"channel":         {Type: "channel"},
+			"band":            {Type: "enum", Values: []string{"2g", "5g", "6g", "60g"}},
+			"htmode":          {Type: "enum", Lenient: true, Values: []string{"NOHT", "HT20", "HT40", "HT40-", "HT40+", "VHT20", "VHT40", "VHT80", "VHT160", "HE20", "HE40", "HE80", "HE160", "EHT20", "EHT40", "EHT80", "EHT160", "EHT320"}},
+			"hwmode":          {Type: "enum", Lenient: true, Values: []string{"11a", "11b", "11g", "11ad", "11na", "11ng", "11ac", "11ax"}},
+			"txpower":         {Type: "uint", Max: 40},
+			"country":         {Type: "country"},
+			"beacon_int":      {Type: "uint", Min: 15, Max: 65535},
+			"cell_density":    {Type: "uint", Max: 3},
+			"disabled":        boolean,
+			"legacy_rates":    boolean,
+			"noscan":          boolean,
+			"distance":        {Type: "uint"},
+			"frag":            {Type: "uint", Min: 256, Max: 2346},
+			"rts":             {Type: "uint", Max: 2347},
+			"require_mode":    {Type: "enum", Values: []string{"g", "n", "ac", "ax"}},
+			"acs_exclude_dfs": boolean,
+		},
+		"wifi-iface": {
+			"mode":           {Type: "enum", Values: []string{"ap", "sta", "adhoc", "wds", "monitor", "mesh"}},
+			"ssid":           {Type: "string", Min: 1, Max: 32},
+			"encryption":     {Type: "encryption", Lenient: true},
+			"hidden":         boolean,
+			"disabled":       boolean,
+			"isolate":        boolean,
+			"wds":            boolean,
+			"wmm":            boolean,
+			"ieee80211r":     boolean,
+			"ieee80211k":     boolean,
+			"ieee80211w":     {Type: "enum", Values: []string{"0", "1", "2"}},
+			"macfilter":      {Type: "enum", Values: []string{"disable", "allow", "deny"}},
+			"maclist":        {Type: "macaddr", List: true},
+			"macaddr":        {Type: "wifimac"},
+			"bssid":          mac,
+			"max_inactivity": {Type: "uint"},
+		},
+	},
+	"firewall": {
+		"defaults": {
+			"input":              fwPolicy,
+			"output":             fwPolicy,
+			"forward":            fwPolicy,
+			"syn_flood":          boolean,
+			"synflood_protect":   boolean,
+			"drop_invalid":       boolean,
+			"flow_offloading":    boolean,
+			"flow_offloading_hw": boolean,
+		},
+		"zone": {
+			"input":     fwPolicy,
+			"output":    fwPolicy,
+			"forward":   fwPolicy,
+			"masq":      boolean,
+			"mtu_fix":   boolean,
+			"family":    family,
+			"subnet":    fwIP,
+			"masq_src":  fwIP,
+			"masq_dest": fwIP,
+			"log":       boolean,
+			"enabled":   boolean,
+		},
+		"forwarding": {
+			"family":  family,
+			"enabled": boolean,
+		},
+		"rule": {
+			"target":    {Type: "enum", Values: []string{"ACCEPT", "REJECT", "DROP", "MARK", "NOTRACK", "HELPER", "DSCP"}, FoldCase: true},
+			"proto":     fwProto,
+			"src_port":  ports,
+			"dest_port": ports,
+			"src_ip":    fwIP,
+			"dest_ip":   fwIP,
+			"src_mac":   {Type: "macaddr", List: true},
+			"family":    family,
+			"enabled":   boolean,
+		},
+		"redirect": {
+			"target":     {Type: "enum", Values: []string{"DNAT", "SNAT"}, FoldCase: true},
+			"proto":      fwProto,
+			"src_port":   ports,
+			"src_dport":  ports,
+			"dest_port":  ports,
+			"src_ip":     fwIP,
+			"src_dip":    fwIP,
+			"dest_ip":    ip4,
+			"family":     family,
+			"reflection": boolean,
+			"enabled":    boolean,
+		},
+	},
+	"dhcp": {
+		"dhcp": {
+			"start":       {Type: "uint"},
+			"limit":       {Type: "uint"},
+			"leasetime":   leases,
+			"ignore":      boolean,
+			"force":       boolean,
+			"dynamicdhcp": boolean,
+			"dhcpv4":      {Type: "enum", Values: []string{"disabled", "server"}},
+			"dhcpv6":      odhcpdOp,
+			"ra":          odhcpdOp,
+			"ndp":         {Type: "enum", Values: []string{"disabled", "relay", "hybrid"}},
+		},
+		"dnsmasq": {
+			"domainneeded":      boolean,
+			"boguspriv":         boolean,
+			"localise_queries":  boolean,
+			"rebind_protection": boolean,
+			"authoritative":     boolean,
+			"logqueries":        boolean,
+			"noresolv":          boolean,
+			"port":              {Type: "uint", Max: 65535},
+			"cachesize":         {Type: "uint"},
+			"domain":            {Type: "hostname"},
+		},
+		"host": {
+			"mac":       {Type: "macaddr", List: true},
+			"ip":        ip4,
+			"name":      {Type: "hostname"},
+			"leasetime": leases,
+			"dns":       boolean,
+		},
+		"domain": {
+			"name": {Type: "hostname"},
+			"ip":   {Type: "ipaddr"},
+		},
+	},
+	"system": {
+		"system": {
+			"hostname":     {Type: "hostname"},
+			"log_size":     {Type: "uint"},
+			"log_ip":       {Type: "ipaddr"},
+			"log_port":     {Type: "port"},
+			"log_proto":    {Type: "enum", Values: []string{"udp", "tcp"}},
+			"conloglevel":  {Type: "uint", Min: 1, Max: 8},
+			"cronloglevel": {Type: "uint", Max: 9},
+			"ttylogin":     boolean,
+		},
+		"timeserver": {
+			"enabled":       boolean,
+			"enable_server": boolean,
+			"server":        {Type: "host", List: true},
+		},
+	},
+}
+
+// Lookup returns the schema of pkg.option in sections of type typ. With an
+// unknown type ("") it succeeds only when every section type of pkg that
+// knows the option describes it the same way.
+func Lookup(pkg, typ, option string) (OptionSchema, bool) {
+	types := Schemas[pkg]
+	if typ != "" {
+		o, ok := types[typ][option]
+		return o, ok
+	}
+	var found *OptionSchema
+	for _, sec := range types {
+		o, ok := sec[option]
+		if !ok {
+			continue
+		}
+		if found != nil && !reflect.DeepEqual(*found, o) {
+			return OptionSchema{}, false
+		}
+		found = &o
+	}
+	if found == nil {
+		return OptionSchema{}, false
+	}
+	return *found, true
+}
+
+// ValidateSet checks the value of "uci set" (list values may be separated
+// by spaces) against the schema.
+func (o OptionSchema) ValidateSet(value string) error {
+	if !o.List {
+		return o.Validate(value)
+	}
+	for _, v := range strings.Fields(value) {
+		if err := o.Validate(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValueError reports a value that does not match its option schema.
+type ValueError struct {
+	Value string
+	Want  string // e.g. "a port (1-65535)"
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("%q is not %s", e.Value, e.Want)
+}
+
+// Validate checks a single value against the schema.
+func (o OptionSchema) Validate(value string) error {
+	if o.valid(value) {
+		return nil
+	}
+	return &ValueError{Value: value, Want: o.describe()}
+}
+
+var (
+	macRE      = regexp.MustCompile(`^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){5}$`)
+	durationRE = regexp.MustCompile(`^[0-9]+[smhdw]?$`)
+	countryRE  = regexp.MustCompile(`^([A-Za-z]{2}|00)$`)
+	hostnameRE = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?$`)
+)
+
+var (
+	encryptions = []string{"none", "wep", "wep-open", "wep-shared", "psk", "psk2", "psk-mixed", "sae", "sae-mixed", "wpa", "wpa2", "wpa3", "wpa-mixed", "wpa3-mixed", "wpa3-192", "owe"}
+	ciphers     = []string{"ccmp", "ccmp256", "gcmp", "gcmp256", "tkip", "aes"}
+	protocols   = []string{"all", "tcp", "udp", "tcpudp", "udplite", "icmp", "icmpv6", "esp", "ah", "sctp", "gre", "igmp", "ipv6"}
+)
+
+func (o OptionSchema) valid(v string) bool {
+	switch o.Type {
+	case "bool":
+		switch v {
+		case "0", "1", "off", "on", "no", "yes", "false", "true", "disabled", "enabled":
+			return true
+		}
+		return false
+	case "uint":
+		n, err := strconv.ParseUint(v, 10, 32)
+		return err == nil && int(n) >= o.Min && (o.Max == 0 || int(n) <= o.Max)
+	case "port":
+		return validPort(v)
+	case "portrange":
+		lo, hi, found := strings.Cut(strings.TrimPrefix(v, "!"), "-")
+		if !found {
+			lo, hi, found = strings.Cut(lo, ":")
+		}
+		if !found {
+			return validPort(lo)
+		}
+		a, _ := strconv.Atoi(lo)
+		b, _ := strconv.Atoi(hi)
+		return validPort(lo) && validPort(hi) && a <= b
+	case "ipaddr", "ip4addr", "ip6addr":
+		a, err := netip.ParseAddr(v)
+		return err == nil && a.Zone() == "" && family4(o.Type, a.Is4())
+	case "cidr", "cidr4", "cidr6":
+		return validCIDR(v, o.Type)
+	case "ipmask":
+		v = strings.TrimPrefix(v, "!")
+		if addr, mask, found := strings.Cut(v, "/"); found && strings.Contains(mask, ".") {
+			a, err := netip.ParseAddr(addr)
+			return err == nil && a.Is4() && validNetmask(mask)
+		}
+		return validCIDR(v, "cidr")
+	case "netmask":
+		return validNetmask(v)
+	case "macaddr":
+		return macRE.MatchString(v)
+	case "wifimac":
+		return v == "random" || macRE.MatchString(v)
+	case "hostname":
+		return validHostname(v)
+	case "host":
+		_, err := netip.ParseAddr(v)
+		return err == nil || validHostname(v)
+	case "duration":
+		return v == "infinite" || durationRE.MatchString(v)
+	case "channel":
+		n, err := strconv.Atoi(v)
+		return v == "auto" || err == nil && n >= 1 && n <= 233
+	case "country":
+		return countryRE.MatchString(v)
+	case "encryption":
+		parts := strings.Split(v, "+")
+		if !contains(encryptions, parts[0], false) {
+			return false
+		}
+		for _, c := range parts[1:] {
+			if !contains(ciphers, c, false) {
+				return false
+			}
+		}
+		return true
+	case "protocol":
+		v = strings.TrimPrefix(v, "!")
+		n, err := strconv.Atoi(v)
+		return err == nil && n >= 0 && n <= 255 || contains(protocols, v, true)
+	case "string":
+		return len(v) >= o.Min && (o.Max == 0 || len(v) <= o.Max)
+	case "enum":
+		return contains(o.Values, v, o.FoldCase)
+	}
+	return true
+}
+
+func (o OptionSchema) describe() string {
+	switch o.Type {
+	case "bool":
+		return "a boolean (0 or 1)"
+	case "uint":
+		if o.Max > 0 {
+			return fmt.Sprintf("a number from %d to %d", o.Min, o.Max)
+		}
+		if o.Min > 0 {
+			return fmt.Sprintf("a number of at least %d", o.Min)
+		}
+		return "a non-negative number"
+	case "port":
+		return "a port (1-65535)"
+	case "portrange":
+		return "a port or port range (1-65535)"
+	case "ipaddr":
+		return "an IP address"
+	case "ip4addr":
+		return "an IPv4 address"
+	case "ip6addr":
+		return "an IPv6 address"
+	case "cidr":
+		return "an IP address or prefix"
+	case "cidr4":
+		return "an IPv4 address with an optional /prefix"
+	case "cidr6":
+		return "an IPv6 address with an optional /prefix"
+	case "ipmask":
+		return "an IP address, prefix or address/netmask"
+	case "netmask":
+		return "a netmask such as 255.255.255.0"
+	case "macaddr":
+		return "a MAC address such as aa:bb:cc:dd:ee:ff"
+	case "wifimac":
+		return "a MAC address such as aa:bb:cc:dd:ee:ff or random"
+	case "hostname":
+		return "a hostname"
+	case "host":
+		return "a hostname or IP address"
+	case "duration":
+		return "a duration such as 12h or infinite"
+	case "channel":
+		return "a channel (1-233 or auto)"
+	case "country":
+		return "a two-letter country code"
+	case "encryption":
+		return "an encryption such as psk2+ccmp or sae"
+	case "protocol":
+		return "a protocol name or number"
+	case "string":
+		if o.Max > 0 {
+			return fmt.Sprintf("a string of %d to %d bytes", o.Min, o.Max)
+		}
+		return fmt.Sprintf("a string of at least %d bytes", o.Min)
+	case "enum":
+		return "one of " + strings.Join(o.Values, ", ")
+	}
+	return o.Type
+}
+
+func validPort(v string) bool {
+	n, err := strconv.Atoi(v)
+	return err == nil && n >= 1 && n <= 65535 && v[0] != '+'
+}
+
+func family4(typ string, is4 bool) bool {
+	switch typ {
+	case "ip4addr", "cidr4":
+		return is4
+	case "ip6addr", "cidr6":
+		return !is4
+	}
+	return true
+}
+
+func validCIDR(v, typ string) bool {
+	if !strings.Contains(v, "/") {
+		a, err := netip.ParseAddr(v)
+		return err == nil && a.Zone() == "" && family4(typ, a.Is4())
+	}
+	p, err := netip.ParsePrefix(v)
+	return err == nil && family4(typ, p.Addr().Is4())
+}
+
+// validNetmask accepts dotted IPv4 masks with contiguous leading ones.
+func validNetmask(v string) bool {
+	a, err := netip.ParseAddr(v)
+	if err != nil || !a.Is4() {
+		return false
+	}
+	b := a.As4()
+	m := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	return ^m&(^m+1) == 0
+}
+
+// validHostname accepts dot-separated labels of letters, digits, - and _,
+// as OpenWrt's hostname datatype does.
+func validHostname(v string) bool {
+	if v == "" || len(v) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(v, "."), ".") {
+		if len(label) > 63 || !hostnameRE.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, v string, fold bool) bool {
+	for _, s := range list {
+		if s == v || fold && strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
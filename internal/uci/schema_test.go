@@ -0,0 +1,83 @@
+package uci
+
+import "testing"
+
+func TestSchema_Validate(t *testing.T) {
+	cases := []struct {
+		pkg, typ, option, value string
+		ok                      bool
+	}{
+		{"network", "interface", "ipaddr", "192.168.1.1", true},
+		{"network", "interface", "ipaddr", "192.168.1.1/24 10.0.0.1/8", true},
+		{"network", "interface", "ipaddr", "not-an-ip", false},
+		{"network", "interface", "ipaddr", "fd00::1", false},
+		{"network", "interface", "netmask", "255.255.255.0", true},
+		{"network", "interface", "netmask", "255.0.255.0", false},
+		{"network", "interface", "dns", "1.1.1.1 2606:4700::1111", true},
+		{"network", "interface", "mtu", "1500", true},
+		{"network", "interface", "mtu", "20", false},
+		{"network", "interface", "auto", "yes", true},
+		{"network", "interface", "auto", "maybe", false},
+		{"network", "interface", "macaddr", "AA:bb:cc:dd:ee:ff", true},
+		{"network", "interface", "macaddr", "aa-bb-cc-dd-ee-ff", false},
+		{"wireless", "wifi-device", "channel", "36", true},
+		{"wireless", "wifi-device", "channel", "auto", true},
+		{"wireless", "wifi-device", "channel", "999", false},
+		{"wireless", "wifi-device", "country", "DE", true},
+		{"wireless", "wifi-device", "country", "Germany", false},
+		{"wireless", "wifi-iface", "ssid", "My Network", true},
+		{"wireless", "wifi-iface", "ssid", "a-network-name-that-is-far-too-long", false},
+		{"wireless", "wifi-iface", "encryption", "psk2+ccmp", true},
+		{"wireless", "wifi-iface", "macaddr", "random", true},
+		{"wireless", "wifi-iface", "macaddr", "02:11:22:33:44:55", true},
+		{"wireless", "wifi-iface", "macaddr", "sometimes", false},
+		{"wireless", "wifi-iface", "bssid", "random", false},
+		{"wireless", "wifi-iface", "encryption", "wpa5", false},
+		{"firewall", "zone", "input", "accept", true},
+		{"firewall", "zone", "input", "ALLOW", false},
+		{"firewall", "rule", "dest_port", "22 8000-8080 !443", true},
+		{"firewall", "rule", "dest_port", "70000", false},
+		{"firewall", "rule", "dest_port", "90-80", false},
+		{"firewall", "rule", "src_ip", "!10.0.0.0/255.0.0.0", true},
+		{"firewall", "rule", "proto", "tcp udp 47", true},
+		{"dhcp", "dhcp", "leasetime", "12h", true},
+		{"dhcp", "dhcp", "leasetime", "forever", false},
+		{"dhcp", "host", "name", "nas-01.lan", true},
+		{"dhcp", "host", "name", "-nas", false},
+		{"system", "system", "hostname", "gw_1", true},
+		{"system", "system", "log_port", "0", false},
+		{"system", "timeserver", "server", "0.openwrt.pool.ntp.org 192.0.2.1", true},
+	}
+	for _, c := range cases {
+		o, ok := Lookup(c.pkg, c.typ, c.option)
+		if !ok {
+			t.Errorf("%s.%s.%s missing from the catalog", c.pkg, c.typ, c.option)
+			continue
+		}
+		if err := o.ValidateSet(c.value); (err == nil) != c.ok {
+			t.Errorf("%s.%s.%s=%q: err = %v, want ok %v", c.pkg, c.typ, c.option, c.value, err, c.ok)
+		}
+	}
+}
+
+func TestSchema_Lookup(t *testing.T) {
+	// channel only exists in wifi-device sections.
+	if o, ok := Lookup("wireless", "", "channel"); !ok || o.Type != "channel" {
+		t.Errorf("channel: %+v %v", o, ok)
+	}
+	// input means the same in defaults and zones.
+	if _, ok := Lookup("firewall", "", "input"); !ok {
+		t.Error("firewall input should resolve without a section type")
+	}
+	// target differs between rules and redirects.
+	if _, ok := Lookup("firewall", "", "target"); ok {
+		t.Error("ambiguous firewall target resolved without a section type")
+	}
+	if _, ok := Lookup("network", "interface", "nosuch"); ok {
+		t.Error("unknown option resolved")
+	}
+	err := Schemas["wireless"]["wifi-device"]["channel"].Validate("999")
+	if err == nil || err.Error() != `"999" is not a channel (1-233 or auto)` {
+		t.Errorf("error message: %v", err)
+	}
+}
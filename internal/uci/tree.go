@@ -0,0 +1,227 @@
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tree is a configuration directory such as /etc/config, loaded lazily and
+// changed only in memory.
+type Tree struct {
+	dir     string
+	pkgs    map[string]*Package
+	changed map[string]bool
+}
+
+// NewTree returns a Tree reading packages from dir.
+func NewTree(dir string) *Tree {
+	return &Tree{dir: dir, pkgs: map[string]*Package{}, changed: map[string]bool{}}
+}
+
+// Package returns the named package, loading it on first use.
+func (t *Tree) Package(name string) (*Package, error) {
+	if p, ok := t.pkgs[name]; ok {
+		return p, nil
+	}
+	if !validType(name) {
+		return nil, fmt.Errorf("%w: package %q", ErrInvalid, name)
+	}
+	p, err := LoadFile(filepath.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: package %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.pkgs[name] = p
+	return p, nil
+}
+
+// Changed returns the names of the packages modified so far, sorted.
+func (t *Tree) Changed() []string {
+	var out []string
+	for name := range t.changed {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Key is a parsed "package[.section[.option]][=value]" argument.
+type Key struct {
+	Package, Section, Option string
+	Value                    string
+	HasValue                 bool
+}
+
+// ParseKey parses a uci command argument.
+func ParseKey(arg string) (Key, error) {
+	var k Key
+	path, value, hasValue := strings.Cut(arg, "=")
+	k.Value, k.HasValue = value, hasValue
+	parts := strings.Split(path, ".")
+	if len(parts) > 3 || parts[0] == "" {
+		return k, fmt.Errorf("%w: %q", ErrInvalid, arg)
+	}
+	k.Package = parts[0]
+	if len(parts) > 1 {
+		k.Section = parts[1]
+	}
+	if len(parts) > 2 {
+		k.Option = parts[2]
+	}
+	return k, nil
+}
+
+// Get returns the value of "package.section.option", or the type of
+// "package.section".
+func (t *Tree) Get(key string) (string, error) {
+	k, err := ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	if k.Section == "" || k.HasValue {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, key)
+	}
+	p, err := t.Package(k.Package)
+	if err != nil {
+		return "", err
+	}
+	if k.Option == "" {
+		s, err := p.Section(k.Section)
+		if err != nil {
+			return "", err
+		}
+		return s.Type, nil
+	}
+	return p.Get(k.Section, k.Option)
+}
+
+// Exec applies a uci write command with its arguments, e.g.
+// Exec("set", "network.lan.ipaddr=192.168.2.1"). "add" returns the new
+// section's name. commit is accepted and does nothing; revert drops the
+// in-memory changes of a package.
+func (t *Tree) Exec(sub string, args ...string) (string, error) {
+	switch {
+	case sub == "commit" && len(args) <= 1:
+		return "", nil
+	case sub == "add" && len(args) != 2:
+		return "", fmt.Errorf("%w: uci add takes a package and a section type", ErrInvalid)
+	case sub != "add" && len(args) != 1:
+		return "", fmt.Errorf("%w: uci %s takes one argument", ErrInvalid, sub)
+	}
+	if sub == "add" {
+		p, err := t.Package(args[0])
+		if err != nil {
+			return "", err
+		}
+		name, err := p.Add(args[1])
+		if err == nil {
+			t.changed[p.Name] = true
+		}
+		return name, err
+	}
+
+	k, err := ParseKey(args[0])
+	if err != nil {
+		return "", err
+	}
+	if sub == "revert" {
+		delete(t.pkgs, k.Package)
+		delete(t.changed, k.Package)
+		return "", nil
+	}
+	if k.Section == "" {
+		return "", fmt.Errorf("%w: uci %s needs a section: %q", ErrInvalid, sub, args[0])
+	}
+	p, err := t.Package(k.Package)
+	if err != nil {
+		return "", err
+	}
+	needValue := func() error {
+		if !k.HasValue {
+			return fmt.Errorf("%w: uci %s needs a value: %q", ErrInvalid, sub, args[0])
+		}
+		return nil
+	}
+	switch sub {
+	case "set":
+		if err = needValue(); err == nil {
+			err = p.Set(k.Section, k.Option, k.Value)
+		}
+	case "delete":
+		err = p.Delete(k.Section, k.Option)
+	case "add_list", "del_list":
+		if err = needValue(); err == nil && k.Option == "" {
+			err = fmt.Errorf("%w: uci %s needs an option: %q", ErrInvalid, sub, args[0])
+		}
+		if err == nil && sub == "add_list" {
+			err = p.AddList(k.Section, k.Option, k.Value)
+		} else if err == nil {
+			err = p.DelList(k.Section, k.Option, k.Value)
+		}
+	case "rename":
+		if err = needValue(); err == nil {
+			err = p.Rename(k.Section, k.Option, k.Value)
+		}
+	case "reorder":
+		if err = needValue(); err == nil && k.Option != "" {
+			err = fmt.Errorf("%w: uci reorder takes a section: %q", ErrInvalid, args[0])
+		}
+		if err == nil {
+			var pos int
+			if pos, err = strconv.Atoi(k.Value); err != nil {
+				err = fmt.Errorf("%w: position %q", ErrInvalid, k.Value)
+			} else {
+				err = p.Reorder(k.Section, pos)
+			}
+		}
+	default:
+		return "", fmt.Errorf("%w: unsupported uci command %q", ErrInvalid, sub)
+	}
+	if err != nil {
+		return "", err
+	}
+	t.changed[p.Name] = true
+	return "", nil
+}
+
+// Batch applies the commands of a "uci batch" script, one per line, with
+// the quoting rules of configuration files. It stops at the first error,
+// reporting its line.
+func (t *Tree) Batch(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		words, err := SplitWords(sc.Text())
+		if err != nil {
+			return fmt.Errorf("batch line %d: %w", line, err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if _, err := t.Exec(words[0], words[1:]...); err != nil {
+			return fmt.Errorf("batch line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// Save writes every changed package into dir.
+func (t *Tree) Save(dir string) error {
+	for _, name := range t.Changed() {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(t.pkgs[name].String()), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package uci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTree_Exec(t *testing.T) {
+	tree := NewTree("testdata")
+	steps := [][]string{
+		{"set", "network.lan.ipaddr=10.0.0.1"},
+		{"set", "network.guest=interface"},
+		{"set", "network.guest.proto=static"},
+		{"add_list", "firewall.@zone[0].network=guest"},
+		{"commit", "network"},
+	}
+	for _, s := range steps {
+		if _, err := tree.Exec(s[0], s[1:]...); err != nil {
+			t.Fatalf("%v: %v", s, err)
+		}
+	}
+	name, err := tree.Exec("add", "firewall", "forwarding")
+	if err != nil || !strings.HasPrefix(name, "cfg") {
+		t.Fatalf("add = %q, %v", name, err)
+	}
+	if v, err := tree.Get("network.lan.ipaddr"); err != nil || v != "10.0.0.1" {
+		t.Errorf("get = %q, %v", v, err)
+	}
+	if v, err := tree.Get("firewall." + name); err != nil || v != "forwarding" {
+		t.Errorf("get section = %q, %v", v, err)
+	}
+	if v, _ := tree.Get("firewall.@zone[0].network"); v != "lan guest" {
+		t.Errorf("zone networks = %q", v)
+	}
+	if got := tree.Changed(); !reflect.DeepEqual(got, []string{"firewall", "network"}) {
+		t.Errorf("changed %v", got)
+	}
+
+	if _, err := tree.Exec("revert", "network"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tree.Get("network.lan.ipaddr"); v != "192.168.1.1" {
+		t.Errorf("after revert ipaddr = %q", v)
+	}
+
+	errs := []struct {
+		args []string
+		want error
+	}{
+		{[]string{"set", "network.lan.ipaddr"}, ErrInvalid},
+		{[]string{"set", "network=x"}, ErrInvalid},
+		{[]string{"set", "nosuch.lan.ipaddr=1"}, ErrNotFound},
+		{[]string{"set", "../etc.lan.x=1"}, ErrInvalid},
+		{[]string{"reorder", "network.lan=first"}, ErrInvalid},
+		{[]string{"add", "network"}, ErrInvalid},
+		{[]string{"show", "network"}, ErrInvalid},
+		{[]string{"delete", "network.nosuch"}, ErrNotFound},
+	}
+	for _, e := range errs {
+		if _, err := tree.Exec(e.args[0], e.args[1:]...); !errors.Is(err, e.want) {
+			t.Errorf("%v: got %v, want %v", e.args, err, e.want)
+		}
+	}
+}
+
+func TestTree_BatchAndSave(t *testing.T) {
+	tree := NewTree("testdata")
+	batch := `# guest network
+set network.guest=interface
+set network.guest.proto='static'
+set network.guest.ipaddr="192.168.3.1"
+add_list network.@device[0].ports='lan4'
+rename firewall.@zone[1]=wan
+commit
+`
+	if err := tree.Batch(strings.NewReader(batch)); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := tree.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	saved := NewTree(dir)
+	if v, err := saved.Get("network.guest.ipaddr"); err != nil || v != "192.168.3.1" {
+		t.Errorf("saved guest ipaddr = %q, %v", v, err)
+	}
+	if v, _ := saved.Get("network.@device[0].ports"); v != "lan1 lan2 lan3 lan4" {
+		t.Errorf("saved ports = %q", v)
+	}
+	if v, _ := saved.Get("firewall.wan.masq"); v != "1" {
+		t.Errorf("renamed zone masq = %q", v)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "quoting")); !os.IsNotExist(err) {
+		t.Error("unchanged packages must not be written")
+	}
+
+	err := NewTree("testdata").Batch(strings.NewReader("set network.lan.proto=dhcp\nset network.nosuch.proto=dhcp\n"))
+	if err == nil || !strings.Contains(err.Error(), "batch line 2") {
+		t.Errorf("expected the failing line, got %v", err)
+	}
+}
@@ -0,0 +1,379 @@
+// Package uci reads OpenWrt UCI configuration files into packages, sections
+// and options, and applies uci operations (set, add, delete, add_list,
+// del_list, rename, reorder) to them in memory.
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned for a package, section or option that does
+	// not exist.
+	ErrNotFound = errors.New("entry not found")
+	// ErrInvalid is returned for malformed names, references and arguments.
+	ErrInvalid = errors.New("invalid argument")
+)
+
+// Package is one configuration file, e.g. /etc/config/network.
+type Package struct {
+	Name     string
+	Sections []*Section
+	// counter numbers sections for generated anonymous section names.
+	counter int
+}
+
+// Section is a "config <type> [name]" block. Anonymous sections get a
+// generated name like uci does (cfgNNHHHH) and are written without it.
+type Section struct {
+	Type      string
+	Name      string
+	Anonymous bool
+	Options   []*Option
+}
+
+// Option is an "option" with a single value or a "list" with any number of
+// values.
+type Option struct {
+	Name   string
+	Values []string
+	IsList bool
+}
+
+// Value returns the option's value; list values are joined by spaces as in
+// "uci get".
+func (o *Option) Value() string {
+	return strings.Join(o.Values, " ")
+}
+
+// ParseError reports a syntax error with its line number.
+type ParseError struct {
+	Package string
+	Line    int
+	Msg     string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("uci: %s:%d: %s", e.Package, e.Line, e.Msg)
+}
+
+// LoadFile parses the configuration file at path, named after its base name.
+func LoadFile(path string) (*Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(filepath.Base(path), f)
+}
+
+// Parse reads a configuration file in /etc/config syntax.
+func Parse(name string, r io.Reader) (*Package, error) {
+	p := &Package{Name: name}
+	var cur *Section
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	fail := func(format string, args ...any) error {
+		return &ParseError{Package: name, Line: line, Msg: fmt.Sprintf(format, args...)}
+	}
+	for sc.Scan() {
+		line++
+		words, err := SplitWords(sc.Text())
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "package":
+			if len(words) != 2 {
+				return nil, fail("package takes one name")
+			}
+		case "config":
+			if len(words) < 2 || len(words) > 3 {
+				return nil, fail("config takes a type and an optional name")
+			}
+			if !validType(words[1]) {
+				return nil, fail("invalid section type %q", words[1])
+			}
+			cur = &Section{Type: words[1], Anonymous: true}
+			if len(words) == 3 && words[2] != "" {
+				if !validName(words[2]) {
+					return nil, fail("invalid section name %q", words[2])
+				}
+				cur.Name, cur.Anonymous = words[2], false
+				// A repeated name continues the earlier section.
+				if s := p.named(cur.Name); s != nil {
+					s.Type = cur.Type
+					cur = s
+					continue
+				}
+			}
+			p.counter++
+			p.Sections = append(p.Sections, cur)
+			p.fixup(cur)
+		case "option", "list":
+			if cur == nil {
+				return nil, fail("%s outside of a section", words[0])
+			}
+			if len(words) != 3 {
+				return nil, fail("%s takes a name and a value", words[0])
+			}
+			if !validName(words[1]) {
+				return nil, fail("invalid option name %q", words[1])
+			}
+			if words[0] == "option" {
+				cur.setOption(words[1], words[2])
+			} else {
+				cur.addList(words[1], words[2])
+			}
+		default:
+			return nil, fail("unknown keyword %q", words[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SplitWords splits a line of a configuration file or "uci batch" script
+// into words. Words may be single- or double-quoted, adjacent quoted and
+// unquoted parts form one word, a backslash escapes the next character
+// outside single quotes, and # starts a comment.
+func SplitWords(s string) ([]string, error) {
+	var (
+		words  []string
+		cur    strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case c == '#' && !inWord:
+			return words, nil
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated quote")
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			inWord = true
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// validName reports whether s may name a section or option.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// validType reports whether s may be a section type.
+func validType(s string) bool {
+	return s != "" && validName(strings.ReplaceAll(s, "-", "_"))
+}
+
+// fixup names an anonymous section the way libuci does when it loads a
+// file, from the section's position and a hash of its type, so that the
+// generated names (e.g. cfg02dc81 for the second section, a zone) match
+// those of the live system.
+func (p *Package) fixup(s *Section) {
+	if s == nil || !s.Anonymous || s.Name != "" {
+		return
+	}
+	hash := djbhash(5381, s.Type)
+	s.Name = fmt.Sprintf("cfg%02x%04x", p.counter, hash%(1<<16))
+}
+
+func djbhash(hash uint32, s string) uint32 {
+	for i := 0; i < len(s); i++ {
+		// libuci hashes plain (signed) chars.
+		hash = hash<<5 + hash + uint32(int32(int8(s[i])))
+	}
+	return hash & 0x7fffffff
+}
+
+func (p *Package) named(name string) *Section {
+	for _, s := range p.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Section resolves a section reference: a name, or @type[n] for the n-th
+// section of a type, counting from the end when n is negative.
+func (p *Package) Section(ref string) (*Section, error) {
+	if !strings.HasPrefix(ref, "@") {
+		if !validName(ref) {
+			return nil, fmt.Errorf("%w: section %q", ErrInvalid, ref)
+		}
+		if s := p.named(ref); s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("%w: %s.%s", ErrNotFound, p.Name, ref)
+	}
+	typ, idx, ok := strings.Cut(ref[1:], "[")
+	n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+	if !ok || !strings.HasSuffix(idx, "]") || err != nil || !validType(typ) {
+		return nil, fmt.Errorf("%w: section %q", ErrInvalid, ref)
+	}
+	var all []*Section
+	for _, s := range p.Sections {
+		if s.Type == typ {
+			all = append(all, s)
+		}
+	}
+	if n < 0 {
+		n += len(all)
+	}
+	if n < 0 || n >= len(all) {
+		return nil, fmt.Errorf("%w: %s.%s", ErrNotFound, p.Name, ref)
+	}
+	return all[n], nil
+}
+
+// Ref returns the reference "uci show" prints for s: its name, or @type[n]
+// for anonymous sections.
+func (p *Package) Ref(s *Section) string {
+	if !s.Anonymous {
+		return s.Name
+	}
+	n := 0
+	for _, o := range p.Sections {
+		if o == s {
+			break
+		}
+		if o.Type == s.Type {
+			n++
+		}
+	}
+	return fmt.Sprintf("@%s[%d]", s.Type, n)
+}
+
+// Option returns the named option of s, or nil.
+func (s *Section) Option(name string) *Option {
+	for _, o := range s.Options {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// Get returns the value of an option, like "uci get pkg.section.option".
+func (p *Package) Get(section, option string) (string, error) {
+	s, err := p.Section(section)
+	if err != nil {
+		return "", err
+	}
+	o := s.Option(option)
+	if o == nil {
+		return "", fmt.Errorf("%w: %s.%s.%s", ErrNotFound, p.Name, section, option)
+	}
+	return o.Value(), nil
+}
+
+func (s *Section) setOption(name, value string) {
+	if o := s.Option(name); o != nil {
+		o.Values, o.IsList = []string{value}, false
+		return
+	}
+	s.Options = append(s.Options, &Option{Name: name, Values: []string{value}})
+}
+
+func (s *Section) addList(name, value string) {
+	o := s.Option(name)
+	if o == nil {
+		s.Options = append(s.Options, &Option{Name: name, Values: []string{value}, IsList: true})
+		return
+	}
+	o.Values = append(o.Values, value)
+	o.IsList = true
+}
+
+// WriteTo writes the package in the format "uci commit" produces.
+func (p *Package) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, s := range p.Sections {
+		b.WriteString("\nconfig " + s.Type)
+		if !s.Anonymous {
+			b.WriteString(" " + quote(s.Name))
+		}
+		b.WriteString("\n")
+		for _, o := range s.Options {
+			kw := "option"
+			if o.IsList {
+				kw = "list"
+			}
+			for _, v := range o.Values {
+				fmt.Fprintf(&b, "\t%s %s %s\n", kw, o.Name, quote(v))
+			}
+		}
+	}
+	if len(p.Sections) > 0 {
+		b.WriteString("\n")
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// String returns the package in /etc/config syntax.
+func (p *Package) String() string {
+	var b strings.Builder
+	p.WriteTo(&b)
+	return b.String()
+}
+
+// quote single-quotes v, escaping embedded quotes as '\”.
+func quote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
@@ -0,0 +1,140 @@
+package uci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, name string) *Package {
+	t.Helper()
+	p, err := LoadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParse_Network(t *testing.T) {
+	p := load(t, "network")
+	if p.Name != "network" || len(p.Sections) != 6 {
+		t.Fatalf("got %d sections in %q", len(p.Sections), p.Name)
+	}
+	if v, err := p.Get("lan", "ipaddr"); err != nil || v != "192.168.1.1" {
+		t.Errorf("lan.ipaddr = %q, %v", v, err)
+	}
+	dev, err := p.Section("@device[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dev.Anonymous || !strings.HasPrefix(dev.Name, "cfg03") || p.Ref(dev) != "@device[0]" {
+		t.Errorf("anonymous device: %+v, ref %s", dev, p.Ref(dev))
+	}
+	ports := dev.Option("ports")
+	if !ports.IsList || !reflect.DeepEqual(ports.Values, []string{"lan1", "lan2", "lan3"}) || ports.Value() != "lan1 lan2 lan3" {
+		t.Errorf("ports: %+v", ports)
+	}
+	// Anonymous sections can also be addressed by their generated name.
+	if s, err := p.Section(dev.Name); err != nil || s != dev {
+		t.Errorf("Section(%s) = %v, %v", dev.Name, s, err)
+	}
+}
+
+func TestParse_Quoting(t *testing.T) {
+	p := load(t, "quoting")
+	bob, err := p.Section("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"name": "Bob's PC", "note": `say "hi"`, "bare": "value", "mixed": "prefixed", "hash": "a#b"}
+	for k, v := range want {
+		if got := bob.Option(k); got == nil || got.Value() != v {
+			t.Errorf("%s = %+v, want %q", k, got, v)
+		}
+	}
+	host, err := p.Section("@host[-1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := host.Option("empty"); o == nil || o.Value() != "" {
+		t.Errorf("empty option: %+v", o)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	cases := map[string]string{
+		"option outside": "option foo 'bar'\n",
+		"unterminated":   "config host\n\toption name 'Bob\n",
+		"bad keyword":    "config host\n\tsetting foo bar\n",
+		"bad name":       "config host 'my host'\n",
+		"bad option":     "config host\n\toption na.me x\n",
+	}
+	for name, in := range cases {
+		_, err := Parse("test", strings.NewReader(in))
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Line == 0 {
+			t.Errorf("%s: expected a ParseError with a line, got %v", name, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"network", "firewall", "quoting"} {
+		p := load(t, name)
+		again, err := Parse(name, strings.NewReader(p.String()))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, p.String())
+		}
+		if !reflect.DeepEqual(p, again) {
+			t.Errorf("%s: round trip changed the package:\n%s", name, p.String())
+		}
+	}
+	// Files written by uci are reproduced exactly.
+	b, _ := os.ReadFile(filepath.Join("testdata", "firewall"))
+	if got := load(t, "firewall").String(); got != string(b) {
+		t.Errorf("firewall written as:\n%s", got)
+	}
+}
+
+func TestSection_References(t *testing.T) {
+	p := load(t, "firewall")
+	cases := map[string]string{"@zone[0]": "lan", "@zone[1]": "wan", "@zone[-1]": "wan", "@rule[0]": "Allow-Ping"}
+	for ref, name := range cases {
+		s, err := p.Section(ref)
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		if got := s.Option("name").Value(); got != name {
+			t.Errorf("%s: name %q, want %q", ref, got, name)
+		}
+	}
+	for _, ref := range []string{"@zone[2]", "@zone[-3]", "nosuch"} {
+		if _, err := p.Section(ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"@zone", "@zone[x]", "@zone[0", "bad-name", ""} {
+		if _, err := p.Section(ref); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid, got %v", ref, err)
+		}
+	}
+}
+
+func TestGeneratedNames(t *testing.T) {
+	p, err := Parse("firewall", strings.NewReader("config defaults\n\nconfig zone\n\toption name 'lan'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Names follow libuci: section counter and a hash of the type.
+	if p.Sections[0].Name != "cfg01e63d" || p.Sections[1].Name != "cfg02dc81" {
+		t.Errorf("names %s, %s", p.Sections[0].Name, p.Sections[1].Name)
+	}
+	name, err := p.Add("zone")
+	if err != nil || name != "cfg03dc81" {
+		t.Errorf("Add = %q, %v", name, err)
+	}
+}
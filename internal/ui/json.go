@@ -4,7 +4,10 @@ import (
     "encoding/json"
     "io"
 
+    "github.com/aezizhu/LuciCodex/internal/answer"
     "github.com/aezizhu/LuciCodex/internal/executor"
+    "github.com/aezizhu/LuciCodex/internal/explain"
+    "github.com/aezizhu/LuciCodex/internal/openwrt"
     "github.com/aezizhu/LuciCodex/internal/plan"
 )
 
@@ -21,3 +24,24 @@ func PrintResultsJSON(w io.Writer, res executor.Results) error {
 }
 
 
+
+func PrintExplanationJSON(w io.Writer, e explain.Explanation) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(e)
+}
+
+func PrintAnswerJSON(w io.Writer, a answer.Answer) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(a)
+}
+
+func PrintFactChangesJSON(w io.Writer, changes []openwrt.FactChange) error {
+    if changes == nil {
+        changes = []openwrt.FactChange{}
+    }
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(changes)
+}
@@ -5,8 +5,12 @@ import (
     "fmt"
     "io"
     "strings"
+    "text/tabwriter"
 
+    "github.com/aezizhu/LuciCodex/internal/answer"
     "github.com/aezizhu/LuciCodex/internal/executor"
+    "github.com/aezizhu/LuciCodex/internal/explain"
+    "github.com/aezizhu/LuciCodex/internal/openwrt"
     "github.com/aezizhu/LuciCodex/internal/plan"
 )
 
@@ -15,10 +19,28 @@ func PrintPlan(w io.Writer, p plan.Plan) {
         fmt.Fprintf(w, "Summary: %s\n\n", p.Summary)
     }
     for i, c := range p.Commands {
-        fmt.Fprintf(w, "[%d] %s\n", i+1, executor.FormatCommand(c.Command))
+        fmt.Fprintf(w, "[%d] %s\n", i+1, executor.FormatStep(c))
         if strings.TrimSpace(c.Description) != "" {
             fmt.Fprintf(w, "    - %s\n", c.Description)
         }
+        if c.IsWrite() {
+            printPayload(w, c.WriteFile.Content)
+        } else if c.Stdin != "" {
+            printPayload(w, c.Stdin)
+        }
+    }
+    if len(p.ConfigDiffs) > 0 {
+        fmt.Fprintln(w, "\nConfig changes (preview):")
+        for _, d := range p.ConfigDiffs {
+            if d.Error != "" {
+                fmt.Fprintf(w, "! %s: %s\n", d.Package, d.Error)
+            }
+            if d.Diff != "" {
+                fmt.Fprint(w, d.Diff)
+            } else if d.Error == "" {
+                fmt.Fprintf(w, "  %s: no changes\n", d.Package)
+            }
+        }
     }
     if len(p.Warnings) > 0 {
         fmt.Fprintln(w, "\nWarnings:")
@@ -43,13 +65,32 @@ type Results = executor.Results
 func PrintResults(w io.Writer, res Results) {
     for _, item := range res.Items {
         status := "ok"
-        if item.Err != nil {
+        switch {
+        case item.TimedOut:
+            status = "timed out"
+        case item.Signal != "":
+            status = "killed by " + item.Signal
+        case item.Err != nil && item.ExitCode > 0:
+            status = fmt.Sprintf("exit %d", item.ExitCode)
+        case item.Err != nil:
             status = "error"
         }
-        fmt.Fprintf(w, "[%d] (%s, %s) %s\n", item.Index+1, status, item.Elapsed, executor.FormatCommand(item.Command))
+        if item.Auto {
+            status += ", auto"
+        }
+        fmt.Fprintf(w, "[%d] (%s, %s) %s\n", item.Index+1, status, item.Elapsed, executor.FormatStep(item.Step))
         if strings.TrimSpace(item.Output) != "" {
             fmt.Fprintln(w, indent(item.Output, 2))
         }
+        if item.StdoutTruncated || item.StderrTruncated {
+            fmt.Fprintln(w, "  [output truncated]")
+        }
+        for _, warn := range item.Warnings {
+            fmt.Fprintf(w, "  warning: %s\n", warn)
+        }
+    }
+    if res.Watchdog != nil {
+        fmt.Fprintf(w, "\nConnectivity checks:\n%s", res.Watchdog)
     }
     if res.Failed > 0 {
         fmt.Fprintf(w, "\n%d command(s) failed.\n", res.Failed)
@@ -58,6 +99,64 @@ func PrintResults(w io.Writer, res Results) {
     }
 }
 
+func PrintExplanation(w io.Writer, e explain.Explanation) {
+    fmt.Fprintf(w, "Purpose: %s\n", e.Purpose)
+    if len(e.Effects) > 0 {
+        fmt.Fprintln(w, "\nEffects:")
+        for _, eff := range e.Effects {
+            fmt.Fprintf(w, "- %s\n", eff)
+        }
+    }
+    if len(e.Steps) > 0 {
+        fmt.Fprintln(w, "\nSteps:")
+        for i, st := range e.Steps {
+            fmt.Fprintf(w, "[%d] %s\n", i+1, st)
+        }
+    }
+    if e.Risk != "" {
+        fmt.Fprintf(w, "\nRisk: %s\n", e.Risk)
+        for _, r := range e.RiskReasons {
+            fmt.Fprintf(w, "- %s\n", r)
+        }
+    }
+    if len(e.RelatedServices) > 0 {
+        fmt.Fprintf(w, "\nRelated services: %s\n", strings.Join(e.RelatedServices, ", "))
+    }
+}
+
+func PrintAnswer(w io.Writer, a answer.Answer) {
+    fmt.Fprintf(w, "\nAnswer: %s\n", a.Answer)
+    if a.Table == nil {
+        return
+    }
+    fmt.Fprintln(w)
+    tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, strings.Join(a.Table.Columns, "\t"))
+    for _, row := range a.Table.Rows {
+        fmt.Fprintln(tw, strings.Join(row, "\t"))
+    }
+    tw.Flush()
+}
+
+// PrintFactChanges lists changed facts as "~ topic path: old -> new", with
+// "+" for added and "-" for removed values.
+func PrintFactChanges(w io.Writer, changes []openwrt.FactChange) {
+    if len(changes) == 0 {
+        fmt.Fprintln(w, "No changes.")
+        return
+    }
+    for _, c := range changes {
+        switch {
+        case c.Old == "":
+            fmt.Fprintf(w, "+ %s %s: %s\n", c.Topic, c.Path, c.New)
+        case c.New == "":
+            fmt.Fprintf(w, "- %s %s: %s\n", c.Topic, c.Path, c.Old)
+        default:
+            fmt.Fprintf(w, "~ %s %s: %s -> %s\n", c.Topic, c.Path, c.Old, c.New)
+        }
+    }
+}
+
 func indent(s string, n int) string {
     pad := strings.Repeat(" ", n)
     lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
@@ -68,3 +167,11 @@ func indent(s string, n int) string {
 }
 
 
+
+// printPayload shows stdin or file content indented below its step so it can
+// be reviewed before confirming.
+func printPayload(w io.Writer, s string) {
+    for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+        fmt.Fprintf(w, "    | %s\n", line)
+    }
+}
@@ -133,7 +133,10 @@ function action_execute()
     if data.dry_run then
         table.insert(argv, "-dry-run")
     else
+        -- Plans built from device facts always need interactive confirmation,
+        -- which this endpoint cannot provide.
         table.insert(argv, "-approve")
+        table.insert(argv, "-facts=false")
     end
     
     if data.timeout and tonumber(data.timeout) then